@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// TransferBatchConfig controls batch payment imports. Mode is all_or_nothing
+// or best_effort and can be overridden per request.
+type TransferBatchConfig struct {
+	Mode     string
+	MaxItems int
+}
+
+// GetTransferBatchConfig reads batch import configuration from environment
+// variables.
+func GetTransferBatchConfig() TransferBatchConfig {
+	return TransferBatchConfig{
+		Mode:     GetEnv("TRANSFER_BATCH_MODE", "all_or_nothing"),
+		MaxItems: GetEnvInt("TRANSFER_BATCH_MAX_ITEMS", 500),
+	}
+}
+
+// BulkTransferConfig controls the JSON bulk transfer API and the worker that
+// executes bulk transfers.
+type BulkTransferConfig struct {
+	MaxItems int
+	Interval time.Duration
+}
+
+// GetBulkTransferConfig reads bulk transfer configuration from environment
+// variables.
+func GetBulkTransferConfig() BulkTransferConfig {
+	return BulkTransferConfig{
+		MaxItems: GetEnvInt("BULK_TRANSFER_MAX_ITEMS", 500),
+		Interval: GetEnvDuration("BULK_TRANSFER_INTERVAL", 10*time.Second),
+	}
+}
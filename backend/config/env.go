@@ -3,7 +3,9 @@ package config
 import (
 	"bufio"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func LoadEnv() {
@@ -31,3 +33,35 @@ func GetEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetEnvInt reads an integer environment variable, falling back to the default
+// when it is unset or malformed.
+func GetEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvList reads a comma-separated environment variable, dropping empty
+// entries.
+func GetEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// GetEnvDuration reads a time.ParseDuration formatted environment variable,
+// falling back to the default when it is unset or malformed.
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+// HoldConfig controls authorization hold lifetimes and the expiry job.
+type HoldConfig struct {
+	DefaultTTL     time.Duration
+	MaxTTL         time.Duration
+	ExpiryInterval time.Duration
+}
+
+// GetHoldConfig reads hold configuration from environment variables.
+func GetHoldConfig() HoldConfig {
+	return HoldConfig{
+		DefaultTTL:     GetEnvDuration("HOLD_DEFAULT_TTL", 7*24*time.Hour),
+		MaxTTL:         GetEnvDuration("HOLD_MAX_TTL", 30*24*time.Hour),
+		ExpiryInterval: GetEnvDuration("HOLD_EXPIRY_INTERVAL", time.Minute),
+	}
+}
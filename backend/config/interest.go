@@ -0,0 +1,27 @@
+package config
+
+import "time"
+
+// InterestConfig controls the daily interest accrual job. APRs are annual
+// rates in basis points (1/100 of a percent) keyed by account type; overdrawn
+// balances are charged OverdraftAPRBasisPoints plus OverdraftDailyFee (minor
+// units) for every day that ends overdrawn.
+type InterestConfig struct {
+	Interval                time.Duration
+	APRBasisPoints          map[string]int64
+	OverdraftAPRBasisPoints int64
+	OverdraftDailyFee       int64
+}
+
+// GetInterestConfig reads interest configuration from environment variables.
+func GetInterestConfig() InterestConfig {
+	return InterestConfig{
+		Interval: GetEnvDuration("INTEREST_JOB_INTERVAL", time.Hour),
+		APRBasisPoints: map[string]int64{
+			"checking": int64(GetEnvInt("CHECKING_APR_BPS", 0)),
+			"savings":  int64(GetEnvInt("SAVINGS_APR_BPS", 200)),
+		},
+		OverdraftAPRBasisPoints: int64(GetEnvInt("OVERDRAFT_APR_BPS", 1500)),
+		OverdraftDailyFee:       int64(GetEnvInt("OVERDRAFT_DAILY_FEE", 0)),
+	}
+}
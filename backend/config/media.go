@@ -0,0 +1,33 @@
+package config
+
+// MediaConfig selects where uploaded media is stored and bounds uploads.
+// Store is "local", keeping blobs under LocalDir, or "s3", keeping them in
+// S3Bucket at S3Endpoint, which may be any S3-compatible service.
+type MediaConfig struct {
+	Store         string
+	LocalDir      string
+	MaxBytes      int
+	ThumbnailSize int
+
+	S3Endpoint  string
+	S3Bucket    string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+// GetMediaConfig reads media storage configuration from environment variables.
+func GetMediaConfig() MediaConfig {
+	return MediaConfig{
+		Store:         GetEnv("MEDIA_STORE", "local"),
+		LocalDir:      GetEnv("MEDIA_DIR", "media"),
+		MaxBytes:      GetEnvInt("MEDIA_MAX_BYTES", 5<<20),
+		ThumbnailSize: GetEnvInt("MEDIA_THUMBNAIL_SIZE", 320),
+
+		S3Endpoint:  GetEnv("MEDIA_S3_ENDPOINT", ""),
+		S3Bucket:    GetEnv("MEDIA_S3_BUCKET", ""),
+		S3Region:    GetEnv("MEDIA_S3_REGION", "us-east-1"),
+		S3AccessKey: GetEnv("MEDIA_S3_ACCESS_KEY", ""),
+		S3SecretKey: GetEnv("MEDIA_S3_SECRET_KEY", ""),
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import "time"
+
+// RailConfig selects the payment rail used for deposits and withdrawals; with
+// no Provider there is none, and both are refused. The simulator is for
+// development and only settles deposits from SimulatorSources. Transfers still
+// pending after StaleAfter are re-driven by asking the rail for their outcome,
+// every ReconcileInterval.
+type RailConfig struct {
+	Provider          string
+	WebhookSecret     string
+	SimulatorDelay    time.Duration
+	SimulatorSources  []string
+	StaleAfter        time.Duration
+	ReconcileInterval time.Duration
+}
+
+// GetRailConfig reads payment rail configuration from environment variables.
+func GetRailConfig() RailConfig {
+	return RailConfig{
+		Provider:          GetEnv("PAYMENT_RAIL", ""),
+		WebhookSecret:     GetEnv("PAYMENT_RAIL_WEBHOOK_SECRET", ""),
+		SimulatorDelay:    GetEnvDuration("PAYMENT_RAIL_SIMULATOR_DELAY", 5*time.Second),
+		SimulatorSources:  GetEnvList("PAYMENT_RAIL_SIMULATOR_SOURCES"),
+		StaleAfter:        GetEnvDuration("PAYMENT_RAIL_STALE_AFTER", 5*time.Minute),
+		ReconcileInterval: GetEnvDuration("PAYMENT_RAIL_RECONCILE_INTERVAL", time.Minute),
+	}
+}
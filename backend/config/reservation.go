@@ -0,0 +1,20 @@
+package config
+
+import "time"
+
+// ReservationConfig controls stock reservation lifetimes and the expiry job.
+type ReservationConfig struct {
+	DefaultTTL     time.Duration
+	MaxTTL         time.Duration
+	ExpiryInterval time.Duration
+}
+
+// GetReservationConfig reads reservation configuration from environment
+// variables.
+func GetReservationConfig() ReservationConfig {
+	return ReservationConfig{
+		DefaultTTL:     GetEnvDuration("RESERVATION_DEFAULT_TTL", 15*time.Minute),
+		MaxTTL:         GetEnvDuration("RESERVATION_MAX_TTL", time.Hour),
+		ExpiryInterval: GetEnvDuration("RESERVATION_EXPIRY_INTERVAL", 30*time.Second),
+	}
+}
@@ -0,0 +1,15 @@
+package config
+
+import "time"
+
+// ReviewConfig controls the admin review queue.
+type ReviewConfig struct {
+	SLA time.Duration
+}
+
+// GetReviewConfig reads review queue configuration from environment variables.
+func GetReviewConfig() ReviewConfig {
+	return ReviewConfig{
+		SLA: GetEnvDuration("REVIEW_SLA", 4*time.Hour),
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RiskRuleConfig configures one rule of the risk engine. Which of the
+// threshold fields are used depends on Type.
+type RiskRuleConfig struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Enabled    bool     `json:"enabled"`
+	Outcome    string   `json:"outcome"`
+	AppliesTo  []string `json:"applies_to,omitempty"`
+	MaxCount   int      `json:"max_count,omitempty"`
+	Window     string   `json:"window,omitempty"`
+	MinAmount  int64    `json:"min_amount,omitempty"`
+	Multiplier float64  `json:"multiplier,omitempty"`
+	MinHistory int      `json:"min_history,omitempty"`
+}
+
+// RiskConfig is the rule set evaluated before money leaves an account.
+type RiskConfig struct {
+	Rules []RiskRuleConfig `json:"rules"`
+}
+
+// DefaultRiskRules are used when RISK_RULES_FILE is not set.
+var DefaultRiskRules = []RiskRuleConfig{
+	{Name: "velocity", Type: "velocity", Enabled: true, Outcome: "review", MaxCount: 5, Window: "10m"},
+	{Name: "new_payee_large_amount", Type: "new_payee", Enabled: true, Outcome: "review", AppliesTo: []string{"transfer"}, MinAmount: 50000},
+	{Name: "first_transfer_after_password_change", Type: "password_change", Enabled: true, Outcome: "review", AppliesTo: []string{"transfer", "withdrawal"}, Window: "24h"},
+	{Name: "unusual_amount", Type: "unusual_amount", Enabled: true, Outcome: "review", Multiplier: 5, MinHistory: 3, Window: "2160h"},
+	{Name: "amount_limit", Type: "amount_limit", Enabled: true, Outcome: "deny", MinAmount: 10000000},
+}
+
+// GetRiskConfig reads the risk rules from the JSON file named by
+// RISK_RULES_FILE, falling back to DefaultRiskRules when it is unset.
+func GetRiskConfig() (RiskConfig, error) {
+	path := GetEnv("RISK_RULES_FILE", "")
+	if path == "" {
+		return RiskConfig{Rules: DefaultRiskRules}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RiskConfig{}, fmt.Errorf("read risk rules: %w", err)
+	}
+
+	var cfg RiskConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return RiskConfig{}, fmt.Errorf("parse risk rules %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+// SchedulerConfig controls the background worker that executes scheduled transfers.
+type SchedulerConfig struct {
+	Interval   time.Duration
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+// GetSchedulerConfig reads scheduler configuration from environment variables.
+func GetSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		Interval:   GetEnvDuration("SCHEDULER_INTERVAL", time.Minute),
+		MaxRetries: GetEnvInt("SCHEDULER_MAX_RETRIES", 3),
+		RetryDelay: GetEnvDuration("SCHEDULER_RETRY_DELAY", time.Hour),
+	}
+}
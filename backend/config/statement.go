@@ -0,0 +1,41 @@
+package config
+
+import "time"
+
+// StatementConfig describes the bank in exported account statements and
+// controls the monthly statement job. Issued statement documents are kept in
+// a blob store of their own, chosen like the media store: Store is "local",
+// keeping them under LocalDir, or "s3", keeping them in S3Bucket at
+// S3Endpoint.
+type StatementConfig struct {
+	Currency string
+	BankID   string
+	Interval time.Duration
+
+	Store    string
+	LocalDir string
+
+	S3Endpoint  string
+	S3Bucket    string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+// GetStatementConfig reads statement configuration from environment variables.
+func GetStatementConfig() StatementConfig {
+	return StatementConfig{
+		Currency: GetEnv("STATEMENT_CURRENCY", "TRY"),
+		BankID:   GetEnv("STATEMENT_BANK_ID", "000000000"),
+		Interval: GetEnvDuration("STATEMENT_JOB_INTERVAL", time.Hour),
+
+		Store:    GetEnv("STATEMENT_STORE", "local"),
+		LocalDir: GetEnv("STATEMENT_DIR", "statements"),
+
+		S3Endpoint:  GetEnv("STATEMENT_S3_ENDPOINT", ""),
+		S3Bucket:    GetEnv("STATEMENT_S3_BUCKET", ""),
+		S3Region:    GetEnv("STATEMENT_S3_REGION", "us-east-1"),
+		S3AccessKey: GetEnv("STATEMENT_S3_ACCESS_KEY", ""),
+		S3SecretKey: GetEnv("STATEMENT_S3_SECRET_KEY", ""),
+	}
+}
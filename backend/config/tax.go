@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// TaxRateConfig is the rate charged on one tax class in one jurisdiction, in
+// basis points of the net price.
+type TaxRateConfig struct {
+	Jurisdiction string `json:"jurisdiction"`
+	Class        string `json:"class"`
+	Rate         int64  `json:"rate_bp"`
+}
+
+// TaxConfig is the tax rate table. Products without a tax class use
+// DefaultClass, and buyers without a jurisdiction DefaultJurisdiction.
+type TaxConfig struct {
+	DefaultJurisdiction string          `json:"default_jurisdiction"`
+	DefaultClass        string          `json:"default_class"`
+	Rates               []TaxRateConfig `json:"rates"`
+}
+
+// DefaultTaxConfig is used when TAX_RATES_FILE is not set: Turkish VAT.
+var DefaultTaxConfig = TaxConfig{
+	DefaultJurisdiction: "TR",
+	DefaultClass:        "standard",
+	Rates: []TaxRateConfig{
+		{Jurisdiction: "TR", Class: "standard", Rate: 2000},
+		{Jurisdiction: "TR", Class: "reduced", Rate: 1000},
+		{Jurisdiction: "TR", Class: "essential", Rate: 100},
+		{Jurisdiction: "TR", Class: "exempt", Rate: 0},
+	},
+}
+
+// GetTaxConfig reads the tax rates from the JSON file named by
+// TAX_RATES_FILE, falling back to DefaultTaxConfig when it is unset.
+func GetTaxConfig() (TaxConfig, error) {
+	path := GetEnv("TAX_RATES_FILE", "")
+	if path == "" {
+		return DefaultTaxConfig, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TaxConfig{}, fmt.Errorf("read tax rates: %w", err)
+	}
+
+	var cfg TaxConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return TaxConfig{}, fmt.Errorf("parse tax rates %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
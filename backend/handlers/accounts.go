@@ -1,20 +1,27 @@
 package handlers
 
 import (
+	appconfig "banking-ecommerce-api/config"
 	"banking-ecommerce-api/middleware"
 	"banking-ecommerce-api/repository"
 	"banking-ecommerce-api/services"
 	"banking-ecommerce-api/utils"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 )
 
+// maxFundingSourceLength bounds the outside account reference a deposit is
+// pulled from.
+const maxFundingSourceLength = 64
+
 func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		AccountName string `json:"account_name"`
+		AccountType string `json:"account_type"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -37,16 +44,29 @@ func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.AccountType == "" {
+		req.AccountType = repository.AccountTypeChecking
+	}
+
+	if req.AccountType != repository.AccountTypeChecking && req.AccountType != repository.AccountTypeSavings {
+		http.Error(w, "Account type must be checking or savings", http.StatusBadRequest)
+		return
+	}
+
 	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
 
 	account := repository.Account{
 		ID:          utils.GenerateUserID(),
 		UserID:      claims.UserID,
 		AccountName: req.AccountName,
+		AccountType: req.AccountType,
 		Balance:     0,
 		CreatedAt:   time.Now(),
 	}
 
+	services.AuditAction(r.Context(), "account.create", "account", account.ID)
+	services.AuditSnapshot(r.Context(), nil, account)
+
 	if err := repository.CreateAccount(r.Context(), account); err != nil {
 		http.Error(w, "Failed to create account", http.StatusInternalServerError)
 		return
@@ -99,6 +119,22 @@ func GetAccountsByUserIDHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&accounts)
 }
 
+// AccountPathHandler serves /accounts/{user_id}, /accounts/{id}/statement and
+// the issued statements under /accounts/{id}/statements.
+func AccountPathHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/")
+	switch {
+	case len(parts) == 2 && parts[1] == "statement":
+		AccountStatementHandler(w, r)
+	case len(parts) == 2 && parts[1] == "statements":
+		IssuedStatementsHandler(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "statements":
+		IssuedStatementHandler(w, r, parts[0], parts[2])
+	default:
+		GetAccountsByUserIDHandler(w, r)
+	}
+}
+
 func AccountsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
@@ -115,6 +151,8 @@ func TransferMoneyHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		FromAccountID string `json:"from_account_id"`
 		ToAccountID   string `json:"to_account_id"`
+		Recipient     string `json:"recipient"`
+		PayeeID       string `json:"payee_id"`
 		Amount        int64  `json:"amount"`
 	}
 
@@ -123,6 +161,16 @@ func TransferMoneyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Recipients can be addressed by username/email or saved payee instead of
+	// by account ID; they resolve to the recipient's default receiving account.
+	if req.ToAccountID == "" {
+		_, recipientAccount, ok := resolveRecipient(w, r, req.Recipient, req.PayeeID)
+		if !ok {
+			return
+		}
+		req.ToAccountID = recipientAccount.ID
+	}
+
 	if req.FromAccountID == req.ToAccountID {
 		http.Error(w, "Self-transfer is not allowed", http.StatusBadRequest)
 		return
@@ -158,11 +206,42 @@ func TransferMoneyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if fromAccount.Balance < req.Amount {
+	if fromAccount.AvailableBalance() < req.Amount {
 		http.Error(w, "Insufficient balance", http.StatusBadRequest)
 		return
 	}
 
+	services.AuditAction(r.Context(), "account.transfer", "account", fromAccount.ID)
+
+	assessment, ok := assessRisk(w, r, services.RiskOperation{
+		Kind:        services.RiskKindTransfer,
+		UserID:      claims.UserID,
+		AccountID:   fromAccount.ID,
+		ToAccountID: toAccount.ID,
+		Amount:      req.Amount,
+	})
+	services.AuditSnapshot(r.Context(), nil, map[string]interface{}{
+		"from_account_id":    fromAccount.ID,
+		"to_account_id":      toAccount.ID,
+		"amount":             req.Amount,
+		"risk_assessment_id": assessment.ID,
+		"risk_decision":      assessment.Decision,
+	})
+	if !ok {
+		return
+	}
+
+	if assessment.Decision == services.RiskReview {
+		parkForReview(w, r, repository.ReviewItem{
+			Kind:        repository.ReviewKindTransfer,
+			UserID:      claims.UserID,
+			AccountID:   fromAccount.ID,
+			ToAccountID: toAccount.ID,
+			Amount:      req.Amount,
+		}, fromAccount, assessment)
+		return
+	}
+
 	if err := repository.TransferMoney(r.Context(), fromAccount.ID, toAccount.ID, req.Amount); err != nil {
 		if errors.Is(err, repository.ErrInsufficientBalance) {
 			http.Error(w, "Insufficient balance", http.StatusBadRequest)
@@ -172,6 +251,10 @@ func TransferMoneyHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Account not found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, repository.ErrTransferInterrupted) {
+			http.Error(w, "Transfer was interrupted, try again", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Transfer failed", http.StatusInternalServerError)
 		return
 	}
@@ -182,7 +265,19 @@ func TransferMoneyHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// DepositMoney submits a deposit from an outside funding source to the
+// payment rail. The funds only reach the balance once the rail settles it.
 func DepositMoney(w http.ResponseWriter, r *http.Request) {
+	initiateExternalTransfer(w, r, repository.ExternalDirectionDeposit)
+}
+
+// WithdrawMoney submits a withdrawal to the payment rail, holding the amount
+// on the account until the rail settles or fails it.
+func WithdrawMoney(w http.ResponseWriter, r *http.Request) {
+	initiateExternalTransfer(w, r, repository.ExternalDirectionWithdrawal)
+}
+
+func initiateExternalTransfer(w http.ResponseWriter, r *http.Request, direction string) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -193,6 +288,7 @@ func DepositMoney(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		AccountID string `json:"account_id"`
 		Amount    int64  `json:"amount"`
+		Source    string `json:"source"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -200,6 +296,12 @@ func DepositMoney(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.Source = strings.TrimSpace(req.Source)
+	if direction == repository.ExternalDirectionDeposit && (req.Source == "" || len(req.Source) > maxFundingSourceLength) {
+		http.Error(w, fmt.Sprintf("A funding source of up to %d characters is required", maxFundingSourceLength), http.StatusBadRequest)
+		return
+	}
+
 	account, err := repository.GetAccountByID(r.Context(), req.AccountID)
 	if err != nil {
 		if errors.Is(err, repository.ErrAccountNotFound) {
@@ -220,17 +322,170 @@ func DepositMoney(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := repository.DepositMoney(r.Context(), req.AccountID, req.Amount); err != nil {
+	if direction == repository.ExternalDirectionWithdrawal && account.AvailableBalance() < req.Amount {
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		return
+	}
+
+	services.AuditAction(r.Context(), "account."+direction, "account", account.ID)
+
+	if direction == repository.ExternalDirectionWithdrawal {
+		assessment, ok := assessRisk(w, r, services.RiskOperation{
+			Kind:      services.RiskKindWithdrawal,
+			UserID:    claims.UserID,
+			AccountID: account.ID,
+			Amount:    req.Amount,
+		})
+		services.AuditSnapshot(r.Context(), nil, map[string]interface{}{
+			"account_id":         account.ID,
+			"amount":             req.Amount,
+			"risk_assessment_id": assessment.ID,
+			"risk_decision":      assessment.Decision,
+		})
+		if !ok {
+			return
+		}
+
+		if assessment.Decision == services.RiskReview {
+			parkForReview(w, r, repository.ReviewItem{
+				Kind:      repository.ReviewKindWithdrawal,
+				UserID:    claims.UserID,
+				AccountID: account.ID,
+				Amount:    req.Amount,
+			}, account, assessment)
+			return
+		}
+	}
+
+	transfer, err := services.InitiateExternalTransfer(r.Context(), account, direction, req.Amount, req.Source)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			http.Error(w, "Insufficient balance", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrRailNotConfigured) {
+			http.Error(w, "Deposits and withdrawals are not available", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Failed to submit "+direction, http.StatusInternalServerError)
+		return
+	}
+
+	services.AuditSnapshot(r.Context(), nil, transfer)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(&transfer)
+}
+
+// AdminAccountHandler serves /admin/accounts/{id}, returning any account with
+// its version as the ETag, and the overdraft beneath it.
+func AdminAccountHandler(w http.ResponseWriter, r *http.Request) {
+	accountID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/accounts/"), "/")
+	if action == "overdraft" {
+		OverdraftHandler(w, r)
+		return
+	}
+
+	if accountID == "" || action != "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account, err := repository.GetAccountByID(r.Context(), accountID)
+	if err != nil {
 		if errors.Is(err, repository.ErrAccountNotFound) {
 			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Failed to deposit money", http.StatusInternalServerError)
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
 		return
 	}
 
+	setETag(w, account.Version)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Deposit successful",
-	})
+	json.NewEncoder(w).Encode(&account)
+}
+
+// OverdraftHandler lets admins grant or change (PUT) and revoke (DELETE) an
+// account's overdraft at /admin/accounts/{id}/overdraft, under If-Match.
+// Revoking leaves an overdrawn balance in place but blocks further debits
+// until it is repaid.
+func OverdraftHandler(w http.ResponseWriter, r *http.Request) {
+	accountID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/accounts/"), "/")
+	if accountID == "" || action != "overdraft" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	services.AuditAction(r.Context(), "account.overdraft", "account", accountID)
+
+	account, err := repository.GetAccountByID(r.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkIfMatch(w, r, account.Version) {
+		return
+	}
+
+	var limit int64
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Limit int64 `json:"limit"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid json", http.StatusBadRequest)
+			return
+		}
+
+		if req.Limit <= 0 {
+			http.Error(w, "Overdraft limit must be positive", http.StatusBadRequest)
+			return
+		}
+		limit = req.Limit
+	case http.MethodDelete:
+		limit = 0
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var accrualFrom string
+	if limit > 0 {
+		accrualFrom = services.OverdraftAccrualStart(account, appconfig.GetInterestConfig(), time.Now())
+	}
+
+	if err := repository.SetOverdraftLimit(r.Context(), account.ID, limit, accrualFrom, account.Version); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAccountNotFound):
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVersionConflict):
+			writeVersionConflict(w)
+		default:
+			http.Error(w, "Failed to update overdraft", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	before := account
+	account.OverdraftLimit = limit
+	account.Version++
+	services.AuditSnapshot(r.Context(), before, account)
+
+	setETag(w, account.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&account)
 }
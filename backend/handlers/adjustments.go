@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CreateAdjustmentHandler lets an admin propose a manual credit or debit. It
+// is not applied until another admin approves it.
+func CreateAdjustmentHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		AccountID  string `json:"account_id"`
+		Type       string `json:"type"`
+		Amount     int64  `json:"amount"`
+		ReasonCode string `json:"reason_code"`
+		Note       string `json:"note"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Type != repository.AdjustmentCredit && req.Type != repository.AdjustmentDebit {
+		http.Error(w, "Type must be credit or debit", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	if !repository.AdjustmentReasonCodes[req.ReasonCode] {
+		http.Error(w, "Unknown reason code", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Note) == "" || len(req.Note) > 500 {
+		http.Error(w, "Note is required and cannot exceed 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	account, err := repository.GetAccountByID(r.Context(), req.AccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	adjustment := repository.Adjustment{
+		ID:         utils.GenerateID("adj"),
+		AccountID:  account.ID,
+		UserID:     account.UserID,
+		Type:       req.Type,
+		Amount:     req.Amount,
+		ReasonCode: req.ReasonCode,
+		Note:       req.Note,
+		Status:     repository.AdjustmentStatusPending,
+		ProposedBy: claims.UserID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	services.AuditAction(r.Context(), "adjustment.propose", "adjustment", adjustment.ID)
+	services.AuditSnapshot(r.Context(), nil, adjustment)
+
+	err = services.AuditedWrite(r.Context(), http.StatusCreated, func(ctx context.Context, event repository.AuditEvent) error {
+		return repository.CreateAdjustment(ctx, adjustment, event)
+	})
+	if err != nil {
+		http.Error(w, "Failed to create adjustment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&adjustment)
+}
+
+// GetAdjustmentsHandler lists adjustments by ?status=, pending by default.
+func GetAdjustmentsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = repository.AdjustmentStatusPending
+	case repository.AdjustmentStatusPending, repository.AdjustmentStatusApproved, repository.AdjustmentStatusRejected:
+	default:
+		http.Error(w, "Status must be pending, approved or rejected", http.StatusBadRequest)
+		return
+	}
+
+	adjustments, err := repository.GetAdjustmentsByStatus(r.Context(), status)
+	if err != nil {
+		http.Error(w, "Failed to fetch adjustments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&adjustments)
+}
+
+func AdjustmentsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreateAdjustmentHandler(w, r)
+	case http.MethodGet:
+		GetAdjustmentsHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AdjustmentHandler serves /admin/adjustments/{id} and the /{id}/approve and
+// /{id}/reject actions.
+func AdjustmentHandler(w http.ResponseWriter, r *http.Request) {
+	adjustmentID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/adjustments/"), "/")
+	if adjustmentID == "" {
+		http.Error(w, "Adjustment ID required", http.StatusBadRequest)
+		return
+	}
+
+	adjustment, err := repository.GetAdjustmentByID(r.Context(), adjustmentID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAdjustmentNotFound) {
+			http.Error(w, "Adjustment not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load adjustment", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&adjustment)
+	case r.Method == http.MethodPost && (action == "approve" || action == "reject"):
+		reviewAdjustment(w, r, adjustment, action == "approve")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func reviewAdjustment(w http.ResponseWriter, r *http.Request, adjustment repository.Adjustment, approve bool) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	action := "adjustment.reject"
+	if approve {
+		action = "adjustment.approve"
+	}
+	services.AuditAction(r.Context(), action, "adjustment", adjustment.ID)
+
+	var req struct {
+		Note string `json:"note"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(req.Note) > 500 {
+		http.Error(w, "Note cannot exceed 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	if adjustment.Status != repository.AdjustmentStatusPending {
+		http.Error(w, "Adjustment is "+adjustment.Status, http.StatusConflict)
+		return
+	}
+
+	if approve && adjustment.ProposedBy == claims.UserID {
+		http.Error(w, "Adjustments must be approved by a different admin", http.StatusForbidden)
+		return
+	}
+
+	before := adjustment
+	now := time.Now().UTC().Truncate(time.Second)
+	adjustment.Status = repository.AdjustmentStatusRejected
+	if approve {
+		adjustment.Status = repository.AdjustmentStatusApproved
+	}
+	adjustment.ReviewedBy = claims.UserID
+	adjustment.ReviewNote = req.Note
+	adjustment.UpdatedAt = now
+	services.AuditSnapshot(r.Context(), before, adjustment)
+
+	err := services.AuditedWrite(r.Context(), http.StatusOK, func(ctx context.Context, event repository.AuditEvent) error {
+		if approve {
+			return repository.ApproveAdjustment(ctx, before, claims.UserID, req.Note, now, event)
+		}
+		return repository.RejectAdjustment(ctx, before, claims.UserID, req.Note, now, event)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAdjustmentSelfApproval):
+			http.Error(w, "Adjustments must be approved by a different admin", http.StatusForbidden)
+		case errors.Is(err, repository.ErrAdjustmentClosed):
+			http.Error(w, "Adjustment is no longer pending", http.StatusConflict)
+		case errors.Is(err, repository.ErrAccountNotFound):
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to review adjustment", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&adjustment)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/repository"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 500
+)
+
+// AuditLogHandler lets admins search the audit log, newest first. Results can
+// be filtered by actor_id, action, target_type, target_id and an RFC 3339
+// from/to range, and paged by passing the returned next_before_seq back as
+// before_seq.
+func AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repository.AuditFilter{
+		ActorID:    query.Get("actor_id"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Limit:      defaultAuditLimit,
+	}
+
+	var err error
+	if v := query.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("before_seq"); v != "" {
+		if filter.BeforeSeq, err = strconv.ParseInt(v, 10, 64); err != nil || filter.BeforeSeq <= 0 {
+			http.Error(w, "before_seq must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := repository.QueryAuditEvents(r.Context(), repository.AuditChain, filter)
+	if err != nil {
+		http.Error(w, "Failed to fetch audit log", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"events": events,
+	}
+	if len(events) == filter.Limit {
+		response["next_before_seq"] = events[len(events)-1].Seq
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -64,6 +64,10 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		LastLogin:    time.Time{},
 	}
 
+	services.AuditActor(r.Context(), user.ID, user.Role)
+	services.AuditAction(r.Context(), "user.register", "user", user.ID)
+	services.AuditSnapshot(r.Context(), nil, user)
+
 	if err := repository.CreateUser(r.Context(), user); err != nil {
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
@@ -110,11 +114,15 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	services.AuditAction(r.Context(), "user.login", "user", user.ID)
+
 	if !utils.VerifyPassword(req.Password, user.PasswordHash) {
 		http.Error(w, "Invalid password", http.StatusUnauthorized)
 		return
 	}
 
+	services.AuditActor(r.Context(), user.ID, user.Role)
+
 	lastLogin := time.Now()
 	if err := repository.UpdateUserLastLogin(r.Context(), user.ID, lastLogin); err != nil {
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
@@ -138,6 +146,8 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ProfileHandler serves the caller's profile (GET) with its version as the
+// ETag, and changes its name or email (PATCH) under If-Match.
 func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
 
@@ -151,6 +161,140 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		if !updateProfile(w, r, &user) {
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	setETag(w, user.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
+
+// updateProfile applies a PATCH of full_name and/or email to user, reporting
+// whether it succeeded.
+func updateProfile(w http.ResponseWriter, r *http.Request, user *repository.User) bool {
+	if !checkIfMatch(w, r, user.Version) {
+		return false
+	}
+
+	var req struct {
+		FullName        *string `json:"full_name"`
+		Email           *string `json:"email"`
+		TaxJurisdiction *string `json:"tax_jurisdiction"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json format", http.StatusBadRequest)
+		return false
+	}
+
+	before := *user
+	if req.FullName != nil {
+		if *req.FullName == "" {
+			http.Error(w, "Full name cannot be empty", http.StatusBadRequest)
+			return false
+		}
+		user.FullName = *req.FullName
+	}
+
+	if req.Email != nil && *req.Email != user.Email {
+		if !utils.IsValidEmail(*req.Email) {
+			http.Error(w, "Invalid email format", http.StatusBadRequest)
+			return false
+		}
+
+		if _, err := repository.GetUserByEmail(r.Context(), *req.Email); err == nil {
+			http.Error(w, "Email already in use", http.StatusConflict)
+			return false
+		} else if !errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "Failed to verify user uniqueness", http.StatusInternalServerError)
+			return false
+		}
+		user.Email = *req.Email
+	}
+
+	if req.TaxJurisdiction != nil {
+		jurisdiction := services.NormalizeTaxJurisdiction(*req.TaxJurisdiction)
+		if jurisdiction != "" && !services.IsTaxJurisdiction(jurisdiction) {
+			http.Error(w, "Unknown tax jurisdiction", http.StatusBadRequest)
+			return false
+		}
+		user.TaxJurisdiction = jurisdiction
+	}
+
+	services.AuditAction(r.Context(), "user.profile_update", "user", user.ID)
+	services.AuditSnapshot(r.Context(), before, *user)
+
+	if err := repository.UpdateUser(r.Context(), *user); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVersionConflict):
+			writeVersionConflict(w)
+		default:
+			http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		}
+		return false
+	}
+	user.Version++
+
+	return true
+}
+
+// ChangePasswordHandler replaces the caller's password after checking the
+// current one.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json format", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.NewPassword) < 6 {
+		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
+		return
+	}
+
+	user, err := repository.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	services.AuditAction(r.Context(), "user.password_change", "user", user.ID)
+
+	if !utils.VerifyPassword(req.CurrentPassword, user.PasswordHash) {
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	if err := repository.UpdatePassword(r.Context(), user.ID, utils.HashPassword(req.NewPassword), time.Now()); err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "password changed"})
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	appconfig "banking-ecommerce-api/config"
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxBatchBytes caps the size of an uploaded payment file.
+const maxBatchBytes = 5 << 20
+
+// TransferBatchHandler serves POST /transfers/batch. The body is an ISO 20022
+// pain.001 document (application/xml) or a CSV file (text/csv). Every
+// instruction is validated and risk-checked before any is executed, and
+// ?mode= (TRANSFER_BATCH_MODE by default) decides whether a failed
+// instruction rejects the whole batch (all_or_nothing) or only itself
+// (best_effort). A message ID is only ever executed once per user. The
+// response is a pain.002 status report.
+func TransferBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+	cfg := appconfig.GetTransferBatchConfig()
+	currency := appconfig.GetStatementConfig().Currency
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = cfg.Mode
+	}
+	if mode != services.BatchAllOrNothing && mode != services.BatchBestEffort {
+		http.Error(w, "Mode must be all_or_nothing or best_effort", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := http.MaxBytesReader(w, r.Body, maxBatchBytes)
+
+	var batch services.TransferBatch
+	var err error
+	switch mediaType {
+	case "application/xml", "text/xml":
+		batch, err = services.ParsePain001(body)
+	case "text/csv":
+		batch, err = services.ParseTransferBatchCSV(body, currency)
+	default:
+		http.Error(w, "Content type must be application/xml (pain.001) or text/csv", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid batch file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(batch.Instructions) > cfg.MaxItems {
+		http.Error(w, fmt.Sprintf("Batch cannot exceed %d transfers", cfg.MaxItems), http.StatusBadRequest)
+		return
+	}
+
+	if mode == services.BatchAllOrNothing {
+		accounts := map[string]bool{}
+		for _, instruction := range batch.Instructions {
+			accounts[instruction.FromAccountID] = true
+			accounts[instruction.ToAccountID] = true
+		}
+		if repository.TransferBatchSize(len(accounts), len(batch.Instructions)) > repository.MaxTransactItems {
+			http.Error(w, fmt.Sprintf("An all_or_nothing batch must fit in one transaction of %d operations; split it or use best_effort", repository.MaxTransactItems), http.StatusBadRequest)
+			return
+		}
+	}
+
+	record := repository.TransferBatch{
+		ID:        repository.TransferBatchID(claims.UserID, batch.MessageID),
+		UserID:    claims.UserID,
+		MessageID: batch.MessageID,
+		Mode:      mode,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	services.AuditAction(r.Context(), "transfer.batch", "transfer_batch", record.ID)
+
+	// A best_effort batch may execute some instructions before failing, so its
+	// message is claimed up front; an all_or_nothing batch claims it in the
+	// transaction that executes it.
+	if mode == services.BatchBestEffort {
+		err = repository.CreateTransferBatch(r.Context(), record)
+	}
+	var results []services.BatchResult
+	if err == nil {
+		results, err = runTransferBatch(r.Context(), record, batch, currency)
+	}
+	if errors.Is(err, repository.ErrTransferBatchExists) {
+		http.Error(w, "Batch "+batch.MessageID+" was already submitted", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to process batch", http.StatusInternalServerError)
+		return
+	}
+
+	services.AuditSnapshot(r.Context(), nil, map[string]interface{}{
+		"message_id":   batch.MessageID,
+		"mode":         mode,
+		"transactions": len(batch.Instructions),
+		"group_status": services.BatchGroupStatus(results),
+	})
+
+	w.Header().Set("Content-Type", "application/xml")
+	if err := services.WritePain002(w, batch, results); err != nil {
+		log.Printf("batch: writing status report for %s: %v", batch.MessageID, err)
+	}
+}
+
+// runTransferBatch validates, risk-checks and then executes the batch's
+// instructions in order. Instructions that need review are queued like single
+// transfers. In all_or_nothing mode nothing runs unless every instruction
+// passes the checks, and then all of them run in one transaction.
+func runTransferBatch(ctx context.Context, record repository.TransferBatch, batch services.TransferBatch, currency string) ([]services.BatchResult, error) {
+	userID, mode := record.UserID, record.Mode
+	results := make([]services.BatchResult, len(batch.Instructions))
+	failed := false
+	reject := func(i int, reason, detail string) {
+		results[i] = services.BatchResult{Status: services.PaymentStatusRejected, Reason: reason, Detail: detail}
+		failed = true
+	}
+	rejectRest := func(detail string) {
+		for i := range results {
+			if results[i].Status == "" {
+				results[i] = services.BatchResult{Status: services.PaymentStatusRejected, Reason: services.ReasonNarrative, Detail: detail}
+			}
+		}
+	}
+
+	accounts := map[string]*repository.Account{}
+	loadAccount := func(id string) (*repository.Account, error) {
+		if account, ok := accounts[id]; ok {
+			return account, nil
+		}
+		account, err := repository.GetAccountByID(ctx, id)
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			accounts[id] = nil
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		accounts[id] = &account
+		return &account, nil
+	}
+
+	// Funds are reserved as instructions pass, so later ones are checked
+	// against what the earlier ones leave behind.
+	available := map[string]int64{}
+	for i, instruction := range batch.Instructions {
+		from, err := loadAccount(instruction.FromAccountID)
+		if err != nil {
+			return nil, err
+		}
+		to, err := loadAccount(instruction.ToAccountID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case from == nil || from.UserID != userID:
+			reject(i, services.ReasonDebtorAccount, "Debtor account is not one of yours")
+			continue
+		case to == nil:
+			reject(i, services.ReasonCreditorAccount, "Creditor account doesn't exist")
+			continue
+		case from.ID == to.ID:
+			reject(i, services.ReasonNotAllowed, "Self-transfer is not allowed")
+			continue
+		case instruction.Currency != currency:
+			reject(i, services.ReasonCurrency, "Currency must be "+currency)
+			continue
+		case instruction.Amount <= 0:
+			reject(i, services.ReasonInvalidAmount, "Invalid amount")
+			continue
+		}
+
+		if _, ok := available[from.ID]; !ok {
+			available[from.ID] = from.AvailableBalance()
+		}
+		if available[from.ID] < instruction.Amount {
+			reject(i, services.ReasonFunds, "Insufficient balance")
+			continue
+		}
+		available[from.ID] -= instruction.Amount
+	}
+
+	if failed && mode == services.BatchAllOrNothing {
+		rejectRest("Batch rejected because another instruction failed")
+		return results, nil
+	}
+
+	// Instructions accepted so far count towards velocity, as they will have
+	// run by the time the later ones do.
+	assessments := make([]repository.RiskAssessment, len(results))
+	accepted := 0
+	for i, instruction := range batch.Instructions {
+		if results[i].Status != "" {
+			continue
+		}
+
+		assessment, err := services.AssessRisk(ctx, services.RiskOperation{
+			Kind:        services.RiskKindTransfer,
+			UserID:      userID,
+			AccountID:   instruction.FromAccountID,
+			ToAccountID: instruction.ToAccountID,
+			Amount:      instruction.Amount,
+			Pending:     accepted,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if assessment.Decision == services.RiskDeny {
+			reject(i, services.ReasonNotAllowed, "Payment declined by risk checks")
+			continue
+		}
+		assessments[i] = assessment
+		accepted++
+	}
+
+	if mode == services.BatchAllOrNothing {
+		if failed {
+			rejectRest("Batch rejected because another instruction failed")
+			return results, nil
+		}
+		return executeBatchAtomically(ctx, record, batch, assessments)
+	}
+
+	for i, instruction := range batch.Instructions {
+		if results[i].Status != "" {
+			continue
+		}
+
+		if assessments[i].Decision == services.RiskReview {
+			results[i] = queueBatchInstruction(ctx, userID, instruction, assessments[i])
+			continue
+		}
+
+		results[i] = services.BatchResult{Status: services.PaymentStatusAccepted}
+		if err := repository.TransferMoney(ctx, instruction.FromAccountID, instruction.ToAccountID, instruction.Amount); err != nil {
+			results[i] = batchFailure(err)
+		}
+	}
+
+	return results, nil
+}
+
+// executeBatchAtomically executes an all_or_nothing batch whose instructions
+// all passed the checks in a single transaction, parking the ones the risk
+// engine flagged in the same transaction. A paying account that changed since
+// it was read is reloaded and the transaction retried; if it still fails,
+// every instruction is rejected.
+func executeBatchAtomically(ctx context.Context, record repository.TransferBatch, batch services.TransferBatch, assessments []repository.RiskAssessment) ([]services.BatchResult, error) {
+	results := make([]services.BatchResult, len(batch.Instructions))
+	var transfers []repository.BatchTransfer
+	var reviews []repository.ReviewItem
+	for i, instruction := range batch.Instructions {
+		id := record.ID + "_" + strconv.Itoa(i)
+		if assessments[i].Decision == services.RiskReview {
+			item := services.NewReviewItem(repository.ReviewItem{
+				ID:          "review_" + id,
+				Kind:        repository.ReviewKindTransfer,
+				UserID:      record.UserID,
+				AccountID:   instruction.FromAccountID,
+				ToAccountID: instruction.ToAccountID,
+				Amount:      instruction.Amount,
+			}, assessments[i])
+			reviews = append(reviews, item)
+			results[i] = services.BatchResult{Status: services.PaymentStatusPending, Reason: services.ReasonNarrative, Detail: "Held for review " + item.ID}
+			continue
+		}
+
+		transfers = append(transfers, repository.BatchTransfer{
+			ID:            "transfer_" + id,
+			FromAccountID: instruction.FromAccountID,
+			ToAccountID:   instruction.ToAccountID,
+			Amount:        instruction.Amount,
+		})
+		results[i] = services.BatchResult{Status: services.PaymentStatusAccepted}
+	}
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		accounts := map[string]repository.Account{}
+		for _, instruction := range batch.Instructions {
+			for _, id := range []string{instruction.FromAccountID, instruction.ToAccountID} {
+				if _, ok := accounts[id]; ok {
+					continue
+				}
+				account, err := repository.GetAccountByID(ctx, id)
+				if err != nil && !errors.Is(err, repository.ErrAccountNotFound) {
+					return nil, err
+				}
+				accounts[id] = account
+			}
+		}
+
+		err = repository.ExecuteTransferBatch(ctx, record, transfers, reviews, accounts, time.Now().UTC())
+		if !errors.Is(err, repository.ErrInsufficientBalance) {
+			break
+		}
+	}
+
+	switch {
+	case err == nil:
+		return results, nil
+	case errors.Is(err, repository.ErrInsufficientBalance), errors.Is(err, repository.ErrAccountNotFound), errors.Is(err, repository.ErrTransferConflict):
+		for i := range results {
+			results[i] = batchFailure(err)
+		}
+		return results, nil
+	default:
+		return nil, err
+	}
+}
+
+// queueBatchInstruction parks an instruction the risk engine flagged in the
+// review queue.
+func queueBatchInstruction(ctx context.Context, userID string, instruction services.BatchInstruction, assessment repository.RiskAssessment) services.BatchResult {
+	// Earlier instructions moved the balance and holds, so the account is
+	// reloaded for the hold's condition.
+	from, err := repository.GetAccountByID(ctx, instruction.FromAccountID)
+	if err != nil {
+		return batchFailure(err)
+	}
+
+	item, err := services.QueueForReview(ctx, repository.ReviewItem{
+		Kind:        repository.ReviewKindTransfer,
+		UserID:      userID,
+		AccountID:   instruction.FromAccountID,
+		ToAccountID: instruction.ToAccountID,
+		Amount:      instruction.Amount,
+	}, from, assessment)
+	if err != nil {
+		return batchFailure(err)
+	}
+
+	return services.BatchResult{Status: services.PaymentStatusPending, Reason: services.ReasonNarrative, Detail: "Held for review " + item.ID}
+}
+
+// batchFailure reports an instruction that failed to execute.
+func batchFailure(err error) services.BatchResult {
+	result := services.BatchResult{Status: services.PaymentStatusRejected}
+	switch {
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		result.Reason, result.Detail = services.ReasonFunds, "Insufficient balance"
+	case errors.Is(err, repository.ErrAccountNotFound):
+		result.Reason, result.Detail = services.ReasonCreditorAccount, "Account not found"
+	default:
+		log.Printf("batch: transfer failed: %v", err)
+		result.Reason, result.Detail = services.ReasonNarrative, "Transfer failed"
+	}
+	return result
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	appconfig "banking-ecommerce-api/config"
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bulkTransferResponse is a bulk transfer with the number of items in each
+// status.
+type bulkTransferResponse struct {
+	repository.BulkTransfer
+	Summary map[string]int `json:"summary"`
+}
+
+func newBulkTransferResponse(bulk repository.BulkTransfer) bulkTransferResponse {
+	summary := map[string]int{}
+	for _, item := range bulk.Items {
+		summary[item.Status]++
+	}
+	return bulkTransferResponse{BulkTransfer: bulk, Summary: summary}
+}
+
+// CreateBulkTransferHandler accepts up to BULK_TRANSFER_MAX_ITEMS transfers out
+// of one account and queues them for execution. An Idempotency-Key is
+// required, so a retry can never pay twice: resubmitting with the same key
+// returns the original bulk transfer instead of a new one.
+func CreateBulkTransferHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+	cfg := appconfig.GetBulkTransferConfig()
+
+	var req struct {
+		FromAccountID string `json:"from_account_id"`
+		Transfers     []struct {
+			ToAccountID string `json:"to_account_id"`
+			Amount      int64  `json:"amount"`
+			Reference   string `json:"reference"`
+		} `json:"transfers"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Transfers) == 0 || len(req.Transfers) > cfg.MaxItems {
+		http.Error(w, fmt.Sprintf("Transfers must contain between 1 and %d items", cfg.MaxItems), http.StatusBadRequest)
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		http.Error(w, "Idempotency-Key header is required", http.StatusBadRequest)
+		return
+	}
+	if len(key) > 255 {
+		http.Error(w, "Idempotency-Key cannot exceed 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	fromAccount, err := repository.GetAccountByID(r.Context(), req.FromAccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Sender account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load sender account", http.StatusInternalServerError)
+		return
+	}
+
+	if fromAccount.UserID != claims.UserID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Keys are scoped to the user, so the ID is derived from both.
+	sum := sha256.Sum256([]byte(claims.UserID + "\x00" + key))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	bulk := repository.BulkTransfer{
+		ID:             "bulk_" + hex.EncodeToString(sum[:16]),
+		UserID:         claims.UserID,
+		FromAccountID:  fromAccount.ID,
+		IdempotencyKey: key,
+		Status:         repository.BulkStatusPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	for i, transfer := range req.Transfers {
+		switch {
+		case transfer.ToAccountID == "":
+			http.Error(w, fmt.Sprintf("Transfer %d has no to_account_id", i), http.StatusBadRequest)
+			return
+		case transfer.ToAccountID == fromAccount.ID:
+			http.Error(w, fmt.Sprintf("Transfer %d is a self-transfer", i), http.StatusBadRequest)
+			return
+		case transfer.Amount <= 0:
+			http.Error(w, fmt.Sprintf("Transfer %d has an invalid amount", i), http.StatusBadRequest)
+			return
+		case len(transfer.Reference) > 140:
+			http.Error(w, fmt.Sprintf("Transfer %d reference cannot exceed 140 characters", i), http.StatusBadRequest)
+			return
+		}
+
+		bulk.Items = append(bulk.Items, repository.BulkTransferItem{
+			ToAccountID: transfer.ToAccountID,
+			Amount:      transfer.Amount,
+			Reference:   strings.TrimSpace(transfer.Reference),
+			Status:      repository.BulkItemPending,
+		})
+	}
+
+	services.AuditAction(r.Context(), "transfer.bulk", "bulk_transfer", bulk.ID)
+
+	err = repository.CreateBulkTransfer(r.Context(), bulk)
+	if errors.Is(err, repository.ErrBulkTransferExists) {
+		existing, getErr := repository.GetBulkTransferByID(r.Context(), bulk.ID)
+		if getErr != nil {
+			http.Error(w, "Failed to load bulk transfer", http.StatusInternalServerError)
+			return
+		}
+
+		if !sameBulkRequest(existing, bulk) {
+			http.Error(w, "Idempotency-Key was already used for a different request", http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newBulkTransferResponse(existing))
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create bulk transfer", http.StatusInternalServerError)
+		return
+	}
+
+	services.AuditSnapshot(r.Context(), nil, bulk)
+	services.NotifyBulkTransfer()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(newBulkTransferResponse(bulk))
+}
+
+// sameBulkRequest reports whether a retried submission asks for the same
+// transfers as the one already stored.
+func sameBulkRequest(existing, retry repository.BulkTransfer) bool {
+	return existing.FromAccountID == retry.FromAccountID &&
+		slices.EqualFunc(existing.Items, retry.Items, func(a, b repository.BulkTransferItem) bool {
+			return a.ToAccountID == b.ToAccountID && a.Amount == b.Amount && a.Reference == b.Reference
+		})
+}
+
+// GetBulkTransferHandler serves GET /transfers/bulk/{id}, reporting the status
+// of each item.
+func GetBulkTransferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+	bulkID := strings.TrimPrefix(r.URL.Path, "/transfers/bulk/")
+
+	bulk, err := repository.GetBulkTransferByID(r.Context(), bulkID)
+	if err != nil {
+		if errors.Is(err, repository.ErrBulkTransferNotFound) {
+			http.Error(w, "Bulk transfer not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load bulk transfer", http.StatusInternalServerError)
+		return
+	}
+
+	if bulk.UserID != claims.UserID {
+		http.Error(w, "Bulk transfer not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newBulkTransferResponse(bulk))
+}
+
+func BulkTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreateBulkTransferHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag serves a resource version as its entity tag.
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// checkIfMatch requires the If-Match header of a write to name the current
+// version of the resource, answering 428 when it is missing and 412 when it
+// is stale. The repository re-checks the version when writing, so a change
+// made after this check still fails with ErrVersionConflict.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current int64) bool {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		http.Error(w, "If-Match header required", http.StatusPreconditionRequired)
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == strconv.Quote(strconv.FormatInt(current, 10)) {
+			return true
+		}
+	}
+
+	writeVersionConflict(w)
+	return false
+}
+
+func writeVersionConflict(w http.ResponseWriter) {
+	http.Error(w, "Resource has been modified", http.StatusPreconditionFailed)
+}
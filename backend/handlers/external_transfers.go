@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const maxWebhookBodyBytes = 64 << 10
+
+// ExternalTransfersHandler lists the caller's deposits and withdrawals.
+func ExternalTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	transfers, err := repository.GetExternalTransfersByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch external transfers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&transfers)
+}
+
+// ExternalTransferHandler returns one of the caller's deposits or withdrawals.
+func ExternalTransferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	transferID := strings.TrimPrefix(r.URL.Path, "/external-transfers/")
+	if transferID == "" {
+		http.Error(w, "Transfer ID required", http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := repository.GetExternalTransferByID(r.Context(), transferID)
+	if err != nil || transfer.UserID != claims.UserID {
+		if err == nil || errors.Is(err, repository.ErrExternalTransferNotFound) {
+			http.Error(w, "External transfer not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load external transfer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&transfer)
+}
+
+// RailWebhookHandler receives settlement and failure callbacks from the payment
+// rail. The body must be signed with the shared secret in X-Rail-Signature.
+func RailWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.VerifyRailSignature(body, r.Header.Get("X-Rail-Signature")); err != nil {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event services.RailEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.HandleRailEvent(r.Context(), event); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrExternalTransferNotFound):
+			http.Error(w, "External transfer not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidRailEvent):
+			http.Error(w, "Status must be settled or failed", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrExternalTransferClosed):
+			http.Error(w, "External transfer is no longer pending", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to apply event", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Event applied",
+	})
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	appconfig "banking-ecommerce-api/config"
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func CreateHoldHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+	cfg := appconfig.GetHoldConfig()
+
+	var req struct {
+		AccountID        string `json:"account_id"`
+		PayeeAccountID   string `json:"payee_account_id"`
+		Amount           int64  `json:"amount"`
+		Description      string `json:"description"`
+		ExpiresInMinutes int    `json:"expires_in_minutes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Description) > 140 {
+		http.Error(w, "Description cannot exceed 140 characters", http.StatusBadRequest)
+		return
+	}
+
+	ttl := cfg.DefaultTTL
+	if req.ExpiresInMinutes != 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+
+	if ttl <= 0 || ttl > cfg.MaxTTL {
+		http.Error(w, "Expiry must be positive and at most "+cfg.MaxTTL.String(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := repository.GetAccountByID(r.Context(), req.AccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
+		return
+	}
+
+	if account.UserID != claims.UserID {
+		http.Error(w, "Account id doesn't belong to current user", http.StatusForbidden)
+		return
+	}
+
+	if req.PayeeAccountID == "" {
+		http.Error(w, "Payee account is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.PayeeAccountID == account.ID {
+		http.Error(w, "Payee must be a different account", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := repository.GetAccountByID(r.Context(), req.PayeeAccountID); err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Payee account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load payee account", http.StatusInternalServerError)
+		return
+	}
+
+	if account.AvailableBalance() < req.Amount {
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	hold := repository.Hold{
+		ID:             utils.GenerateID("hold"),
+		AccountID:      account.ID,
+		UserID:         account.UserID,
+		PayeeAccountID: req.PayeeAccountID,
+		Amount:         req.Amount,
+		Description:    req.Description,
+		Status:         repository.HoldStatusActive,
+		ExpiresAt:      now.Add(ttl),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if err := repository.PlaceHold(r.Context(), hold, account); err != nil {
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			http.Error(w, "Insufficient balance", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to place hold", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&hold)
+}
+
+// GetHoldsHandler lists the holds on one of the caller's accounts, given as
+// ?account_id=.
+func GetHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	account, err := repository.GetAccountByID(r.Context(), r.URL.Query().Get("account_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
+		return
+	}
+
+	if account.UserID != claims.UserID {
+		http.Error(w, "Account id doesn't belong to current user", http.StatusForbidden)
+		return
+	}
+
+	holds, err := repository.GetHoldsByAccountID(r.Context(), account.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch holds", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&holds)
+}
+
+func HoldsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreateHoldHandler(w, r)
+	case http.MethodGet:
+		GetHoldsHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HoldHandler serves /holds/{id} and the /{id}/release action. Captures pay
+// the hold's payee, so only an admin can make them, at
+// /admin/holds/{id}/capture.
+func HoldHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	holdID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/holds/"), "/")
+	if holdID == "" {
+		http.Error(w, "Hold ID required", http.StatusBadRequest)
+		return
+	}
+
+	hold, err := repository.GetHoldByID(r.Context(), holdID)
+	if err != nil || hold.UserID != claims.UserID {
+		if err == nil || errors.Is(err, repository.ErrHoldNotFound) {
+			http.Error(w, "Hold not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load hold", http.StatusInternalServerError)
+		return
+	}
+
+	expireHold(r, &hold, time.Now())
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&hold)
+	case r.Method == http.MethodPost && action == "release":
+		releaseHold(w, r, hold)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AdminHoldHandler serves /admin/holds/{id}/capture, which moves all of the
+// hold, or a smaller amount given in the body, to its payee and releases the
+// rest.
+func AdminHoldHandler(w http.ResponseWriter, r *http.Request) {
+	holdID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/holds/"), "/")
+	if holdID == "" || action != "capture" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hold, err := repository.GetHoldByID(r.Context(), holdID)
+	if err != nil {
+		if errors.Is(err, repository.ErrHoldNotFound) {
+			http.Error(w, "Hold not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load hold", http.StatusInternalServerError)
+		return
+	}
+
+	expireHold(r, &hold, time.Now())
+	captureHold(w, r, hold)
+}
+
+func captureHold(w http.ResponseWriter, r *http.Request, hold repository.Hold) {
+	var req struct {
+		Amount int64 `json:"amount"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Amount == 0 {
+		req.Amount = hold.Amount
+	}
+
+	if req.Amount < 0 || req.Amount > hold.Amount {
+		http.Error(w, "Capture amount must be between 1 and the held amount", http.StatusBadRequest)
+		return
+	}
+
+	if hold.Status != repository.HoldStatusActive {
+		http.Error(w, "Hold is "+hold.Status, http.StatusConflict)
+		return
+	}
+
+	before := hold
+	now := time.Now()
+	hold.Status = repository.HoldStatusCaptured
+	hold.CapturedAmount = req.Amount
+	hold.UpdatedAt = now
+
+	services.AuditAction(r.Context(), "hold.capture", "hold", hold.ID)
+	services.AuditSnapshot(r.Context(), before, hold)
+
+	if err := repository.CaptureHold(r.Context(), before, req.Amount, now); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrHoldClosed):
+			http.Error(w, "Hold is no longer active", http.StatusConflict)
+		case errors.Is(err, repository.ErrHoldNoPayee):
+			http.Error(w, "Hold has no payee and can only be released", http.StatusConflict)
+		case errors.Is(err, repository.ErrAccountNotFound):
+			http.Error(w, "Payee account doesn't exist", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to capture hold", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&hold)
+}
+
+func releaseHold(w http.ResponseWriter, r *http.Request, hold repository.Hold) {
+	if hold.Status != repository.HoldStatusActive {
+		http.Error(w, "Hold is "+hold.Status, http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	if err := repository.ReleaseHold(r.Context(), hold, repository.HoldStatusReleased, now); err != nil {
+		if errors.Is(err, repository.ErrHoldClosed) {
+			http.Error(w, "Hold is no longer active", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to release hold", http.StatusInternalServerError)
+		return
+	}
+
+	hold.Status = repository.HoldStatusReleased
+	hold.UpdatedAt = now
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&hold)
+}
+
+// expireHold releases an active hold whose expiry has passed, so it cannot be
+// captured while the expiry job has yet to reach it.
+func expireHold(r *http.Request, hold *repository.Hold, now time.Time) {
+	if hold.Status != repository.HoldStatusActive || now.Before(hold.ExpiresAt) {
+		return
+	}
+
+	if err := repository.ReleaseHold(r.Context(), *hold, repository.HoldStatusExpired, now); err != nil {
+		return
+	}
+	hold.Status = repository.HoldStatusExpired
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AdjustInventoryHandler serves POST /products/{id}/inventory-adjustments,
+// applying a signed stock delta for a restock, damage, correction or refund.
+// Restocks and refunds must add stock and damage must remove it. A product
+// with variants is adjusted one SKU at a time.
+func AdjustInventoryHandler(w http.ResponseWriter, r *http.Request, productID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		Type  string `json:"type"`
+		SKU   string `json:"sku"`
+		Delta int    `json:"delta"`
+		Note  string `json:"note"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Type {
+	case repository.MovementRestock, repository.MovementRefund:
+		if req.Delta <= 0 {
+			http.Error(w, "Delta must be positive for a "+req.Type, http.StatusBadRequest)
+			return
+		}
+	case repository.MovementDamage:
+		if req.Delta >= 0 {
+			http.Error(w, "Delta must be negative for damage", http.StatusBadRequest)
+			return
+		}
+	case repository.MovementCorrection:
+		if req.Delta == 0 {
+			http.Error(w, "Delta must not be zero", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Type must be restock, damage, correction or refund", http.StatusBadRequest)
+		return
+	}
+
+	product, err := repository.GetProductByID(r.Context(), productID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	if err := product.CheckVariant(req.SKU); err != nil {
+		writeVariantError(w, err)
+		return
+	}
+
+	movement := repository.InventoryMovement{
+		ID:        utils.GenerateID("stock"),
+		ProductID: product.ID,
+		SKU:       req.SKU,
+		Type:      req.Type,
+		Delta:     req.Delta,
+		Note:      req.Note,
+		ActorID:   claims.UserID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	services.AuditAction(r.Context(), "product.adjust_stock", "product", product.ID)
+	services.AuditSnapshot(r.Context(), nil, movement)
+
+	if err := repository.AdjustStock(r.Context(), product, movement); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrProductOutOfStock):
+			http.Error(w, "Stock cannot go below the reserved quantity", http.StatusConflict)
+		case errors.Is(err, repository.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case writeVariantError(w, err):
+		default:
+			http.Error(w, "Failed to adjust stock", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&movement)
+}
+
+// InventoryHistoryHandler serves GET /products/{id}/inventory-history, the
+// product's stock movements, newest first.
+func InventoryHistoryHandler(w http.ResponseWriter, r *http.Request, productID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := repository.GetProductByID(r.Context(), productID); err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	movements, err := repository.GetInventoryMovements(r.Context(), productID)
+	if err != nil {
+		http.Error(w, "Failed to fetch inventory history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&movements)
+}
+
+// InventoryHandler serves GET /admin/inventory, listing each product's stock
+// on hand, reserved and available, and that of each of its variants.
+func InventoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	products, err := repository.GetAllProducts(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		return
+	}
+
+	type variantLevel struct {
+		SKU       string `json:"sku"`
+		OnHand    int    `json:"on_hand"`
+		Reserved  int    `json:"reserved"`
+		Available int    `json:"available"`
+	}
+
+	type stockLevel struct {
+		ProductID string         `json:"product_id"`
+		Name      string         `json:"name"`
+		OnHand    int            `json:"on_hand"`
+		Reserved  int            `json:"reserved"`
+		Available int            `json:"available"`
+		Archived  bool           `json:"archived"`
+		Variants  []variantLevel `json:"variants,omitempty"`
+	}
+
+	levels := make([]stockLevel, 0, len(products))
+	for _, product := range products {
+		level := stockLevel{
+			ProductID: product.ID,
+			Name:      product.Name,
+			OnHand:    product.Stock,
+			Reserved:  product.Reserved,
+			Available: product.AvailableStock(),
+			Archived:  product.Archived(),
+		}
+
+		for _, variant := range product.Variants {
+			level.Variants = append(level.Variants, variantLevel{
+				SKU:       variant.SKU,
+				OnHand:    variant.Stock,
+				Reserved:  variant.Reserved,
+				Available: variant.AvailableStock(),
+			})
+		}
+		sort.Slice(level.Variants, func(i, j int) bool { return level.Variants[i].SKU < level.Variants[j].SKU })
+
+		levels = append(levels, level)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&levels)
+}
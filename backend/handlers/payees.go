@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func CreatePayeeHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		Recipient string `json:"recipient"`
+		Nickname  string `json:"nickname"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Nickname) > 50 {
+		http.Error(w, "Nickname cannot exceed 50 characters", http.StatusBadRequest)
+		return
+	}
+
+	if req.Recipient == "" {
+		http.Error(w, "Recipient required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := services.LookupRecipient(r.Context(), req.Recipient)
+	if err != nil {
+		writeRecipientError(w, err)
+		return
+	}
+
+	if user.ID == claims.UserID {
+		http.Error(w, "Cannot add yourself as a payee", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := repository.GetPayeesByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch payees", http.StatusInternalServerError)
+		return
+	}
+
+	for _, payee := range existing {
+		if payee.PayeeUserID == user.ID {
+			http.Error(w, "Payee already saved", http.StatusConflict)
+			return
+		}
+	}
+
+	payee := repository.Payee{
+		ID:          utils.GenerateID("payee"),
+		UserID:      claims.UserID,
+		PayeeUserID: user.ID,
+		Nickname:    req.Nickname,
+		MaskedName:  services.MaskName(user.FullName),
+		CreatedAt:   time.Now(),
+	}
+	if payee.Nickname == "" {
+		payee.Nickname = payee.MaskedName
+	}
+
+	if err := repository.CreatePayee(r.Context(), payee); err != nil {
+		http.Error(w, "Failed to save payee", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&payee)
+}
+
+func GetPayeesHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	payees, err := repository.GetPayeesByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch payees", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&payees)
+}
+
+func PayeesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreatePayeeHandler(w, r)
+	case http.MethodGet:
+		GetPayeesHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func DeletePayeeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	payeeID := strings.TrimPrefix(r.URL.Path, "/payees/")
+	if payeeID == "" {
+		http.Error(w, "Payee ID required", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.DeletePayee(r.Context(), claims.UserID, payeeID); err != nil {
+		if errors.Is(err, repository.ErrPayeeNotFound) {
+			http.Error(w, "Payee not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete payee", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Payee deleted successfully",
+	})
+}
+
+// SetDefaultAccountHandler designates which of the caller's accounts receives
+// transfers addressed to them by username or email.
+func SetDefaultAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	user, err := repository.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkIfMatch(w, r, user.Version) {
+		return
+	}
+
+	var req struct {
+		AccountID string `json:"account_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	account, err := repository.GetAccountByID(r.Context(), req.AccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
+		return
+	}
+
+	if account.UserID != claims.UserID {
+		http.Error(w, "Account id doesn't belong to current user", http.StatusForbidden)
+		return
+	}
+
+	if err := repository.SetDefaultAccount(r.Context(), claims.UserID, account.ID, user.Version); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVersionConflict):
+			writeVersionConflict(w)
+		default:
+			http.Error(w, "Failed to set default account", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setETag(w, user.Version+1)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":            "Default account updated",
+		"default_account_id": account.ID,
+	})
+}
+
+// TransferPreviewHandler resolves a recipient without moving any money so the
+// sender can confirm the masked name before submitting the transfer.
+func TransferPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		FromAccountID string `json:"from_account_id"`
+		Recipient     string `json:"recipient"`
+		PayeeID       string `json:"payee_id"`
+		Amount        int64  `json:"amount"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	fromAccount, err := repository.GetAccountByID(r.Context(), req.FromAccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Sender account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load sender account", http.StatusInternalServerError)
+		return
+	}
+
+	if fromAccount.UserID != claims.UserID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	user, toAccount, ok := resolveRecipient(w, r, req.Recipient, req.PayeeID)
+	if !ok {
+		return
+	}
+
+	if fromAccount.ID == toAccount.ID {
+		http.Error(w, "Self-transfer is not allowed", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from_account_id":    fromAccount.ID,
+		"recipient_name":     services.MaskName(user.FullName),
+		"recipient_username": user.Username,
+		"amount":             req.Amount,
+		"sufficient_balance": fromAccount.AvailableBalance() >= req.Amount,
+	})
+}
+
+// resolveRecipient turns a username/email or a saved payee ID into the
+// recipient and their receiving account, writing the error response itself.
+func resolveRecipient(w http.ResponseWriter, r *http.Request, recipient, payeeID string) (repository.User, repository.Account, bool) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	if payeeID != "" {
+		payee, err := repository.GetPayeeByID(r.Context(), payeeID)
+		if err != nil || payee.UserID != claims.UserID {
+			if err == nil || errors.Is(err, repository.ErrPayeeNotFound) {
+				http.Error(w, "Payee not found", http.StatusNotFound)
+				return repository.User{}, repository.Account{}, false
+			}
+			http.Error(w, "Failed to load payee", http.StatusInternalServerError)
+			return repository.User{}, repository.Account{}, false
+		}
+
+		user, err := repository.GetUserByID(r.Context(), payee.PayeeUserID)
+		if err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				http.Error(w, "Recipient not found", http.StatusNotFound)
+				return repository.User{}, repository.Account{}, false
+			}
+			http.Error(w, "Failed to load recipient", http.StatusInternalServerError)
+			return repository.User{}, repository.Account{}, false
+		}
+
+		account, err := services.ReceivingAccount(r.Context(), user)
+		if err != nil {
+			writeRecipientError(w, err)
+			return repository.User{}, repository.Account{}, false
+		}
+		return user, account, true
+	}
+
+	if recipient == "" {
+		http.Error(w, "Recipient required", http.StatusBadRequest)
+		return repository.User{}, repository.Account{}, false
+	}
+
+	user, account, err := services.ResolveRecipient(r.Context(), recipient)
+	if err != nil {
+		writeRecipientError(w, err)
+		return repository.User{}, repository.Account{}, false
+	}
+
+	return user, account, true
+}
+
+func writeRecipientError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrRecipientNotFound):
+		http.Error(w, "Recipient not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrNoReceivingAccount):
+		http.Error(w, "Recipient has no default receiving account", http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, "Failed to resolve recipient", http.StatusInternalServerError)
+	}
+}
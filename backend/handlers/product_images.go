@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ProductImagesHandler serves /products/{id}/images: POST uploads a JPEG or
+// PNG as the multipart field "image", and DELETE /products/{id}/images/{imageID}
+// removes one.
+func ProductImagesHandler(w http.ResponseWriter, r *http.Request, productID, imageID string) {
+	switch {
+	case r.Method == http.MethodPost && imageID == "":
+		UploadProductImageHandler(w, r, productID)
+	case r.Method == http.MethodDelete && imageID != "":
+		DeleteProductImageHandler(w, r, productID, imageID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func UploadProductImageHandler(w http.ResponseWriter, r *http.Request, productID string) {
+	maxBytes := int64(services.MediaMaxBytes())
+
+	// Leave room for the multipart framing around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Image is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Multipart field image is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read image", http.StatusBadRequest)
+		return
+	}
+
+	product, err := repository.GetProductByID(r.Context(), productID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	image, err := services.AddProductImage(r.Context(), product.ID, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImageTooLarge):
+			http.Error(w, "Image is too large", http.StatusRequestEntityTooLarge)
+		case errors.Is(err, services.ErrUnsupportedImageType):
+			http.Error(w, "Image must be a JPEG or PNG", http.StatusUnsupportedMediaType)
+		case errors.Is(err, services.ErrInvalidImage):
+			http.Error(w, "Image could not be read", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrTooManyProductImages):
+			http.Error(w, "Product already has the maximum number of images", http.StatusConflict)
+		case errors.Is(err, repository.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		default:
+			log.Printf("media: uploading image for %s: %v", product.ID, err)
+			http.Error(w, "Failed to store image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	after := product
+	after.Images = append(append([]repository.ProductImage(nil), product.Images...), image)
+	services.AuditAction(r.Context(), "product.image.add", "product", product.ID)
+	services.AuditSnapshot(r.Context(), product, after)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&image)
+}
+
+func DeleteProductImageHandler(w http.ResponseWriter, r *http.Request, productID, imageID string) {
+	product, err := repository.GetProductByID(r.Context(), productID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	after := product
+	after.Images = nil
+	for _, image := range product.Images {
+		if image.ID != imageID {
+			after.Images = append(after.Images, image)
+		}
+	}
+	services.AuditAction(r.Context(), "product.image.delete", "product", product.ID)
+	services.AuditSnapshot(r.Context(), product, after)
+
+	if err := services.DeleteProductImage(r.Context(), product, imageID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrProductImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVersionConflict):
+			http.Error(w, "Product images changed, try again", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Image deleted successfully",
+	})
+}
+
+// MediaHandler serves GET /media/{key} from the media store. Keys are never
+// reused, so responses can be cached indefinitely.
+func MediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/media/")
+	if !services.ValidBlobKey(key) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	blob, err := services.OpenMedia(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, services.ErrBlobNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("media: opening %s: %v", key, err)
+		http.Error(w, "Failed to load media", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("media: serving %s: %v", key, err)
+	}
+}
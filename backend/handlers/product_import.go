@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxProductImportBytes caps the size of an uploaded product file.
+const maxProductImportBytes = 5 << 20
+
+// ProductImportHandler serves POST /admin/products/import. The body is a CSV
+// file (text/csv) or a JSON array of products (application/json), upserted
+// by SKU. With ?dry_run=true the rows are only validated and the report says
+// what would change. An import with invalid rows writes nothing and is
+// answered 422 with the report.
+func ProductImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := http.MaxBytesReader(w, r.Body, maxProductImportBytes)
+
+	var rows []services.ProductImportRow
+	var err error
+	switch mediaType {
+	case "text/csv":
+		rows, err = services.ParseProductImportCSV(body)
+	case "application/json":
+		rows, err = services.ParseProductImportJSON(body)
+	default:
+		http.Error(w, "Content type must be text/csv or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid import file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !dryRun {
+		services.AuditAction(r.Context(), "product.import", "product_import", utils.GenerateID("import"))
+	}
+
+	report, err := services.ImportProducts(r.Context(), rows, dryRun)
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, services.ErrImportInvalid):
+		status = http.StatusUnprocessableEntity
+	case err != nil:
+		http.Error(w, "Failed to import products", http.StatusInternalServerError)
+		return
+	}
+
+	if !dryRun {
+		services.AuditSnapshot(r.Context(), nil, map[string]interface{}{
+			"rows":      len(rows),
+			"created":   report.Created,
+			"updated":   report.Updated,
+			"unchanged": report.Unchanged,
+			"invalid":   report.Invalid,
+			"failed":    report.Failed,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&report)
+}
+
+// ProductExportHandler serves GET /admin/products/export?format=csv|json,
+// the whole catalogue including archived products in the import formats.
+func ProductExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "Format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	products, err := repository.GetAllProducts(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "products-" + time.Now().UTC().Format("20060102") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		err = services.WriteProductsJSON(w, products)
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		err = services.WriteProductsCSV(w, products)
+	}
+	if err != nil {
+		log.Printf("product export: %v", err)
+	}
+}
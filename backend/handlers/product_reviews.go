@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxReviewTextLength bounds the text of a product review, in characters.
+const maxReviewTextLength = 2000
+
+// ProductReviewsHandler serves /products/{id}/reviews: GET lists the visible
+// reviews, newest first, and POST lets a buyer of the product review it.
+func ProductReviewsHandler(w http.ResponseWriter, r *http.Request, productID string) {
+	switch r.Method {
+	case http.MethodGet:
+		GetProductReviewsHandler(w, r, productID)
+	case http.MethodPost:
+		CreateProductReviewHandler(w, r, productID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func GetProductReviewsHandler(w http.ResponseWriter, r *http.Request, productID string) {
+	reviews, err := repository.GetProductReviews(r.Context(), productID)
+	if err != nil {
+		http.Error(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+
+	visible := []repository.ProductReview{}
+	for _, review := range reviews {
+		if !review.Hidden {
+			visible = append(visible, review)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+// CreateProductReviewHandler adds the caller's review of a product. Only
+// users whose purchase history includes the product may review it, and only
+// once.
+func CreateProductReviewHandler(w http.ResponseWriter, r *http.Request, productID string) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		Rating int    `json:"rating"`
+		Text   string `json:"text"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Rating < 1 || req.Rating > 5 {
+		http.Error(w, "Rating must be between 1 and 5", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Text) > maxReviewTextLength {
+		http.Error(w, "Review text cannot exceed 2000 characters", http.StatusBadRequest)
+		return
+	}
+
+	product, err := repository.GetProductByID(r.Context(), productID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	purchased, err := hasPurchased(r.Context(), claims.UserID, product.ID)
+	if err != nil {
+		http.Error(w, "Failed to check purchase history", http.StatusInternalServerError)
+		return
+	}
+	if !purchased {
+		http.Error(w, "Only buyers of this product can review it", http.StatusForbidden)
+		return
+	}
+
+	user, err := repository.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	review := repository.ProductReview{
+		ID:        repository.ProductReviewID(product.ID, claims.UserID),
+		ProductID: product.ID,
+		UserID:    claims.UserID,
+		Username:  user.Username,
+		Rating:    req.Rating,
+		Text:      req.Text,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	services.AuditAction(r.Context(), "product_review.create", "product_review", review.ID)
+	services.AuditSnapshot(r.Context(), nil, review)
+
+	if err := repository.CreateProductReview(r.Context(), review); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrProductReviewExists):
+			http.Error(w, "You have already reviewed this product", http.StatusConflict)
+		case errors.Is(err, repository.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to create review", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&review)
+}
+
+// hasPurchased reports whether the user's transactions include a purchase of
+// the product.
+func hasPurchased(ctx context.Context, userID, productID string) (bool, error) {
+	transactions, err := repository.GetTransactionsByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, txn := range transactions {
+		if txn.TransactionType == "purchase" && txn.ProductID == productID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetAdminProductReviewsHandler lists reviews for moderation, hidden ones
+// included, newest first. ?product_id= narrows them to one product and
+// ?hidden=true|false to one visibility.
+func GetAdminProductReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	var reviews []repository.ProductReview
+	var err error
+	if productID := r.URL.Query().Get("product_id"); productID != "" {
+		reviews, err = repository.GetProductReviews(r.Context(), productID)
+	} else {
+		reviews, err = repository.GetAllProductReviews(r.Context())
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+
+	hidden := r.URL.Query().Get("hidden")
+	if hidden != "" && hidden != "true" && hidden != "false" {
+		http.Error(w, "Hidden must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	filtered := []repository.ProductReview{}
+	for _, review := range reviews {
+		if hidden == "" || review.Hidden == (hidden == "true") {
+			filtered = append(filtered, review)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].CreatedAt.After(filtered[j].CreatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filtered)
+}
+
+func AdminProductReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	GetAdminProductReviewsHandler(w, r)
+}
+
+// AdminProductReviewHandler serves /admin/product-reviews/{id}: PATCH with
+// {"hidden": bool} hides or shows a review, and DELETE removes it. Either
+// keeps the product's rating in step.
+func AdminProductReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID := strings.TrimPrefix(r.URL.Path, "/admin/product-reviews/")
+	if reviewID == "" {
+		http.Error(w, "Review ID required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	review, err := repository.GetProductReviewByID(r.Context(), reviewID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductReviewNotFound) {
+			http.Error(w, "Review not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load review", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		services.AuditAction(r.Context(), "product_review.delete", "product_review", review.ID)
+		services.AuditSnapshot(r.Context(), review, nil)
+
+		if err := repository.DeleteProductReview(r.Context(), review); err != nil {
+			writeProductReviewError(w, err, "Failed to delete review")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Review deleted successfully",
+		})
+		return
+	}
+
+	var req struct {
+		Hidden *bool `json:"hidden"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hidden == nil {
+		http.Error(w, "hidden is required", http.StatusBadRequest)
+		return
+	}
+
+	before := review
+	now := time.Now().UTC()
+	if review.Hidden != *req.Hidden {
+		review.Hidden = *req.Hidden
+		review.UpdatedAt = now
+	}
+
+	action := "product_review.show"
+	if review.Hidden {
+		action = "product_review.hide"
+	}
+	services.AuditAction(r.Context(), action, "product_review", review.ID)
+	services.AuditSnapshot(r.Context(), before, review)
+
+	if err := repository.SetProductReviewHidden(r.Context(), before, *req.Hidden, now); err != nil {
+		writeProductReviewError(w, err, "Failed to update review")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&review)
+}
+
+// writeProductReviewError answers a failed moderation of a review.
+func writeProductReviewError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, repository.ErrProductReviewNotFound):
+		http.Error(w, "Review not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrVersionConflict):
+		http.Error(w, "Review was moderated meanwhile, reload and try again", http.StatusConflict)
+	case errors.Is(err, repository.ErrProductNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -2,20 +2,28 @@ package handlers
 
 import (
 	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
 	"banking-ecommerce-api/utils"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
 
+// CreateProductHandler adds a product. A product with variants takes its
+// stock per variant, and its total stock is their sum.
 func CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Price       int64  `json:"price"`
-		Stock       int    `json:"stock"`
+		SKU         string           `json:"sku"`
+		Name        string           `json:"name"`
+		Description string           `json:"description"`
+		Category    string           `json:"category"`
+		TaxClass    string           `json:"tax_class"`
+		Price       int64            `json:"price"`
+		Stock       int              `json:"stock"`
+		Variants    []variantRequest `json:"variants"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -23,20 +31,54 @@ func CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	variants, err := parseVariants(req.Variants)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(variants) > 0 {
+		if req.Stock != 0 {
+			http.Error(w, "Stock is set per variant", http.StatusBadRequest)
+			return
+		}
+		for _, variant := range variants {
+			req.Stock += variant.Stock
+		}
+	}
+
 	if req.Name == "" || req.Price <= 0 || req.Stock <= 0 {
 		http.Error(w, "All fields are required", http.StatusBadRequest)
 		return
 	}
 
+	req.TaxClass = services.NormalizeTaxClass(req.TaxClass)
+	if req.TaxClass != "" && !services.IsTaxClass(req.TaxClass) {
+		http.Error(w, "Unknown tax class", http.StatusBadRequest)
+		return
+	}
+
+	req.SKU = strings.TrimSpace(req.SKU)
+	if !checkProductSKU(w, r, req.SKU, "") {
+		return
+	}
+
 	product := repository.Product{
 		ID:          utils.GenerateUserID(),
+		SKU:         req.SKU,
 		Name:        req.Name,
 		Description: req.Description,
+		Category:    normalizeCategory(req.Category),
+		TaxClass:    req.TaxClass,
 		Price:       req.Price,
 		Stock:       req.Stock,
+		Variants:    variants,
 		CreatedAt:   time.Now(),
 	}
 
+	services.AuditAction(r.Context(), "product.create", "product", product.ID)
+	services.AuditSnapshot(r.Context(), nil, product)
+
 	if err := repository.CreateProduct(r.Context(), product); err != nil {
 		http.Error(w, "Failed to create product", http.StatusInternalServerError)
 		return
@@ -58,8 +100,32 @@ func GetProductsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	catalogue := []repository.Product{}
+	for _, product := range products {
+		if !product.Archived() {
+			catalogue = append(catalogue, product)
+		}
+	}
+
+	// ?sort=rating puts the best rated first, breaking ties by the number
+	// of reviews.
+	switch r.URL.Query().Get("sort") {
+	case "":
+	case "rating":
+		sort.SliceStable(catalogue, func(i, j int) bool {
+			a, b := catalogue[i], catalogue[j]
+			if a.AverageRating() != b.AverageRating() {
+				return a.AverageRating() > b.AverageRating()
+			}
+			return a.RatingCount > b.RatingCount
+		})
+	default:
+		http.Error(w, "Sort must be rating", http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
+	json.NewEncoder(w).Encode(catalogue)
 }
 
 func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -84,11 +150,19 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkIfMatch(w, r, product.Version) {
+		return
+	}
+
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Price       int64  `json:"price"`
-		Stock       int    `json:"stock"`
+		SKU         string            `json:"sku"`
+		Name        string            `json:"name"`
+		Description string            `json:"description"`
+		Category    string            `json:"category"`
+		TaxClass    string            `json:"tax_class"`
+		Price       int64             `json:"price"`
+		Stock       *int              `json:"stock"`
+		Variants    *[]variantRequest `json:"variants"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -96,25 +170,81 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Name == "" || req.Price <= 0 || req.Stock < 0 {
+	if req.Stock != nil {
+		http.Error(w, "Stock is changed through inventory adjustments", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" || req.Price <= 0 {
 		http.Error(w, "Invalid product data", http.StatusBadRequest)
 		return
 	}
 
+	req.TaxClass = services.NormalizeTaxClass(req.TaxClass)
+	if req.TaxClass != "" && !services.IsTaxClass(req.TaxClass) {
+		http.Error(w, "Unknown tax class", http.StatusBadRequest)
+		return
+	}
+
+	req.SKU = strings.TrimSpace(req.SKU)
+	if req.SKU != product.SKU && !checkProductSKU(w, r, req.SKU, product.ID) {
+		return
+	}
+
+	before := product
+	product.SKU = req.SKU
 	product.Name = req.Name
 	product.Description = req.Description
+	product.Category = normalizeCategory(req.Category)
+	product.TaxClass = req.TaxClass
 	product.Price = req.Price
-	product.Stock = req.Stock
 
-	if err := repository.UpdateProduct(r.Context(), product); err != nil {
-		if errors.Is(err, repository.ErrProductNotFound) {
-			http.Error(w, "Product not found", http.StatusNotFound)
+	// Variants are replaced only when sent. Kept variants keep their stock,
+	// new ones start empty and removed ones must be empty already.
+	if req.Variants != nil {
+		variants, err := parseVariants(*req.Variants)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+
+		for _, variant := range variants {
+			if variant.Stock != 0 {
+				http.Error(w, "Stock is changed through inventory adjustments", http.StatusBadRequest)
+				return
+			}
+		}
+
+		product.Variants, err = before.MergeVariants(variants)
+		switch {
+		case errors.Is(err, repository.ErrVariantInUse):
+			http.Error(w, "A removed variant still has stock", http.StatusConflict)
+			return
+		case errors.Is(err, repository.ErrProductHasStock):
+			http.Error(w, "Product stock must be zero before adding variants", http.StatusConflict)
+			return
+		}
+	}
+
+	services.AuditAction(r.Context(), "product.update", "product", product.ID)
+	services.AuditSnapshot(r.Context(), before, product)
+
+	if err := repository.UpdateProduct(r.Context(), before, product); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVariantInUse):
+			http.Error(w, "A removed variant still has stock", http.StatusConflict)
+		case errors.Is(err, repository.ErrVersionConflict):
+			writeVersionConflict(w)
+		default:
+			http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		}
 		return
 	}
+	product.Version++
 
+	setETag(w, product.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(&product)
 }
@@ -131,6 +261,29 @@ func ProductsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/products/"), "/")
+
+	switch {
+	case action == "inventory-history":
+		InventoryHistoryHandler(w, r, productID)
+		return
+	case action == "inventory-adjustments":
+		AdjustInventoryHandler(w, r, productID)
+		return
+	case action == "restore":
+		RestoreProductHandler(w, r, productID)
+		return
+	case action == "reviews":
+		ProductReviewsHandler(w, r, productID)
+		return
+	case action == "images" || strings.HasPrefix(action, "images/"):
+		ProductImagesHandler(w, r, productID, strings.TrimPrefix(strings.TrimPrefix(action, "images"), "/"))
+		return
+	case action != "":
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		GetSingleProductHandler(w, r)
@@ -160,10 +313,13 @@ func GetSingleProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, product.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(&product)
 }
 
+// DeleteProductHandler archives a product rather than deleting it, so
+// purchases keep pointing at it.
 func DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Invalid method", http.StatusBadRequest)
@@ -176,17 +332,100 @@ func DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := repository.DeleteProduct(r.Context(), productID); err != nil {
+	services.AuditAction(r.Context(), "product.archive", "product", productID)
+	if product, err := repository.GetProductByID(r.Context(), productID); err == nil {
+		after := product
+		if !after.Archived() {
+			now := time.Now().UTC()
+			after.ArchivedAt = &now
+		}
+		services.AuditSnapshot(r.Context(), product, after)
+	}
+
+	if err := repository.ArchiveProduct(r.Context(), productID, time.Now()); err != nil {
 		if errors.Is(err, repository.ErrProductNotFound) {
 			http.Error(w, "Product not found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Failed to delete product", http.StatusInternalServerError)
+		http.Error(w, "Failed to archive product", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Product deleted successfully",
+		"message": "Product archived successfully",
 	})
 }
+
+// RestoreProductHandler serves POST /products/{id}/restore, putting an
+// archived product back in the catalogue.
+func RestoreProductHandler(w http.ResponseWriter, r *http.Request, productID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, err := repository.GetProductByID(r.Context(), productID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	if !product.Archived() {
+		http.Error(w, "Product is not archived", http.StatusConflict)
+		return
+	}
+
+	before := product
+	product.ArchivedAt = nil
+
+	services.AuditAction(r.Context(), "product.restore", "product", product.ID)
+	services.AuditSnapshot(r.Context(), before, product)
+
+	if err := repository.RestoreProduct(r.Context(), product.ID); err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to restore product", http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, product.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&product)
+}
+
+// normalizeCategory lowercases a category so promotions match it regardless
+// of how it was typed.
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// checkProductSKU validates an optional product SKU and that no other product
+// has it, writing the error response if not.
+func checkProductSKU(w http.ResponseWriter, r *http.Request, sku, productID string) bool {
+	if sku == "" {
+		return true
+	}
+
+	if !repository.ValidSKU(sku) {
+		http.Error(w, "SKU must be 1-64 letters, digits, '.', '-' or '_'", http.StatusBadRequest)
+		return false
+	}
+
+	existing, err := repository.GetProductBySKU(r.Context(), sku)
+	switch {
+	case err == nil && existing.ID != productID:
+		http.Error(w, "SKU already belongs to another product", http.StatusConflict)
+		return false
+	case err != nil && !errors.Is(err, repository.ErrProductNotFound):
+		http.Error(w, "Failed to check SKU", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var promotionCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// normalizeCode uppercases a promotion code so buyers can type it in any case.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CreatePromotionHandler lets an admin add a discount code, or an automatic
+// rule when no code is given.
+func CreatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code         string     `json:"code"`
+		Name         string     `json:"name"`
+		Type         string     `json:"type"`
+		Value        int64      `json:"value"`
+		Category     string     `json:"category"`
+		MinSpend     int64      `json:"min_spend"`
+		MaxUses      int        `json:"max_uses"`
+		PerUserLimit int        `json:"per_user_limit"`
+		StartsAt     *time.Time `json:"starts_at"`
+		EndsAt       *time.Time `json:"ends_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req.Code = normalizeCode(req.Code)
+	if req.Code != "" && !promotionCodePattern.MatchString(req.Code) {
+		http.Error(w, "Code must be 3-32 letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" || len(req.Name) > 100 {
+		http.Error(w, "Name is required and cannot exceed 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Type {
+	case repository.PromotionPercent:
+		if req.Value <= 0 || req.Value > 100 {
+			http.Error(w, "Percent value must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	case repository.PromotionFixed:
+		if req.Value <= 0 {
+			http.Error(w, "Invalid value", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Type must be percent or fixed", http.StatusBadRequest)
+		return
+	}
+
+	if req.MinSpend < 0 || req.MaxUses < 0 || req.PerUserLimit < 0 {
+		http.Error(w, "Limits cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		http.Error(w, "ends_at must be after starts_at", http.StatusBadRequest)
+		return
+	}
+
+	if req.Code != "" {
+		_, err := repository.GetPromotionByCode(r.Context(), req.Code)
+		switch {
+		case err == nil:
+			http.Error(w, "Promotion code already exists", http.StatusConflict)
+			return
+		case !errors.Is(err, repository.ErrPromotionNotFound):
+			http.Error(w, "Failed to check promotion code", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	promotion := repository.Promotion{
+		ID:           utils.GenerateID("promo"),
+		Code:         req.Code,
+		Name:         strings.TrimSpace(req.Name),
+		Type:         req.Type,
+		Value:        req.Value,
+		Category:     normalizeCategory(req.Category),
+		MinSpend:     req.MinSpend,
+		MaxUses:      req.MaxUses,
+		PerUserLimit: req.PerUserLimit,
+		Active:       true,
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+		CreatedAt:    time.Now(),
+	}
+
+	services.AuditAction(r.Context(), "promotion.create", "promotion", promotion.ID)
+	services.AuditSnapshot(r.Context(), nil, promotion)
+
+	if err := repository.CreatePromotion(r.Context(), promotion); err != nil {
+		http.Error(w, "Failed to create promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&promotion)
+}
+
+func GetPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	promotions, err := repository.GetPromotions(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch promotions", http.StatusInternalServerError)
+		return
+	}
+
+	if promotions == nil {
+		promotions = []repository.Promotion{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&promotions)
+}
+
+func PromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreatePromotionHandler(w, r)
+	case http.MethodGet:
+		GetPromotionsHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PromotionHandler serves /admin/promotions/{id}. DELETE ends the promotion;
+// it stays listed with its usage.
+func PromotionHandler(w http.ResponseWriter, r *http.Request) {
+	promotionID := strings.TrimPrefix(r.URL.Path, "/admin/promotions/")
+	if promotionID == "" {
+		http.Error(w, "Promotion ID required", http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := repository.GetPromotionByID(r.Context(), promotionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrPromotionNotFound) {
+			http.Error(w, "Promotion not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load promotion", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&promotion)
+	case http.MethodDelete:
+		before := promotion
+		promotion.Active = false
+
+		services.AuditAction(r.Context(), "promotion.end", "promotion", promotion.ID)
+		services.AuditSnapshot(r.Context(), before, promotion)
+
+		if err := repository.EndPromotion(r.Context(), promotion.ID); err != nil {
+			if errors.Is(err, repository.ErrPromotionNotFound) {
+				http.Error(w, "Promotion not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to end promotion", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&promotion)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writePromotionError reports why a promotion could not be applied, returning
+// false if err is not a promotion error.
+func writePromotionError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrPromotionNotFound):
+		http.Error(w, "Promotion code not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrPromotionInactive):
+		http.Error(w, "Promotion is not active", http.StatusBadRequest)
+	case errors.Is(err, repository.ErrPromotionNotApplicable):
+		http.Error(w, "Promotion does not apply to this purchase", http.StatusBadRequest)
+	case errors.Is(err, repository.ErrPromotionExhausted):
+		http.Error(w, "Promotion usage limit reached", http.StatusConflict)
+	case errors.Is(err, repository.ErrPromotionUserLimit):
+		http.Error(w, "Promotion already used the maximum number of times", http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
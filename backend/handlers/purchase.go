@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 )
 
 func PurchaseProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,7 +19,9 @@ func PurchaseProductHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		AccountID string `json:"account_id"`
 		ProductID string `json:"product_id"`
+		SKU       string `json:"sku"`
 		Quantity  int    `json:"quantity"`
+		Code      string `json:"promotion_code"`
 	}
 
 	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
@@ -32,6 +35,7 @@ func PurchaseProductHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid quantity", http.StatusBadRequest)
 		return
 	}
+	req.Code = normalizeCode(req.Code)
 
 	account, err := repository.GetAccountByID(r.Context(), req.AccountID)
 	if err != nil {
@@ -48,7 +52,97 @@ func PurchaseProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := repository.PurchaseProduct(r.Context(), req.AccountID, req.ProductID, req.Quantity); err != nil {
+	product, err := repository.GetProductByID(r.Context(), req.ProductID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	if product.Archived() {
+		http.Error(w, "Product is no longer available", http.StatusConflict)
+		return
+	}
+
+	if err := product.CheckVariant(req.SKU); err != nil {
+		writeVariantError(w, err)
+		return
+	}
+	subtotal := product.UnitPrice(req.SKU) * int64(req.Quantity)
+
+	promotion, discount, err := repository.BestPromotion(r.Context(), product, claims.UserID, subtotal, req.Code, time.Now())
+	if err != nil {
+		if !writePromotionError(w, err) {
+			http.Error(w, "Failed to apply promotion", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rate, ok := purchaseTaxRate(w, r, product)
+	if !ok {
+		return
+	}
+	tax := rate.Apply(subtotal - discount)
+	amount := tax.Gross()
+
+	services.AuditAction(r.Context(), "product.purchase", "product", req.ProductID)
+
+	assessment, ok := assessRisk(w, r, services.RiskOperation{
+		Kind:      services.RiskKindPurchase,
+		UserID:    claims.UserID,
+		AccountID: account.ID,
+		ProductID: product.ID,
+		Amount:    amount,
+	})
+	services.AuditSnapshot(r.Context(), nil, map[string]interface{}{
+		"account_id":         req.AccountID,
+		"product_id":         req.ProductID,
+		"sku":                req.SKU,
+		"quantity":           req.Quantity,
+		"promotion_code":     req.Code,
+		"discount":           discount,
+		"tax_amount":         tax.Tax,
+		"risk_assessment_id": assessment.ID,
+		"risk_decision":      assessment.Decision,
+	})
+	if !ok {
+		return
+	}
+
+	if assessment.Decision == services.RiskReview {
+		item := repository.ReviewItem{
+			Kind:         repository.ReviewKindPurchase,
+			UserID:       claims.UserID,
+			AccountID:    account.ID,
+			ProductID:    product.ID,
+			ProductName:  product.Name,
+			SKU:          req.SKU,
+			Quantity:     req.Quantity,
+			UnitPrice:    product.UnitPrice(req.SKU),
+			Discount:     discount,
+			Amount:       amount,
+			TaxBreakdown: tax,
+		}
+		if promotion != nil {
+			item.PromotionID = promotion.ID
+			item.PromotionCode = promotion.Code
+		}
+		parkForReview(w, r, item, account, assessment)
+		return
+	}
+
+	txn, err := repository.PurchaseProduct(r.Context(), repository.PurchaseOrder{
+		AccountID:     req.AccountID,
+		ProductID:     req.ProductID,
+		SKU:           req.SKU,
+		Quantity:      req.Quantity,
+		PromotionCode: req.Code,
+		Tax:           rate,
+	})
+	if err != nil {
 		switch {
 		case errors.Is(err, repository.ErrAccountNotFound):
 			http.Error(w, "Account not found", http.StatusNotFound)
@@ -56,6 +150,13 @@ func PurchaseProductHandler(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, repository.ErrProductNotFound):
 			http.Error(w, "Product not found", http.StatusNotFound)
 			return
+		case errors.Is(err, repository.ErrProductArchived):
+			http.Error(w, "Product is no longer available", http.StatusConflict)
+			return
+		case writeVariantError(w, err):
+			return
+		case writePromotionError(w, err):
+			return
 		case errors.Is(err, repository.ErrProductOutOfStock):
 			http.Error(w, "Not enough stock available", http.StatusBadRequest)
 			return
@@ -69,11 +170,36 @@ func PurchaseProductHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Purchase successful",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     "Purchase successful",
+		"transaction": txn,
 	})
 }
 
+// purchaseTaxRate resolves the rate the caller pays on product, writing the
+// error response if there is none.
+func purchaseTaxRate(w http.ResponseWriter, r *http.Request, product repository.Product) (repository.TaxRate, bool) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	user, err := repository.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return repository.TaxRate{}, false
+	}
+
+	rate, err := services.TaxRateFor(user, product)
+	if err != nil {
+		if errors.Is(err, services.ErrNoTaxRate) {
+			http.Error(w, "Product cannot be sold in your tax jurisdiction", http.StatusConflict)
+			return repository.TaxRate{}, false
+		}
+		http.Error(w, "Failed to calculate tax", http.StatusInternalServerError)
+		return repository.TaxRate{}, false
+	}
+
+	return rate, true
+}
+
 func GetPurchaseHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid method", http.StatusBadRequest)
@@ -87,6 +213,28 @@ func GetPurchaseHistoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Purchases made before names were recorded take the product's current
+	// name, which archived products keep.
+	names := map[string]string{}
+	purchases := []repository.Transaction{}
+	for _, txn := range transactions {
+		if txn.TransactionType != "purchase" {
+			continue
+		}
+
+		if txn.ProductName == "" {
+			name, ok := names[txn.ProductID]
+			if !ok {
+				if product, err := repository.GetProductByID(r.Context(), txn.ProductID); err == nil {
+					name = product.Name
+				}
+				names[txn.ProductID] = name
+			}
+			txn.ProductName = name
+		}
+		purchases = append(purchases, txn)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(transactions)
+	json.NewEncoder(w).Encode(purchases)
 }
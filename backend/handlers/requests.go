@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRequestExpiryHours = 7 * 24
+	maxRequestExpiryHours     = 30 * 24
+)
+
+func CreatePaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		Payer          string `json:"payer"`
+		ToAccountID    string `json:"to_account_id"`
+		Amount         int64  `json:"amount"`
+		Note           string `json:"note"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Note) > 140 {
+		http.Error(w, "Note cannot exceed 140 characters", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultRequestExpiryHours
+	}
+
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > maxRequestExpiryHours {
+		http.Error(w, "Expiry must be between 1 and 720 hours", http.StatusBadRequest)
+		return
+	}
+
+	if req.Payer == "" {
+		http.Error(w, "Payer required", http.StatusBadRequest)
+		return
+	}
+
+	payer, err := services.LookupRecipient(r.Context(), req.Payer)
+	if err != nil {
+		if errors.Is(err, services.ErrRecipientNotFound) {
+			http.Error(w, "Payer not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to resolve payer", http.StatusInternalServerError)
+		return
+	}
+
+	if payer.ID == claims.UserID {
+		http.Error(w, "Cannot request money from yourself", http.StatusBadRequest)
+		return
+	}
+
+	requester, err := repository.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	var toAccount repository.Account
+	if req.ToAccountID != "" {
+		toAccount, err = repository.GetAccountByID(r.Context(), req.ToAccountID)
+		if err != nil {
+			if errors.Is(err, repository.ErrAccountNotFound) {
+				http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to load account", http.StatusInternalServerError)
+			return
+		}
+		if toAccount.UserID != claims.UserID {
+			http.Error(w, "Account id doesn't belong to current user", http.StatusForbidden)
+			return
+		}
+	} else {
+		toAccount, err = services.ReceivingAccount(r.Context(), requester)
+		if err != nil {
+			if errors.Is(err, services.ErrNoReceivingAccount) {
+				http.Error(w, "Choose an account to receive the money", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Failed to load account", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	request := repository.PaymentRequest{
+		ID:                 utils.GenerateID("req"),
+		RequesterID:        requester.ID,
+		RequesterAccountID: toAccount.ID,
+		RequesterName:      services.MaskName(requester.FullName),
+		PayerID:            payer.ID,
+		PayerName:          services.MaskName(payer.FullName),
+		Amount:             req.Amount,
+		Note:               req.Note,
+		Status:             repository.RequestStatusPending,
+		ExpiresAt:          now.Add(time.Duration(req.ExpiresInHours) * time.Hour),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+
+	if err := repository.CreatePaymentRequest(r.Context(), request); err != nil {
+		http.Error(w, "Failed to create payment request", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&request)
+}
+
+// GetPaymentRequestsHandler lists incoming requests (to pay) by default, or the
+// caller's own requests with ?direction=outgoing.
+func GetPaymentRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var (
+		requests []repository.PaymentRequest
+		err      error
+	)
+	switch r.URL.Query().Get("direction") {
+	case "", "incoming":
+		requests, err = repository.GetPaymentRequestsByPayerID(r.Context(), claims.UserID)
+	case "outgoing":
+		requests, err = repository.GetPaymentRequestsByRequesterID(r.Context(), claims.UserID)
+	default:
+		http.Error(w, "Direction must be incoming or outgoing", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch payment requests", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	for i := range requests {
+		expirePaymentRequest(r, &requests[i], now)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&requests)
+}
+
+func PaymentRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreatePaymentRequestHandler(w, r)
+	case http.MethodGet:
+		GetPaymentRequestsHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PaymentRequestHandler serves /requests/{id} and the /{id}/accept,
+// /{id}/decline and /{id}/cancel actions.
+func PaymentRequestHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	requestID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/requests/"), "/")
+	if requestID == "" {
+		http.Error(w, "Request ID required", http.StatusBadRequest)
+		return
+	}
+
+	request, err := repository.GetPaymentRequestByID(r.Context(), requestID)
+	if err != nil {
+		if errors.Is(err, repository.ErrPaymentRequestNotFound) {
+			http.Error(w, "Payment request not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load payment request", http.StatusInternalServerError)
+		return
+	}
+
+	if request.PayerID != claims.UserID && request.RequesterID != claims.UserID {
+		http.Error(w, "Payment request not found", http.StatusNotFound)
+		return
+	}
+
+	expirePaymentRequest(r, &request, time.Now())
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&request)
+	case r.Method == http.MethodPost && action == "accept" && request.PayerID == claims.UserID:
+		acceptPaymentRequest(w, r, request)
+	case r.Method == http.MethodPost && action == "decline" && request.PayerID == claims.UserID:
+		closePaymentRequest(w, r, request, repository.RequestStatusDeclined)
+	case r.Method == http.MethodPost && action == "cancel" && request.RequesterID == claims.UserID:
+		closePaymentRequest(w, r, request, repository.RequestStatusCancelled)
+	case r.Method == http.MethodPost && (action == "accept" || action == "decline" || action == "cancel"):
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func acceptPaymentRequest(w http.ResponseWriter, r *http.Request, request repository.PaymentRequest) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		FromAccountID string `json:"from_account_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if request.Status != repository.RequestStatusPending {
+		http.Error(w, "Payment request is "+request.Status, http.StatusConflict)
+		return
+	}
+
+	fromAccount, err := repository.GetAccountByID(r.Context(), req.FromAccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Sender account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load sender account", http.StatusInternalServerError)
+		return
+	}
+
+	if fromAccount.UserID != claims.UserID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if fromAccount.AvailableBalance() < request.Amount {
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		return
+	}
+
+	assessment, ok := assessRisk(w, r, services.RiskOperation{
+		Kind:        services.RiskKindTransfer,
+		UserID:      claims.UserID,
+		AccountID:   fromAccount.ID,
+		ToAccountID: request.RequesterAccountID,
+		Amount:      request.Amount,
+	})
+	if !ok {
+		return
+	}
+
+	if assessment.Decision == services.RiskReview {
+		// One review per request, so accepting again while it waits is a
+		// conflict rather than a second hold.
+		parkForReview(w, r, repository.ReviewItem{
+			ID:               "review_" + request.ID,
+			Kind:             repository.ReviewKindTransfer,
+			UserID:           claims.UserID,
+			AccountID:        fromAccount.ID,
+			ToAccountID:      request.RequesterAccountID,
+			PaymentRequestID: request.ID,
+			Amount:           request.Amount,
+		}, fromAccount, assessment)
+		return
+	}
+
+	if err := repository.PayPaymentRequest(r.Context(), request, fromAccount.ID, time.Now()); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInsufficientBalance):
+			http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrAccountNotFound):
+			http.Error(w, "Account not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrPaymentRequestClosed):
+			http.Error(w, "Payment request is no longer pending", http.StatusConflict)
+		case errors.Is(err, repository.ErrTransferInterrupted):
+			http.Error(w, "Payment was interrupted, try again", http.StatusConflict)
+		default:
+			http.Error(w, "Payment failed", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	request.Status = repository.RequestStatusPaid
+	request.PaidFromAccountID = fromAccount.ID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&request)
+}
+
+func closePaymentRequest(w http.ResponseWriter, r *http.Request, request repository.PaymentRequest, status string) {
+	if err := repository.ClosePaymentRequest(r.Context(), request.ID, status); err != nil {
+		if errors.Is(err, repository.ErrPaymentRequestClosed) {
+			http.Error(w, "Payment request is no longer pending", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to update payment request", http.StatusInternalServerError)
+		return
+	}
+
+	request.Status = status
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&request)
+}
+
+// expirePaymentRequest closes a pending request whose expiry has passed. The
+// expiry is also enforced when paying, so a failed write here is harmless.
+func expirePaymentRequest(r *http.Request, request *repository.PaymentRequest, now time.Time) {
+	if request.Status != repository.RequestStatusPending || now.Before(request.ExpiresAt) {
+		return
+	}
+
+	if err := repository.ClosePaymentRequest(r.Context(), request.ID, repository.RequestStatusExpired); err != nil {
+		return
+	}
+	request.Status = repository.RequestStatusExpired
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	appconfig "banking-ecommerce-api/config"
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CreateReservationHandler sets aside units of a product for the caller at
+// its current price until they buy them or the reservation expires.
+func CreateReservationHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+	cfg := appconfig.GetReservationConfig()
+
+	var req struct {
+		ProductID        string `json:"product_id"`
+		SKU              string `json:"sku"`
+		Quantity         int    `json:"quantity"`
+		ExpiresInMinutes int    `json:"expires_in_minutes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Quantity <= 0 {
+		http.Error(w, "Invalid quantity", http.StatusBadRequest)
+		return
+	}
+
+	ttl := cfg.DefaultTTL
+	if req.ExpiresInMinutes != 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+
+	if ttl <= 0 || ttl > cfg.MaxTTL {
+		http.Error(w, "Expiry must be positive and at most "+cfg.MaxTTL.String(), http.StatusBadRequest)
+		return
+	}
+
+	product, err := repository.GetProductByID(r.Context(), req.ProductID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	if product.Archived() {
+		http.Error(w, "Product is no longer available", http.StatusConflict)
+		return
+	}
+
+	if err := product.CheckVariant(req.SKU); err != nil {
+		writeVariantError(w, err)
+		return
+	}
+
+	if product.AvailableFor(req.SKU) < req.Quantity {
+		http.Error(w, "Not enough stock available", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	reservation := repository.Reservation{
+		ID:          utils.GenerateID("resv"),
+		ProductID:   product.ID,
+		ProductName: product.Name,
+		SKU:         req.SKU,
+		UserID:      claims.UserID,
+		Quantity:    req.Quantity,
+		UnitPrice:   product.UnitPrice(req.SKU),
+		Status:      repository.ReservationStatusActive,
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	services.AuditAction(r.Context(), "product.reserve", "reservation", reservation.ID)
+	services.AuditSnapshot(r.Context(), nil, reservation)
+
+	if err := repository.CreateReservation(r.Context(), reservation, product); err != nil {
+		if errors.Is(err, repository.ErrProductOutOfStock) {
+			http.Error(w, "Not enough stock available", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to reserve product", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&reservation)
+}
+
+// GetReservationsHandler lists the caller's reservations.
+func GetReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	reservations, err := repository.GetReservationsByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch reservations", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	for i := range reservations {
+		expireReservation(r, &reservations[i], now)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&reservations)
+}
+
+func ReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreateReservationHandler(w, r)
+	case http.MethodGet:
+		GetReservationsHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ReservationHandler serves /reservations/{id} and the /{id}/purchase and
+// /{id}/release actions.
+func ReservationHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	reservationID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/reservations/"), "/")
+	if reservationID == "" {
+		http.Error(w, "Reservation ID required", http.StatusBadRequest)
+		return
+	}
+
+	reservation, err := repository.GetReservationByID(r.Context(), reservationID)
+	if err != nil || reservation.UserID != claims.UserID {
+		if err == nil || errors.Is(err, repository.ErrReservationNotFound) {
+			http.Error(w, "Reservation not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load reservation", http.StatusInternalServerError)
+		return
+	}
+
+	expireReservation(r, &reservation, time.Now())
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&reservation)
+	case r.Method == http.MethodPost && action == "purchase":
+		purchaseReservation(w, r, reservation)
+	case r.Method == http.MethodPost && action == "release":
+		releaseReservation(w, r, reservation)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// purchaseReservation buys the reserved units from the account in the body at
+// the reserved price. Purchases the risk engine flags are queued for review
+// like any other, which gives the reserved units back.
+func purchaseReservation(w http.ResponseWriter, r *http.Request, reservation repository.Reservation) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		AccountID string `json:"account_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if reservation.Status != repository.ReservationStatusActive {
+		http.Error(w, "Reservation is "+reservation.Status, http.StatusConflict)
+		return
+	}
+
+	account, err := repository.GetAccountByID(r.Context(), req.AccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
+		return
+	}
+
+	if account.UserID != claims.UserID {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	product, err := repository.GetProductByID(r.Context(), reservation.ProductID)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load product", http.StatusInternalServerError)
+		return
+	}
+
+	if product.Archived() {
+		http.Error(w, "Product is no longer available", http.StatusConflict)
+		return
+	}
+
+	rate, ok := purchaseTaxRate(w, r, product)
+	if !ok {
+		return
+	}
+	tax := rate.Apply(reservation.UnitPrice * int64(reservation.Quantity))
+	amount := tax.Gross()
+	if account.AvailableBalance() < amount {
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		return
+	}
+
+	services.AuditAction(r.Context(), "product.purchase", "product", reservation.ProductID)
+
+	assessment, ok := assessRisk(w, r, services.RiskOperation{
+		Kind:      services.RiskKindPurchase,
+		UserID:    claims.UserID,
+		AccountID: account.ID,
+		ProductID: reservation.ProductID,
+		Amount:    amount,
+	})
+	services.AuditSnapshot(r.Context(), nil, map[string]interface{}{
+		"account_id":         account.ID,
+		"product_id":         reservation.ProductID,
+		"quantity":           reservation.Quantity,
+		"reservation_id":     reservation.ID,
+		"risk_assessment_id": assessment.ID,
+		"risk_decision":      assessment.Decision,
+	})
+	if !ok {
+		return
+	}
+
+	if assessment.Decision == services.RiskReview {
+		if err := repository.ReleaseReservation(r.Context(), reservation, repository.ReservationStatusReleased, time.Now()); err != nil {
+			if errors.Is(err, repository.ErrReservationClosed) {
+				http.Error(w, "Reservation is no longer active", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Failed to release reservation", http.StatusInternalServerError)
+			return
+		}
+
+		parkForReview(w, r, repository.ReviewItem{
+			Kind:         repository.ReviewKindPurchase,
+			UserID:       claims.UserID,
+			AccountID:    account.ID,
+			ProductID:    reservation.ProductID,
+			ProductName:  reservation.ProductName,
+			SKU:          reservation.SKU,
+			Quantity:     reservation.Quantity,
+			UnitPrice:    reservation.UnitPrice,
+			Amount:       amount,
+			TaxBreakdown: tax,
+		}, account, assessment)
+		return
+	}
+
+	txn, err := repository.PurchaseReservation(r.Context(), reservation, account, rate, time.Now().UTC())
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrReservationClosed):
+			http.Error(w, "Reservation is no longer active", http.StatusConflict)
+		case errors.Is(err, repository.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrInsufficientBalance):
+			http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		default:
+			http.Error(w, "Purchase failed", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&txn)
+}
+
+func releaseReservation(w http.ResponseWriter, r *http.Request, reservation repository.Reservation) {
+	if reservation.Status != repository.ReservationStatusActive {
+		http.Error(w, "Reservation is "+reservation.Status, http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	if err := repository.ReleaseReservation(r.Context(), reservation, repository.ReservationStatusReleased, now); err != nil {
+		if errors.Is(err, repository.ErrReservationClosed) {
+			http.Error(w, "Reservation is no longer active", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to release reservation", http.StatusInternalServerError)
+		return
+	}
+
+	reservation.Status = repository.ReservationStatusReleased
+	reservation.UpdatedAt = now
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&reservation)
+}
+
+// expireReservation releases an active reservation whose expiry has passed, so
+// it cannot be bought while the expiry job has yet to reach it.
+func expireReservation(r *http.Request, reservation *repository.Reservation, now time.Time) {
+	if reservation.Status != repository.ReservationStatusActive || now.Before(reservation.ExpiresAt) {
+		return
+	}
+
+	if err := repository.ReleaseReservation(r.Context(), *reservation, repository.ReservationStatusExpired, now); err != nil {
+		return
+	}
+	reservation.Status = repository.ReservationStatusExpired
+}
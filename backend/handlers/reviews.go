@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// parkForReview queues a payment the risk engine flagged, holding its amount
+// on the account until an admin approves or rejects it.
+func parkForReview(w http.ResponseWriter, r *http.Request, item repository.ReviewItem, account repository.Account, assessment repository.RiskAssessment) {
+	item, err := services.QueueForReview(r.Context(), item, account, assessment)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			http.Error(w, "Insufficient balance", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrReviewExists) {
+			http.Error(w, "Payment is already held for review", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to queue payment for review", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":   "Payment held for review",
+		"review_id": item.ID,
+	})
+}
+
+// reviewOverdue reports whether an item missed its SLA: it was decided after
+// DueAt, or is still pending past it.
+func reviewOverdue(item repository.ReviewItem, now time.Time) bool {
+	if item.Status == repository.ReviewStatusPending {
+		return now.After(item.DueAt)
+	}
+	return item.DecidedAt.After(item.DueAt)
+}
+
+// GetReviewItemsHandler lists review items by ?status=, pending_review by
+// default, oldest first. ?overdue=true keeps only items that missed their SLA.
+func GetReviewItemsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = repository.ReviewStatusPending
+	case repository.ReviewStatusPending, repository.ReviewStatusApproved, repository.ReviewStatusRejected:
+	default:
+		http.Error(w, "Status must be pending_review, approved or rejected", http.StatusBadRequest)
+		return
+	}
+
+	items, err := repository.GetReviewItemsByStatus(r.Context(), status)
+	if err != nil {
+		http.Error(w, "Failed to fetch review items", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("overdue") == "true" {
+		now := time.Now()
+		overdue := []repository.ReviewItem{}
+		for _, item := range items {
+			if reviewOverdue(item, now) {
+				overdue = append(overdue, item)
+			}
+		}
+		items = overdue
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&items)
+}
+
+func ReviewItemsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetReviewItemsHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ReviewItemHandler serves /admin/reviews/{id} and the /{id}/claim,
+// /{id}/approve and /{id}/reject actions.
+func ReviewItemHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/reviews/"), "/")
+	if itemID == "" {
+		http.Error(w, "Review ID required", http.StatusBadRequest)
+		return
+	}
+
+	item, err := repository.GetReviewItemByID(r.Context(), itemID)
+	if err != nil {
+		if errors.Is(err, repository.ErrReviewNotFound) {
+			http.Error(w, "Review item not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load review item", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&item)
+	case r.Method == http.MethodPost && action == "claim":
+		claimReviewItem(w, r, item)
+	case r.Method == http.MethodPost && (action == "approve" || action == "reject"):
+		decideReviewItem(w, r, item, action == "approve")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func claimReviewItem(w http.ResponseWriter, r *http.Request, item repository.ReviewItem) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+	services.AuditAction(r.Context(), "review.claim", "review", item.ID)
+
+	if item.ClaimedBy != claims.UserID {
+		before := item
+		now := time.Now().UTC().Truncate(time.Second)
+		if err := repository.ClaimReviewItem(r.Context(), item, claims.UserID, now); err != nil {
+			writeReviewError(w, err)
+			return
+		}
+
+		item.ClaimedBy = claims.UserID
+		item.ClaimedAt = now
+		item.UpdatedAt = now
+		services.AuditSnapshot(r.Context(), before, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&item)
+}
+
+func decideReviewItem(w http.ResponseWriter, r *http.Request, item repository.ReviewItem, approve bool) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	action := "review.reject"
+	if approve {
+		action = "review.approve"
+	}
+	services.AuditAction(r.Context(), action, "review", item.ID)
+
+	var req struct {
+		Note string `json:"note"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(req.Note) > 500 {
+		http.Error(w, "Note cannot exceed 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	before := item
+	now := time.Now().UTC().Truncate(time.Second)
+	var err error
+	if approve {
+		err = services.ApproveReviewItem(r.Context(), item, claims.UserID, req.Note, now)
+		item.Status = repository.ReviewStatusApproved
+	} else {
+		err = repository.RejectReviewItem(r.Context(), item, claims.UserID, req.Note, now)
+		item.Status = repository.ReviewStatusRejected
+	}
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	if item.ClaimedBy == "" {
+		item.ClaimedBy = claims.UserID
+		item.ClaimedAt = now
+	}
+	item.ReviewedBy = claims.UserID
+	item.ReviewNote = req.Note
+	item.DecidedAt = now
+	item.UpdatedAt = now
+	services.AuditSnapshot(r.Context(), before, item)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&item)
+}
+
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrReviewClosed):
+		http.Error(w, "Review item is no longer pending", http.StatusConflict)
+	case errors.Is(err, repository.ErrReviewClaimed):
+		http.Error(w, "Review item is claimed by another admin", http.StatusConflict)
+	case errors.Is(err, repository.ErrReviewOwnItem):
+		http.Error(w, "Admins cannot review their own payments", http.StatusForbidden)
+	case errors.Is(err, repository.ErrProductOutOfStock):
+		http.Error(w, "Not enough stock available", http.StatusConflict)
+	case errors.Is(err, repository.ErrProductNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrProductArchived):
+		http.Error(w, "Product is no longer available", http.StatusConflict)
+	case errors.Is(err, repository.ErrPaymentRequestClosed):
+		http.Error(w, "Payment request is no longer pending", http.StatusConflict)
+	case errors.Is(err, services.ErrRailNotConfigured):
+		http.Error(w, "Withdrawals are not available", http.StatusServiceUnavailable)
+	case errors.Is(err, repository.ErrBulkItemsClosed):
+		http.Error(w, "Bulk transfer item is not waiting on this review yet; try again shortly", http.StatusConflict)
+	case writeVariantError(w, err):
+	case writePromotionError(w, err):
+	case errors.Is(err, repository.ErrAccountNotFound):
+		http.Error(w, "Account not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to update review item", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"encoding/json"
+	"net/http"
+)
+
+// assessRisk runs the risk engine on a payment about to leave an account. It
+// writes the error response and returns false if the payment is declined; a
+// payment that needs review is returned with that decision for the caller to
+// park with parkForReview.
+func assessRisk(w http.ResponseWriter, r *http.Request, op services.RiskOperation) (repository.RiskAssessment, bool) {
+	assessment, err := services.AssessRisk(r.Context(), op)
+	if err != nil {
+		http.Error(w, "Failed to assess payment risk", http.StatusInternalServerError)
+		return repository.RiskAssessment{}, false
+	}
+
+	if assessment.Decision == services.RiskDeny {
+		http.Error(w, "Payment declined by risk checks", http.StatusForbidden)
+		return assessment, false
+	}
+
+	return assessment, true
+}
+
+// RiskAssessmentsHandler lists risk assessments for ?user_id=, or otherwise by
+// ?decision=, review by default.
+func RiskAssessmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var assessments []repository.RiskAssessment
+	var err error
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		assessments, err = repository.GetRiskAssessmentsByUserID(r.Context(), userID)
+	} else {
+		decision := r.URL.Query().Get("decision")
+		switch decision {
+		case "":
+			decision = services.RiskReview
+		case services.RiskAllow, services.RiskReview, services.RiskDeny:
+		default:
+			http.Error(w, "Decision must be allow, review or deny", http.StatusBadRequest)
+			return
+		}
+		assessments, err = repository.GetRiskAssessmentsByDecision(r.Context(), decision)
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch risk assessments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&assessments)
+}
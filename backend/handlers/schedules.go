@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"banking-ecommerce-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func CreateScheduledTransferHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	var req struct {
+		FromAccountID  string    `json:"from_account_id"`
+		ToAccountID    string    `json:"to_account_id"`
+		Amount         int64     `json:"amount"`
+		Frequency      string    `json:"frequency"`
+		StartAt        time.Time `json:"start_at"`
+		EndAt          time.Time `json:"end_at"`
+		MaxOccurrences int       `json:"max_occurrences"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	if req.FromAccountID == req.ToAccountID {
+		http.Error(w, "Self-transfer is not allowed", http.StatusBadRequest)
+		return
+	}
+
+	if req.Frequency == "" {
+		req.Frequency = repository.FrequencyOnce
+	}
+
+	switch req.Frequency {
+	case repository.FrequencyOnce, repository.FrequencyDaily, repository.FrequencyWeekly, repository.FrequencyMonthly:
+	default:
+		http.Error(w, "Frequency must be once, daily, weekly or monthly", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if req.StartAt.IsZero() {
+		req.StartAt = now
+	}
+
+	if req.StartAt.Before(now.Add(-time.Minute)) {
+		http.Error(w, "Start time cannot be in the past", http.StatusBadRequest)
+		return
+	}
+
+	if !req.EndAt.IsZero() && req.EndAt.Before(req.StartAt) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxOccurrences < 0 {
+		http.Error(w, "Invalid occurrence count", http.StatusBadRequest)
+		return
+	}
+
+	fromAccount, err := repository.GetAccountByID(r.Context(), req.FromAccountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Sender account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load sender account", http.StatusInternalServerError)
+		return
+	}
+
+	if fromAccount.UserID != claims.UserID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if _, err := repository.GetAccountByID(r.Context(), req.ToAccountID); err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Receiver account doesn't exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load receiver account", http.StatusInternalServerError)
+		return
+	}
+
+	startAt := req.StartAt.UTC().Truncate(time.Second)
+	schedule := repository.ScheduledTransfer{
+		ID:             utils.GenerateID("sched"),
+		UserID:         claims.UserID,
+		FromAccountID:  fromAccount.ID,
+		ToAccountID:    req.ToAccountID,
+		Amount:         req.Amount,
+		Frequency:      req.Frequency,
+		StartAt:        startAt,
+		MaxOccurrences: req.MaxOccurrences,
+		NextRunAt:      startAt,
+		Status:         repository.ScheduleStatusActive,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if !req.EndAt.IsZero() {
+		schedule.EndAt = req.EndAt.UTC()
+	}
+
+	if err := repository.CreateScheduledTransfer(r.Context(), schedule); err != nil {
+		http.Error(w, "Failed to create scheduled transfer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&schedule)
+}
+
+func GetScheduledTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	schedules, err := repository.GetScheduledTransfersByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Failed to fetch scheduled transfers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&schedules)
+}
+
+func ScheduledTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreateScheduledTransferHandler(w, r)
+	case http.MethodGet:
+		GetScheduledTransfersHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ScheduledTransferHandler serves /scheduled-transfers/{id}, /{id}/runs and the
+// /{id}/pause, /{id}/resume and /{id}/cancel actions.
+func ScheduledTransferHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	scheduleID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/scheduled-transfers/"), "/")
+	if scheduleID == "" {
+		http.Error(w, "Scheduled transfer ID required", http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := repository.GetScheduledTransferByID(r.Context(), scheduleID)
+	if err != nil {
+		if errors.Is(err, repository.ErrScheduleNotFound) {
+			http.Error(w, "Scheduled transfer not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load scheduled transfer", http.StatusInternalServerError)
+		return
+	}
+
+	if schedule.UserID != claims.UserID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&schedule)
+	case r.Method == http.MethodGet && action == "runs":
+		runs, err := repository.GetScheduleRuns(r.Context(), schedule.ID)
+		if err != nil {
+			http.Error(w, "Failed to fetch scheduled transfer runs", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&runs)
+	case r.Method == http.MethodPost && action == "pause":
+		updateScheduleStatus(w, r, schedule, repository.ScheduleStatusPaused, repository.ScheduleStatusActive)
+	case r.Method == http.MethodPost && action == "resume":
+		updateScheduleStatus(w, r, schedule, repository.ScheduleStatusActive, repository.ScheduleStatusPaused)
+	case r.Method == http.MethodPost && action == "cancel":
+		updateScheduleStatus(w, r, schedule, repository.ScheduleStatusCancelled, repository.ScheduleStatusActive, repository.ScheduleStatusPaused)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func updateScheduleStatus(w http.ResponseWriter, r *http.Request, schedule repository.ScheduledTransfer, status string, allowed ...string) {
+	if err := repository.UpdateScheduledTransferStatus(r.Context(), schedule.ID, status, allowed...); err != nil {
+		if errors.Is(err, repository.ErrScheduleStateConflict) {
+			http.Error(w, "Scheduled transfer cannot change from its current state", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to update scheduled transfer", http.StatusInternalServerError)
+		return
+	}
+
+	schedule.Status = status
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&schedule)
+}
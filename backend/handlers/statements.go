@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/middleware"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// statementFormats maps each statement format to its content type, file
+// extension and writer.
+var statementFormats = map[string]struct {
+	contentType string
+	extension   string
+	write       func(io.Writer, services.Statement) error
+}{
+	"json": {"application/json", "json", services.WriteStatementJSON},
+	"csv":  {"text/csv; charset=utf-8", "csv", services.WriteStatementCSV},
+	"ofx":  {"application/x-ofx", "ofx", services.WriteStatementOFX},
+}
+
+// AccountStatementHandler serves GET /accounts/{id}/statement. The period is
+// ?from= to ?to=, each a date (inclusive, UTC) or an RFC 3339 time, and
+// defaults to the current month so far; ?format= is json, csv or ofx.
+func AccountStatementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accountID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/statement")
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	encoding, ok := statementFormats[format]
+	if !ok {
+		http.Error(w, "Format must be json, csv or ofx", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	var err error
+	if value := query.Get("from"); value != "" {
+		if from, err = services.ParseStatementDate(value, false); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = services.ParseStatementDate(value, true); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !from.Before(to) {
+		http.Error(w, "From must be before to", http.StatusBadRequest)
+		return
+	}
+
+	account, ok := statementAccount(w, r, accountID)
+	if !ok {
+		return
+	}
+
+	statement, err := services.BuildStatement(r.Context(), account, from, to)
+	if err != nil {
+		http.Error(w, "Failed to build statement", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s", account.ID,
+		statement.PeriodStart.Format("20060102"), statement.PeriodEnd.Format("20060102"), encoding.extension)
+	w.Header().Set("Content-Type", encoding.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// The body is streamed, so a failure part way through can only be logged.
+	if err := encoding.write(w, statement); err != nil {
+		log.Printf("statement: writing %s for %s: %v", format, account.ID, err)
+	}
+}
+
+// statementAccount loads the account and checks it belongs to the caller,
+// writing the error response if not.
+func statementAccount(w http.ResponseWriter, r *http.Request, accountID string) (repository.Account, bool) {
+	claims := r.Context().Value(middleware.ClaimsKey).(*services.Claims)
+
+	account, err := repository.GetAccountByID(r.Context(), accountID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			http.Error(w, "Bank account doesn't exist", http.StatusNotFound)
+			return repository.Account{}, false
+		}
+		http.Error(w, "Failed to load account", http.StatusInternalServerError)
+		return repository.Account{}, false
+	}
+
+	if account.UserID != claims.UserID {
+		http.Error(w, "Account id doesn't belong to current user", http.StatusForbidden)
+		return repository.Account{}, false
+	}
+
+	return account, true
+}
+
+// IssuedStatementsHandler serves GET /accounts/{id}/statements, listing the
+// account's monthly statements newest first.
+func IssuedStatementsHandler(w http.ResponseWriter, r *http.Request, accountID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := statementAccount(w, r, accountID); !ok {
+		return
+	}
+
+	statements, err := repository.GetIssuedStatementsByAccountID(r.Context(), accountID)
+	if err != nil {
+		http.Error(w, "Failed to fetch statements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&statements)
+}
+
+// IssuedStatementHandler serves GET /accounts/{id}/statements/{month}, where
+// month is 2006-01. JSON downloads are the issued document byte for byte;
+// ?format=csv or ofx renders the same statement in that format.
+func IssuedStatementHandler(w http.ResponseWriter, r *http.Request, accountID, month string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	encoding, ok := statementFormats[format]
+	if !ok {
+		http.Error(w, "Format must be json, csv or ofx", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := statementAccount(w, r, accountID); !ok {
+		return
+	}
+
+	issued, err := repository.GetIssuedStatement(r.Context(), accountID, month)
+	if err != nil {
+		if errors.Is(err, repository.ErrStatementNotFound) {
+			http.Error(w, "Statement not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load statement", http.StatusInternalServerError)
+		return
+	}
+
+	document, statement, err := services.OpenIssuedStatement(r.Context(), issued)
+	if err != nil {
+		log.Printf("statement: opening %s: %v", issued.ID, err)
+		http.Error(w, "Failed to load statement", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s.%s", accountID, issued.Month, encoding.extension)
+	w.Header().Set("Content-Type", encoding.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("X-Statement-Checksum", "sha256="+issued.Checksum)
+
+	if format == "json" {
+		w.Write(document)
+		return
+	}
+
+	if err := encoding.write(w, statement); err != nil {
+		log.Printf("statement: writing %s for %s: %v", format, issued.ID, err)
+	}
+}
+
+// IssueStatementsHandler serves POST /admin/statements/issue?month=2006-01,
+// issuing that month's statement to every account that is missing one.
+// Statements already issued are left as they are.
+func IssueStatementsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	month, err := time.Parse("2006-01", r.URL.Query().Get("month"))
+	if err != nil {
+		http.Error(w, "Month must be given as YYYY-MM", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	if !month.Before(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)) {
+		http.Error(w, "Month has not ended yet", http.StatusBadRequest)
+		return
+	}
+
+	services.AuditAction(r.Context(), "statement.issue", "statement_month", month.Format("2006-01"))
+
+	issued, failed, err := services.IssueStatements(r.Context(), month)
+	if err != nil {
+		http.Error(w, "Failed to issue statements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"month":  month.Format("2006-01"),
+		"issued": issued,
+		"failed": failed,
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"banking-ecommerce-api/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// variantRequest is a product variant as admins send it. Stock is only taken
+// when the product is created; afterwards it changes through adjustments.
+type variantRequest struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Price      int64             `json:"price"`
+	Stock      int               `json:"stock"`
+}
+
+// parseVariants validates variant definitions and keys them by SKU.
+func parseVariants(reqs []variantRequest) (map[string]repository.ProductVariant, error) {
+	if len(reqs) > repository.MaxProductVariants {
+		return nil, fmt.Errorf("A product can have at most %d variants", repository.MaxProductVariants)
+	}
+
+	variants := make(map[string]repository.ProductVariant, len(reqs))
+	for _, req := range reqs {
+		if !repository.ValidSKU(req.SKU) {
+			return nil, errors.New("Invalid SKU " + strconv.Quote(req.SKU))
+		}
+		if _, ok := variants[req.SKU]; ok {
+			return nil, errors.New("Duplicate SKU " + req.SKU)
+		}
+		if len(req.Attributes) == 0 {
+			return nil, errors.New("Variant " + req.SKU + " needs at least one attribute")
+		}
+		if req.Price < 0 || req.Stock < 0 {
+			return nil, errors.New("Variant " + req.SKU + " has a negative price or stock")
+		}
+
+		variants[req.SKU] = repository.ProductVariant{
+			SKU:        req.SKU,
+			Attributes: req.Attributes,
+			Price:      req.Price,
+			Stock:      req.Stock,
+		}
+	}
+
+	return variants, nil
+}
+
+// writeVariantError answers a request naming a missing or unexpected variant,
+// reporting whether err was one.
+func writeVariantError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrVariantRequired):
+		http.Error(w, "Product variant required", http.StatusBadRequest)
+	case errors.Is(err, repository.ErrVariantNotFound):
+		http.Error(w, "Product variant not found", http.StatusNotFound)
+	default:
+		return false
+	}
+	return true
+}
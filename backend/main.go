@@ -5,10 +5,16 @@ import (
 	"banking-ecommerce-api/handlers"
 	"banking-ecommerce-api/middleware"
 	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/seed"
+	"banking-ecommerce-api/services"
 	"banking-ecommerce-api/utils"
+	"bytes"
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -29,132 +35,22 @@ func createDemoProducts(ctx context.Context) error {
 		return nil
 	}
 
-	log.Println("Creating 100 demo products...")
-
-	demoProducts := []struct {
-		name        string
-		description string
-		price       int64
-		stock       int
-	}{
-		{"Wireless Headphones", "Premium noise-cancelling headphones with 30-hour battery life", 29900, 150},
-		{"Smart Watch", "Fitness tracker with heart rate monitor and GPS", 19900, 200},
-		{"Laptop Stand", "Ergonomic aluminum laptop stand for better posture", 4900, 300},
-		{"USB-C Hub", "7-in-1 USB-C hub with HDMI, USB 3.0, and SD card reader", 3900, 250},
-		{"Mechanical Keyboard", "RGB backlit mechanical keyboard with blue switches", 12900, 180},
-		{"Gaming Mouse", "High-precision gaming mouse with customizable RGB", 6900, 220},
-		{"Webcam 1080p", "Full HD webcam with auto-focus and built-in microphone", 7900, 175},
-		{"Phone Case", "Durable protective case with shock absorption", 2900, 500},
-		{"Screen Protector", "Tempered glass screen protector 9H hardness", 1500, 600},
-		{"Wireless Charger", "Fast wireless charging pad Qi-certified", 3400, 400},
-		{"Power Bank", "20000mAh portable power bank with dual USB ports", 5900, 280},
-		{"Bluetooth Speaker", "Portable waterproof speaker with 360° sound", 8900, 190},
-		{"Cable Organizer", "Desk cable management system - 5 pack", 1900, 450},
-		{"Laptop Sleeve", "Padded laptop sleeve 13-15 inch compatible", 2400, 320},
-		{"Desk Lamp", "LED desk lamp with adjustable brightness and color", 4500, 210},
-		{"Mouse Pad", "Large gaming mouse pad with non-slip base", 1800, 550},
-		{"Webcam Cover", "Privacy webcam cover slider - 3 pack", 900, 700},
-		{"Phone Stand", "Adjustable phone stand for desk", 1200, 480},
-		{"Tablet Stand", "Foldable tablet stand for reading and video", 2800, 350},
-		{"Monitor Arm", "Single monitor arm with gas spring adjustment", 9900, 140},
-		{"Earbuds", "True wireless earbuds with charging case", 7900, 260},
-		{"Smart Plug", "WiFi smart plug with voice control", 2400, 380},
-		{"LED Strip", "5m RGB LED strip with remote control", 3900, 290},
-		{"Web Camera Light", "Ring light for webcam and video calls", 3200, 310},
-		{"Microphone", "USB condenser microphone for podcasting", 11900, 160},
-		{"Laptop Bag", "Professional laptop backpack with USB port", 6900, 240},
-		{"Graphics Tablet", "Digital drawing tablet with pen", 8900, 170},
-		{"External SSD", "500GB portable external SSD USB 3.1", 7900, 200},
-		{"USB Flash Drive", "128GB USB 3.0 flash drive", 2900, 450},
-		{"HDMI Cable", "4K HDMI cable 2m braided", 1500, 600},
-		{"Phone Grip", "Collapsible phone grip and stand", 800, 800},
-		{"Laptop Cooling Pad", "Laptop cooling pad with 5 fans", 4900, 220},
-		{"Surge Protector", "8-outlet surge protector with USB ports", 3900, 280},
-		{"Cable Clips", "Adhesive cable clips - 20 pack", 1200, 500},
-		{"Desk Organizer", "Bamboo desk organizer with phone stand", 3400, 270},
-		{"Monitor Light Bar", "LED monitor light bar with auto-dimming", 8900, 150},
-		{"Keyboard Wrist Rest", "Memory foam keyboard wrist rest", 2400, 360},
-		{"Mouse Wrist Rest", "Ergonomic mouse wrist rest with gel", 1800, 420},
-		{"Laptop Privacy Screen", "14 inch laptop privacy filter", 4900, 190},
-		{"Docking Station", "USB-C docking station 11-in-1", 15900, 130},
-		{"Portable Monitor", "15.6 inch portable monitor Full HD", 24900, 110},
-		{"Stylus Pen", "Universal capacitive stylus pen", 2400, 390},
-		{"Screen Cleaning Kit", "Screen cleaning solution and microfiber cloth", 1500, 520},
-		{"Cable Sleeve", "Cable management sleeve 1.5m", 1900, 440},
-		{"Laptop Lock", "Security cable lock for laptops", 2900, 310},
-		{"USB Extension Cable", "USB 3.0 extension cable 3m", 1800, 480},
-		{"Audio Splitter", "3.5mm audio splitter for headphones", 900, 650},
-		{"Bluetooth Adapter", "USB Bluetooth 5.0 adapter for PC", 1500, 510},
-		{"Card Reader", "SD card reader USB 3.0", 1200, 560},
-		{"Phone Tripod", "Flexible phone tripod with remote", 2900, 340},
-		{"Laptop Fan", "External laptop cooling fan", 2400, 370},
-		{"Cable Tester", "Network cable tester RJ45", 3400, 250},
-		{"Laptop Battery", "Replacement laptop battery universal", 6900, 180},
-		{"Wireless Keyboard", "Slim wireless keyboard and mouse combo", 4900, 230},
-		{"Gaming Headset", "7.1 surround sound gaming headset", 8900, 190},
-		{"VR Headset", "Virtual reality headset smartphone compatible", 5900, 160},
-		{"Action Camera", "4K action camera waterproof", 14900, 120},
-		{"Ring Light", "10 inch ring light with tripod", 4900, 210},
-		{"Green Screen", "Collapsible green screen background", 6900, 170},
-		{"Laptop Skin", "Vinyl laptop skin decal custom", 1900, 430},
-		{"Phone Lens Kit", "3-in-1 clip-on phone camera lens", 3400, 280},
-		{"Selfie Stick", "Bluetooth selfie stick with remote", 2400, 360},
-		{"Gimbal Stabilizer", "3-axis smartphone gimbal stabilizer", 11900, 140},
-		{"Streaming Deck", "Programmable stream deck 6 keys", 9900, 150},
-		{"Capture Card", "HD capture card for streaming", 16900, 110},
-		{"USB Microphone", "Cardioid USB microphone for streaming", 7900, 180},
-		{"Pop Filter", "Microphone pop filter double layer", 1500, 470},
-		{"Mic Arm", "Adjustable microphone boom arm", 3900, 240},
-		{"Studio Headphones", "Professional studio monitor headphones", 9900, 160},
-		{"Audio Interface", "2-channel USB audio interface", 12900, 130},
-		{"MIDI Keyboard", "25-key MIDI keyboard controller", 8900, 150},
-		{"Guitar Cable", "10ft guitar cable gold-plated", 1900, 410},
-		{"Drum Pad", "Electronic drum pad practice pad", 6900, 170},
-		{"Tuner", "Clip-on chromatic tuner for guitar", 1500, 490},
-		{"Capo", "Quick-change guitar capo", 1200, 540},
-		{"Guitar Picks", "Guitar picks variety pack - 100 pieces", 1500, 600},
-		{"Music Stand", "Folding music stand portable", 2900, 300},
-		{"Instrument Cable", "XLR cable balanced audio 10ft", 2400, 350},
-		{"Metronome", "Digital metronome with tuner", 2900, 320},
-		{"Acoustic Foam", "Studio acoustic foam panels 12 pack", 4900, 200},
-		{"DJ Controller", "2-channel DJ controller with pads", 24900, 90},
-		{"Turntable", "Belt-drive turntable with USB", 19900, 100},
-		{"Monitor Speakers", "Active studio monitor speakers pair", 29900, 85},
-		{"Subwoofer", "8 inch powered subwoofer", 19900, 95},
-		{"Soundbar", "2.1 channel soundbar with wireless subwoofer", 14900, 120},
-		{"AV Receiver", "5.1 channel AV receiver with HDMI", 34900, 75},
-		{"Bluetooth Transmitter", "Bluetooth transmitter and receiver", 2900, 330},
-		{"Vinyl Record Cleaner", "Record cleaning kit with brush", 2400, 360},
-		{"DJ Headphones", "Professional DJ headphones closed-back", 11900, 140},
-		{"Instrument Tuner", "Pedal tuner for guitar and bass", 8900, 150},
-		{"Direct Box", "Passive direct box DI for instruments", 4900, 210},
-		{"Cable Pack", "Instrument cable pack 3 cables", 4500, 220},
-		{"Patch Cables", "Patch cable pack for pedals 5 pack", 2900, 310},
-		{"Looper Pedal", "Guitar looper pedal with effects", 14900, 110},
-		{"Distortion Pedal", "Classic distortion guitar pedal", 7900, 170},
-		{"Delay Pedal", "Digital delay guitar pedal", 9900, 140},
-		{"Reverb Pedal", "Hall reverb guitar effect pedal", 8900, 150},
-		{"Compressor Pedal", "Dynamic compressor guitar pedal", 10900, 130},
-		{"Wah Pedal", "Classic wah guitar effect pedal", 11900, 120},
+	rows, err := services.ParseProductImportJSON(bytes.NewReader(seed.DemoProducts))
+	if err != nil {
+		return err
 	}
 
-	for i, p := range demoProducts {
-		product := repository.Product{
-			ID:          utils.GenerateUserID(),
-			Name:        p.name,
-			Description: p.description,
-			Price:       p.price,
-			Stock:       p.stock,
-			CreatedAt:   time.Now(),
-		}
+	log.Printf("Importing %d demo products...", len(rows))
 
-		if err := repository.CreateProduct(ctx, product); err != nil {
-			log.Printf("warning: failed to create product %d: %v", i+1, err)
-			continue
-		}
+	report, err := services.ImportProducts(ctx, rows, false)
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		log.Printf("warning: failed to create %d demo products", report.Failed)
 	}
 
-	log.Println("Successfully created 100 demo products")
+	log.Printf("Successfully created %d demo products", report.Created)
 	return nil
 }
 
@@ -236,6 +132,11 @@ func main() {
 		log.Fatalf("failed to ensure DynamoDB tables: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		verifyAuditLog(ctx)
+		return
+	}
+
 	if err := createAdminUser(ctx); err != nil {
 		log.Fatalf("failed to ensure admin user: %v", err)
 	}
@@ -244,16 +145,86 @@ func main() {
 		log.Printf("warning: failed to create demo products: %v", err)
 	}
 
+	if err := services.ConfigurePaymentRail(appconfig.GetRailConfig()); err != nil {
+		log.Fatalf("failed to configure payment rail: %v", err)
+	}
+
+	riskCfg, err := appconfig.GetRiskConfig()
+	if err != nil {
+		log.Fatalf("failed to load risk rules: %v", err)
+	}
+	if err := services.ConfigureRiskEngine(riskCfg); err != nil {
+		log.Fatalf("failed to configure risk engine: %v", err)
+	}
+
+	taxCfg, err := appconfig.GetTaxConfig()
+	if err != nil {
+		log.Fatalf("failed to load tax rates: %v", err)
+	}
+	if err := services.ConfigureTaxRates(taxCfg); err != nil {
+		log.Fatalf("failed to configure tax rates: %v", err)
+	}
+
+	if err := services.ConfigureMediaStore(appconfig.GetMediaConfig()); err != nil {
+		log.Fatalf("failed to configure media store: %v", err)
+	}
+
+	if err := services.ConfigureStatementStore(appconfig.GetStatementConfig()); err != nil {
+		log.Fatalf("failed to configure statement store: %v", err)
+	}
+
+	services.StartTransferScheduler(ctx, appconfig.GetSchedulerConfig())
+	services.StartInterestAccrual(ctx, appconfig.GetInterestConfig())
+	services.StartHoldExpiry(ctx, appconfig.GetHoldConfig())
+	services.StartStatementIssuing(ctx, appconfig.GetStatementConfig())
+	services.StartBulkTransferProcessor(ctx, appconfig.GetBulkTransferConfig())
+	services.StartReservationExpiry(ctx, appconfig.GetReservationConfig())
+	services.StartRailReconciler(ctx, appconfig.GetRailConfig())
+
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("OK"))
 	})
 	http.HandleFunc("/auth/register", middleware.CORSMiddleWare(middleware.RateLimitMiddleware("auth", 3, 20*time.Second)(handlers.RegisterHandler)))
 	http.HandleFunc("/auth/login", middleware.CORSMiddleWare(middleware.RateLimitMiddleware("auth", 5, 12*time.Second)(handlers.LoginHandler)))
 	http.HandleFunc("/profile", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ProfileHandler)))
-	http.HandleFunc("/accounts/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.GetAccountsByUserIDHandler)))
+	http.HandleFunc("/profile/password", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ChangePasswordHandler)))
+	http.HandleFunc("/profile/default-account", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.SetDefaultAccountHandler)))
+	http.HandleFunc("/accounts/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.AccountPathHandler)))
 	http.HandleFunc("/accounts", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.AccountsHandler)))
+	http.HandleFunc("/admin/accounts/", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.AdminAccountHandler)))
+	http.HandleFunc("/admin/adjustments", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.AdjustmentsHandler)))
+	http.HandleFunc("/admin/adjustments/", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.AdjustmentHandler)))
+	http.HandleFunc("/admin/holds/", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.AdminHoldHandler)))
+	http.HandleFunc("/admin/reviews", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.ReviewItemsHandler)))
+	http.HandleFunc("/admin/reviews/", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.ReviewItemHandler)))
+	http.HandleFunc("/admin/risk-assessments", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.RiskAssessmentsHandler)))
+	http.HandleFunc("/admin/statements/issue", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.IssueStatementsHandler)))
+	http.HandleFunc("/admin/inventory", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.InventoryHandler)))
+	http.HandleFunc("/admin/promotions", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.PromotionsHandler)))
+	http.HandleFunc("/admin/promotions/", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.PromotionHandler)))
+	http.HandleFunc("/admin/products/import", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.ProductImportHandler)))
+	http.HandleFunc("/admin/product-reviews", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.AdminProductReviewsHandler)))
+	http.HandleFunc("/admin/product-reviews/", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.AdminProductReviewHandler)))
+	http.HandleFunc("/admin/products/export", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.ProductExportHandler)))
+	http.HandleFunc("/admin/audit", middleware.CORSMiddleWare(middleware.AdminMiddleware(handlers.AuditLogHandler)))
 	http.HandleFunc("/transfer", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.TransferMoneyHandler)))
+	http.HandleFunc("/transfer/preview", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.TransferPreviewHandler)))
+	http.HandleFunc("/transfers/batch", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.TransferBatchHandler)))
+	http.HandleFunc("/transfers/bulk", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.BulkTransfersHandler)))
+	http.HandleFunc("/transfers/bulk/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.GetBulkTransferHandler)))
+	http.HandleFunc("/payees", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.PayeesHandler)))
+	http.HandleFunc("/payees/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.DeletePayeeHandler)))
+	http.HandleFunc("/requests", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.PaymentRequestsHandler)))
+	http.HandleFunc("/requests/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.PaymentRequestHandler)))
+	http.HandleFunc("/scheduled-transfers", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ScheduledTransfersHandler)))
+	http.HandleFunc("/scheduled-transfers/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ScheduledTransferHandler)))
 	http.HandleFunc("/deposit", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.DepositMoney)))
+	http.HandleFunc("/withdraw", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.WithdrawMoney)))
+	http.HandleFunc("/external-transfers", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ExternalTransfersHandler)))
+	http.HandleFunc("/external-transfers/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ExternalTransferHandler)))
+	http.HandleFunc("/holds", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.HoldsHandler)))
+	http.HandleFunc("/holds/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.HoldHandler)))
+	http.HandleFunc("/webhooks/payment-rail", handlers.RailWebhookHandler)
 	http.HandleFunc("/products", middleware.CORSMiddleWare(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
 			handlers.ProductsHandler(w, r)
@@ -262,19 +233,42 @@ func main() {
 		}
 	}))
 	http.HandleFunc("/products/", middleware.CORSMiddleWare(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" {
+		if r.Method == "GET" && !strings.HasSuffix(r.URL.Path, "/inventory-history") {
 			handlers.ProductHandler(w, r)
+		} else if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/reviews") {
+			middleware.AuthMiddleware(handlers.ProductHandler)(w, r)
 		} else {
 			middleware.AdminMiddleware(handlers.ProductHandler)(w, r)
 		}
 	}))
 
+	http.HandleFunc("/media/", middleware.CORSMiddleWare(handlers.MediaHandler))
+
 	http.HandleFunc("/purchase", middleware.CORSMiddleWare(middleware.RateLimitMiddleware("purchase", 10, 6*time.Second)(middleware.AuthMiddleware(handlers.PurchaseProductHandler))))
+	http.HandleFunc("/reservations", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ReservationsHandler)))
+	http.HandleFunc("/reservations/", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.ReservationHandler)))
 	http.HandleFunc("/purchases", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.GetPurchaseHistoryHandler)))
 	http.HandleFunc("/users", middleware.CORSMiddleWare(middleware.AuthMiddleware(handlers.GetAllUsersHandler)))
 
 	log.Println("HTTP server listening on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	if err := http.ListenAndServe(":8080", middleware.AuditMiddleware(http.DefaultServeMux)); err != nil {
 		log.Fatalf("server stopped: %v", err)
 	}
 }
+
+// verifyAuditLog checks the audit hash chain, prints the result and exits
+// non-zero if it has been tampered with.
+func verifyAuditLog(ctx context.Context) {
+	result, err := services.VerifyAuditChain(ctx)
+	if err != nil {
+		log.Fatalf("failed to verify audit log: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+
+	if !result.Valid {
+		os.Exit(1)
+	}
+}
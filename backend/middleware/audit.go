@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"banking-ecommerce-api/services"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// AuditMiddleware records every state-changing request in the audit log.
+// The intent to handle it is appended first, and a request whose intent
+// cannot be recorded is refused, so nothing changes without a trace in the
+// chain. Once it has been handled its outcome is appended, whatever it was,
+// unless the handler wrote it together with its change. Handlers describe
+// the action, target and snapshots through the services.Audit* helpers;
+// otherwise the method and path stand in for the action. Each request is
+// tagged with an X-Request-ID, taken from the client when given.
+func AuditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		record := &services.AuditRecord{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			IP:        getClientIP(r),
+			RequestID: requestID,
+		}
+		if err := services.RecordAuditIntent(r.Context(), record); err != nil {
+			log.Printf("audit: request %s: recording intent: %v", requestID, err)
+			http.Error(w, "Failed to record request in audit log", http.StatusServiceUnavailable)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(services.WithAuditRecord(r.Context(), record)))
+
+		// The response has been sent, so a failure here can no longer fail
+		// the request; the intent already on the chain shows the outcome is
+		// missing, and VerifyAuditChain reports it.
+		if err := services.RecordAudit(context.WithoutCancel(r.Context()), record, recorder.status); err != nil {
+			log.Printf("audit: request %s: recording outcome: %v", requestID, err)
+		}
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -37,6 +37,8 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		services.AuditActor(r.Context(), claims.UserID, claims.Role)
+
 		ctx := context.WithValue(r.Context(), ClaimsKey, claims)
 		r = r.WithContext(ctx)
 
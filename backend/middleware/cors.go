@@ -5,8 +5,9 @@ import "net/http"
 func CORSMiddleWare(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173" )
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS" )
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization" )
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS" )
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match" )
+		w.Header().Set("Access-Control-Expose-Headers", "ETag" )
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
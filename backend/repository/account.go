@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -13,17 +14,65 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+const (
+	AccountTypeChecking = "checking"
+	AccountTypeSavings  = "savings"
+)
+
+// Account is a bank account. Balance is the ledger balance and may go negative
+// down to -OverdraftLimit; Held is the total of active holds and pending
+// withdrawals, which is reserved but not yet debited.
+// AccruedInterestMicros holds interest accrued but not yet posted, in
+// millionths of a minor unit (negative for overdraft interest), and
+// AccruedFees holds unposted overdraft fees; LastAccrualDate and
+// LastInterestPosting ("2006-01-02" and "2006-01") let the accrual job resume
+// without double-crediting. Version counts admin edits to the account's
+// settings and is served as its ETag.
 type Account struct {
-	ID          string    `json:"id" dynamodbav:"id"`
-	UserID      string    `json:"user_id" dynamodbav:"user_id"`
-	AccountName string    `json:"account_name" dynamodbav:"account_name"`
-	Balance     int64     `json:"balance" dynamodbav:"balance"`
-	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
+	ID                    string    `json:"id" dynamodbav:"id"`
+	UserID                string    `json:"user_id" dynamodbav:"user_id"`
+	AccountName           string    `json:"account_name" dynamodbav:"account_name"`
+	AccountType           string    `json:"account_type" dynamodbav:"account_type"`
+	Balance               int64     `json:"balance" dynamodbav:"balance"`
+	Held                  int64     `json:"held" dynamodbav:"held"`
+	OverdraftLimit        int64     `json:"overdraft_limit" dynamodbav:"overdraft_limit"`
+	AccruedInterestMicros int64     `json:"accrued_interest_micros,omitempty" dynamodbav:"accrued_interest_micros,omitempty"`
+	AccruedFees           int64     `json:"accrued_fees,omitempty" dynamodbav:"accrued_fees,omitempty"`
+	LastAccrualDate       string    `json:"last_accrual_date,omitempty" dynamodbav:"last_accrual_date,omitempty"`
+	LastInterestPosting   string    `json:"last_interest_posting,omitempty" dynamodbav:"last_interest_posting,omitempty"`
+	Version               int64     `json:"version" dynamodbav:"version"`
+	CreatedAt             time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+// Type returns the account type, treating accounts created before account
+// types existed as checking accounts.
+func (a Account) Type() string {
+	if a.AccountType == "" {
+		return AccountTypeChecking
+	}
+	return a.AccountType
+}
+
+// AvailableBalance is what can be spent: the balance less held funds, plus any
+// overdraft.
+func (a Account) AvailableBalance() int64 {
+	return a.Balance - a.Held + a.OverdraftLimit
+}
+
+// MarshalJSON adds the derived available balance alongside the ledger balance.
+func (a Account) MarshalJSON() ([]byte, error) {
+	type account Account
+	return json.Marshal(struct {
+		account
+		AvailableBalance int64 `json:"available_balance"`
+	}{account(a), a.AvailableBalance()})
 }
 
 var (
 	ErrAccountNotFound     = errors.New("account not found")
 	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrTransferConflict    = errors.New("transfer precondition failed")
+	ErrTransferInterrupted = errors.New("transfer interrupted, try again")
 )
 
 // CreateAccount persists a new bank account for the user.
@@ -77,6 +126,83 @@ func GetAccountsByUserID(ctx context.Context, userID string) ([]Account, error)
 	return accounts, nil
 }
 
+// GetAllAccounts scans every account.
+func GetAllAccounts(ctx context.Context) ([]Account, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(accountsTable),
+	}
+
+	var accounts []Account
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("scan accounts: %w", err)
+		}
+
+		var page []Account
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal accounts: %w", err)
+		}
+		accounts = append(accounts, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return accounts, nil
+}
+
+// GetAccountsForAccrual scans accounts that accrue interest: those of the
+// given types plus any account with an overdraft or a negative balance.
+func GetAccountsForAccrual(ctx context.Context, accountTypes []string) ([]Account, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]types.AttributeValue{
+		":zero": &types.AttributeValueMemberN{Value: "0"},
+	}
+	filter := "overdraft_limit > :zero OR balance < :zero"
+	if len(accountTypes) > 0 {
+		filter = inCondition("account_type", accountTypes, values) + " OR " + filter
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(accountsTable),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+	}
+
+	var accounts []Account
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("scan accounts: %w", err)
+		}
+
+		var page []Account
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal accounts: %w", err)
+		}
+		accounts = append(accounts, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return accounts, nil
+}
+
 // GetAccountByID fetches a single account.
 func GetAccountByID(ctx context.Context, id string) (Account, error) {
 	client, err := getClient()
@@ -106,50 +232,71 @@ func GetAccountByID(ctx context.Context, id string) (Account, error) {
 	return account, nil
 }
 
-// TransferMoney moves funds atomically between two accounts.
-func TransferMoney(ctx context.Context, fromAccountID, toAccountID string, amount int64) error {
+// TransferMoney moves funds atomically between two accounts, recording a
+// "transfer" transaction on each side. Any extra items are written in the same
+// transaction, which lets callers attach idempotency records; if one of their
+// conditions fails the transfer is rejected with ErrTransferConflict. A
+// transaction cancelled for any other reason, such as a conflicting write,
+// fails with ErrTransferInterrupted and can be retried as is.
+func TransferMoney(ctx context.Context, fromAccountID, toAccountID string, amount int64, extra ...types.TransactWriteItem) error {
 	client, err := getClient()
 	if err != nil {
 		return err
 	}
 
+	fromAccount, err := GetAccountByID(ctx, fromAccountID)
+	if err != nil {
+		return err
+	}
+
+	toAccount, err := GetAccountByID(ctx, toAccountID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	records, err := transferRecords("transfer_"+strconv.FormatInt(now.UnixNano(), 10), fromAccount, toAccount, amount, now)
+	if err != nil {
+		return err
+	}
+
 	amountValue := &types.AttributeValueMemberN{Value: strconv.FormatInt(amount, 10)}
 
-	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []types.TransactWriteItem{
-			{
-				Update: &types.Update{
-					TableName:           aws.String(accountsTable),
-					Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: fromAccountID}},
-					UpdateExpression:    aws.String("SET balance = balance - :amount"),
-					ConditionExpression: aws.String("attribute_exists(id) AND balance >= :amount"),
-					ExpressionAttributeValues: map[string]types.AttributeValue{
-						":amount": amountValue,
-					},
-				},
-			},
-			{
-				Update: &types.Update{
-					TableName:           aws.String(accountsTable),
-					Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: toAccountID}},
-					UpdateExpression:    aws.String("SET balance = balance + :amount"),
-					ConditionExpression: aws.String("attribute_exists(id)"),
-					ExpressionAttributeValues: map[string]types.AttributeValue{
-						":amount": amountValue,
-					},
+	items := []types.TransactWriteItem{
+		{Update: debitUpdate(fromAccount, amount)},
+		{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: toAccountID}},
+				UpdateExpression:    aws.String("SET balance = balance + :amount"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":amount": amountValue,
 				},
 			},
 		},
-	})
+	}
+	items = append(items, records...)
+	items = append(items, extra...)
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
 	if err != nil {
 		var txCancel *types.TransactionCanceledException
 		if errors.As(err, &txCancel) {
-			for _, reason := range txCancel.CancellationReasons {
-				if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
+			for i, reason := range txCancel.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				switch {
+				case i == 0:
 					return ErrInsufficientBalance
+				case i == 1:
+					return ErrAccountNotFound
+				default:
+					return ErrTransferConflict
 				}
 			}
-			return ErrAccountNotFound
+			return ErrTransferInterrupted
 		}
 		return fmt.Errorf("transfer money: %w", err)
 	}
@@ -157,30 +304,140 @@ func TransferMoney(ctx context.Context, fromAccountID, toAccountID string, amoun
 	return nil
 }
 
-// DepositMoney increments an account balance within a transaction.
-func DepositMoney(ctx context.Context, accountID string, amount int64) error {
+// transferRecords builds the puts of the "transfer" transactions recorded on
+// each side of a transfer, with IDs derived from id.
+func transferRecords(id string, from, to Account, amount int64, now time.Time) ([]types.TransactWriteItem, error) {
+	records := []Transaction{
+		{
+			ID:              id + "_out",
+			UserID:          from.UserID,
+			AccountID:       from.ID,
+			TotalAmount:     amount,
+			TransactionType: "transfer",
+			Direction:       "debit",
+			Counterparty:    to.ID,
+			CreatedAt:       now,
+		},
+		{
+			ID:              id + "_in",
+			UserID:          to.UserID,
+			AccountID:       to.ID,
+			TotalAmount:     amount,
+			TransactionType: "transfer",
+			Direction:       "credit",
+			Counterparty:    from.ID,
+			CreatedAt:       now,
+		},
+	}
+
+	items := make([]types.TransactWriteItem, len(records))
+	for i, record := range records {
+		item, err := attributevalue.MarshalMap(record)
+		if err != nil {
+			return nil, fmt.Errorf("marshal transaction: %w", err)
+		}
+		items[i] = types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(transactionsTable),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		}
+	}
+	return items, nil
+}
+
+// debitUpdate builds the update that takes amount out of an account's
+// available balance.
+func debitUpdate(account Account, amount int64) *types.Update {
+	values := map[string]types.AttributeValue{
+		":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(amount, 10)},
+	}
+
+	return &types.Update{
+		TableName:                 aws.String(accountsTable),
+		Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: account.ID}},
+		UpdateExpression:          aws.String("SET balance = balance - :amount"),
+		ConditionExpression:       aws.String(availableCondition(account, amount, values)),
+		ExpressionAttributeValues: values,
+	}
+}
+
+// holdUpdate builds the update that reserves amount of an account's available
+// balance without moving it.
+func holdUpdate(account Account, amount int64) *types.Update {
+	values := map[string]types.AttributeValue{
+		":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(amount, 10)},
+	}
+
+	return &types.Update{
+		TableName:                 aws.String(accountsTable),
+		Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: account.ID}},
+		UpdateExpression:          aws.String("ADD held :amount"),
+		ConditionExpression:       aws.String(availableCondition(account, amount, values)),
+		ExpressionAttributeValues: values,
+	}
+}
+
+// availableCondition requires amount to fit in the account's available
+// balance, letting the balance fall as low as its overdraft limit. DynamoDB
+// conditions cannot do arithmetic, so the held amount and limit read by the
+// caller are pinned in the condition and a concurrent change to either fails
+// the update instead of being ignored.
+func availableCondition(account Account, amount int64, values map[string]types.AttributeValue) string {
+	values[":required"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(amount+account.Held-account.OverdraftLimit, 10)}
+
+	return "attribute_exists(id) AND balance >= :required" +
+		pinCondition("overdraft_limit", ":limit", account.OverdraftLimit, values) +
+		pinCondition("held", ":held", account.Held, values)
+}
+
+func pinCondition(attr, placeholder string, value int64, values map[string]types.AttributeValue) string {
+	if value > 0 {
+		values[placeholder] = &types.AttributeValueMemberN{Value: strconv.FormatInt(value, 10)}
+		return " AND " + attr + " = " + placeholder
+	}
+
+	values[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+	return " AND (attribute_not_exists(" + attr + ") OR " + attr + " <= :zero)"
+}
+
+// SetOverdraftLimit grants, changes or (with a zero limit) revokes an
+// account's overdraft. When accrualFrom is set and the account has not
+// accrued since, its accrual date is moved forward so overdraft interest is
+// not charged retroactively. The account must still be at version.
+func SetOverdraftLimit(ctx context.Context, accountID string, limit int64, accrualFrom string, version int64) error {
 	client, err := getClient()
 	if err != nil {
 		return err
 	}
 
-	amountValue := &types.AttributeValueMemberN{Value: strconv.FormatInt(amount, 10)}
+	update := "SET overdraft_limit = :limit"
+	values := map[string]types.AttributeValue{
+		":limit": &types.AttributeValueMemberN{Value: strconv.FormatInt(limit, 10)},
+	}
+	if accrualFrom != "" {
+		update += ", last_accrual_date = :accrualFrom"
+		values[":accrualFrom"] = &types.AttributeValueMemberS{Value: accrualFrom}
+	}
+	condition, setVersion := versionUpdate(version, values)
 
 	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(accountsTable),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: accountID},
 		},
-		UpdateExpression:          aws.String("SET balance = balance + :amount"),
-		ConditionExpression:       aws.String("attribute_exists(id)"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{":amount": amountValue},
+		UpdateExpression:                    aws.String(update + ", " + setVersion),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 	if err != nil {
 		var ccf *types.ConditionalCheckFailedException
 		if errors.As(err, &ccf) {
-			return ErrAccountNotFound
+			return versionFailure(ccf, ErrAccountNotFound)
 		}
-		return fmt.Errorf("deposit money: %w", err)
+		return fmt.Errorf("set overdraft limit: %w", err)
 	}
 
 	return nil
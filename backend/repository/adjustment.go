@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	AdjustmentCredit = "credit"
+	AdjustmentDebit  = "debit"
+
+	AdjustmentStatusPending  = "pending"
+	AdjustmentStatusApproved = "approved"
+	AdjustmentStatusRejected = "rejected"
+)
+
+// AdjustmentReasonCodes are the accepted reasons for a manual adjustment.
+var AdjustmentReasonCodes = map[string]bool{
+	"error_correction": true,
+	"fee_refund":       true,
+	"goodwill":         true,
+	"chargeback":       true,
+	"fraud_recovery":   true,
+	"other":            true,
+}
+
+// Adjustment is a manual credit or debit proposed by one admin. It only
+// reaches the account once a different admin approves it.
+type Adjustment struct {
+	ID         string    `json:"id" dynamodbav:"id"`
+	AccountID  string    `json:"account_id" dynamodbav:"account_id"`
+	UserID     string    `json:"user_id" dynamodbav:"user_id"`
+	Type       string    `json:"type" dynamodbav:"type"`
+	Amount     int64     `json:"amount" dynamodbav:"amount"`
+	ReasonCode string    `json:"reason_code" dynamodbav:"reason_code"`
+	Note       string    `json:"note" dynamodbav:"note"`
+	Status     string    `json:"status" dynamodbav:"status"`
+	ProposedBy string    `json:"proposed_by" dynamodbav:"proposed_by"`
+	ReviewedBy string    `json:"reviewed_by,omitempty" dynamodbav:"reviewed_by,omitempty"`
+	ReviewNote string    `json:"review_note,omitempty" dynamodbav:"review_note,omitempty"`
+	CreatedAt  time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+var (
+	ErrAdjustmentNotFound     = errors.New("adjustment not found")
+	ErrAdjustmentClosed       = errors.New("adjustment is no longer pending")
+	ErrAdjustmentSelfApproval = errors.New("adjustment cannot be approved by its proposer")
+)
+
+// CreateAdjustment persists a pending adjustment together with its audit
+// event. It fails with ErrAuditHeadMoved if the event needs re-linking.
+func CreateAdjustment(ctx context.Context, adjustment Adjustment, event AuditEvent) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(adjustment)
+	if err != nil {
+		return fmt.Errorf("marshal adjustment: %w", err)
+	}
+
+	audit, err := auditItems(event)
+	if err != nil {
+		return err
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:           aws.String(adjustmentsTable),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+	}
+	items = append(items, audit...)
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && auditHeadMoved(txCancel) {
+			return ErrAuditHeadMoved
+		}
+		return fmt.Errorf("create adjustment: %w", err)
+	}
+
+	return nil
+}
+
+// GetAdjustmentByID fetches a single adjustment.
+func GetAdjustmentByID(ctx context.Context, id string) (Adjustment, error) {
+	client, err := getClient()
+	if err != nil {
+		return Adjustment{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(adjustmentsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Adjustment{}, fmt.Errorf("get adjustment: %w", err)
+	}
+
+	if out.Item == nil {
+		return Adjustment{}, ErrAdjustmentNotFound
+	}
+
+	var adjustment Adjustment
+	if err := attributevalue.UnmarshalMap(out.Item, &adjustment); err != nil {
+		return Adjustment{}, fmt.Errorf("unmarshal adjustment: %w", err)
+	}
+
+	return adjustment, nil
+}
+
+// GetAdjustmentsByStatus lists adjustments with the given status, oldest
+// first.
+func GetAdjustmentsByStatus(ctx context.Context, status string) ([]Adjustment, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(adjustmentsTable),
+		IndexName:              aws.String("status-created_at-index"),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+		},
+	}
+
+	var adjustments []Adjustment
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query adjustments: %w", err)
+		}
+
+		var page []Adjustment
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal adjustments: %w", err)
+		}
+		adjustments = append(adjustments, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return adjustments, nil
+}
+
+// ApproveAdjustment marks a pending adjustment approved by reviewerID and posts
+// it to the account as an "adjustment" transaction, all in one transaction
+// with its audit event. Debits are applied to the ledger balance as-is, since
+// a correction must not be blocked by holds or the overdraft limit.
+func ApproveAdjustment(ctx context.Context, adjustment Adjustment, reviewerID, note string, now time.Time, event AuditEvent) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	delta := adjustment.Amount
+	if adjustment.Type == AdjustmentDebit {
+		delta = -delta
+	}
+
+	txnItem, err := attributevalue.MarshalMap(Transaction{
+		ID:              "adjustment_" + adjustment.ID,
+		UserID:          adjustment.UserID,
+		AccountID:       adjustment.AccountID,
+		TotalAmount:     adjustment.Amount,
+		TransactionType: "adjustment",
+		Direction:       adjustment.Type,
+		CreatedAt:       now,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal transaction: %w", err)
+	}
+
+	err = reviewAdjustment(ctx, client, adjustment.ID, AdjustmentStatusApproved, reviewerID, note, now, event,
+		types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: adjustment.AccountID}},
+				UpdateExpression:    aws.String("SET balance = balance + :delta"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(delta, 10)},
+				},
+			},
+		},
+		types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(transactionsTable),
+				Item:                txnItem,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+	)
+
+	var txCancel *types.TransactionCanceledException
+	if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 1 {
+		if code := txCancel.CancellationReasons[1].Code; code != nil && *code == "ConditionalCheckFailed" {
+			return ErrAccountNotFound
+		}
+	}
+	return err
+}
+
+// RejectAdjustment marks a pending adjustment rejected without posting it, in
+// one transaction with its audit event.
+func RejectAdjustment(ctx context.Context, adjustment Adjustment, reviewerID, note string, now time.Time, event AuditEvent) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	return reviewAdjustment(ctx, client, adjustment.ID, AdjustmentStatusRejected, reviewerID, note, now, event)
+}
+
+// reviewAdjustment moves an adjustment out of pending, appending its audit
+// event after the extra writes. The proposer can never approve their own
+// adjustment, which is enforced in the condition so it holds even if the
+// caller skips the check. It fails with ErrAuditHeadMoved if the event needs
+// re-linking.
+func reviewAdjustment(ctx context.Context, client *dynamodb.Client, id, status, reviewerID, note string, now time.Time, event AuditEvent, extra ...types.TransactWriteItem) error {
+	audit, err := auditItems(event)
+	if err != nil {
+		return err
+	}
+
+	condition := "#status = :pending"
+	if status == AdjustmentStatusApproved {
+		condition += " AND proposed_by <> :reviewer"
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(adjustmentsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+				UpdateExpression:    aws.String("SET #status = :status, reviewed_by = :reviewer, review_note = :note, updated_at = :updated"),
+				ConditionExpression: aws.String(condition),
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":status":   &types.AttributeValueMemberS{Value: status},
+					":pending":  &types.AttributeValueMemberS{Value: AdjustmentStatusPending},
+					":reviewer": &types.AttributeValueMemberS{Value: reviewerID},
+					":note":     &types.AttributeValueMemberS{Value: note},
+					":updated":  &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+				},
+			},
+		},
+	}
+	items = append(items, extra...)
+	items = append(items, audit...)
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 0 {
+			if code := txCancel.CancellationReasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+				current, getErr := GetAdjustmentByID(ctx, id)
+				if getErr == nil && current.Status == AdjustmentStatusPending {
+					return ErrAdjustmentSelfApproval
+				}
+				return ErrAdjustmentClosed
+			}
+			if auditHeadMoved(txCancel) {
+				return ErrAuditHeadMoved
+			}
+		}
+		return fmt.Errorf("review adjustment: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AuditChain is the single chain every audit event is appended to.
+const AuditChain = "main"
+
+// AuditEvent records a state-changing request: who did what to which entity,
+// with JSON snapshots of the entity before and after. Events form a hash
+// chain ordered by Seq: Hash covers the event and PrevHash, the previous
+// event's Hash, so editing or removing any event breaks every later link.
+// An event with a zero Status is a request's intent, appended before it is
+// handled; its outcome is a later event with the same RequestID.
+type AuditEvent struct {
+	Chain      string    `json:"-" dynamodbav:"chain"`
+	Seq        int64     `json:"seq" dynamodbav:"seq"`
+	ActorID    string    `json:"actor_id" dynamodbav:"actor_id"`
+	ActorRole  string    `json:"actor_role" dynamodbav:"actor_role"`
+	Action     string    `json:"action" dynamodbav:"action"`
+	TargetType string    `json:"target_type" dynamodbav:"target_type"`
+	TargetID   string    `json:"target_id" dynamodbav:"target_id"`
+	Before     string    `json:"before" dynamodbav:"before"`
+	After      string    `json:"after" dynamodbav:"after"`
+	Method     string    `json:"method" dynamodbav:"method"`
+	Path       string    `json:"path" dynamodbav:"path"`
+	Status     int       `json:"status" dynamodbav:"status"`
+	IP         string    `json:"ip" dynamodbav:"ip"`
+	RequestID  string    `json:"request_id" dynamodbav:"request_id"`
+	CreatedAt  time.Time `json:"created_at" dynamodbav:"created_at"`
+	PrevHash   string    `json:"prev_hash" dynamodbav:"prev_hash"`
+	Hash       string    `json:"hash" dynamodbav:"hash"`
+}
+
+// AuditHead is the latest link of an audit chain. A zero Seq means the chain
+// is empty.
+type AuditHead struct {
+	Chain string `json:"chain" dynamodbav:"chain"`
+	Seq   int64  `json:"seq" dynamodbav:"seq"`
+	Hash  string `json:"hash" dynamodbav:"hash"`
+}
+
+// AuditFilter narrows an audit query. Empty fields match everything; a zero
+// BeforeSeq starts from the newest event.
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+	BeforeSeq  int64
+	Limit      int
+}
+
+var ErrAuditHeadMoved = errors.New("audit chain head moved")
+
+// GetAuditHead returns the latest link of the chain.
+func GetAuditHead(ctx context.Context, chain string) (AuditHead, error) {
+	client, err := getClient()
+	if err != nil {
+		return AuditHead{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(auditHeadsTable),
+		Key: map[string]types.AttributeValue{
+			"chain": &types.AttributeValueMemberS{Value: chain},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return AuditHead{}, fmt.Errorf("get audit head: %w", err)
+	}
+
+	head := AuditHead{Chain: chain}
+	if out.Item == nil {
+		return head, nil
+	}
+
+	if err := attributevalue.UnmarshalMap(out.Item, &head); err != nil {
+		return AuditHead{}, fmt.Errorf("unmarshal audit head: %w", err)
+	}
+
+	return head, nil
+}
+
+// AppendAuditEvent writes an event and advances the chain head to it in one
+// transaction. It fails with ErrAuditHeadMoved if the head is no longer at
+// event.Seq-1, in which case the caller should re-link and retry. Events are
+// never updated or deleted once written.
+func AppendAuditEvent(ctx context.Context, event AuditEvent) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	items, err := auditItems(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			return ErrAuditHeadMoved
+		}
+		return fmt.Errorf("append audit event: %w", err)
+	}
+
+	return nil
+}
+
+// auditItems are the writes appending event to its chain: the head update,
+// conditional on the head still being at event.Seq-1, then the event itself.
+// Adding them to the transaction that makes an audited change records the
+// change and its event together or not at all.
+func auditItems(event AuditEvent) ([]types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return nil, fmt.Errorf("marshal audit event: %w", err)
+	}
+
+	headCondition := "seq = :prev"
+	if event.Seq == 1 {
+		headCondition = "attribute_not_exists(chain)"
+	}
+
+	return []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(auditHeadsTable),
+				Key:                 map[string]types.AttributeValue{"chain": &types.AttributeValueMemberS{Value: event.Chain}},
+				UpdateExpression:    aws.String("SET seq = :seq, #hash = :hash"),
+				ConditionExpression: aws.String(headCondition),
+				ExpressionAttributeNames: map[string]string{
+					"#hash": "hash",
+				},
+				ExpressionAttributeValues: auditHeadValues(event),
+			},
+		},
+		{
+			Put: &types.Put{
+				TableName:           aws.String(auditTable),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(seq)"),
+			},
+		},
+	}, nil
+}
+
+// auditHeadMoved reports whether a transaction ending in auditItems was
+// cancelled because the chain head moved.
+func auditHeadMoved(txCancel *types.TransactionCanceledException) bool {
+	reasons := txCancel.CancellationReasons
+	if len(reasons) < 2 {
+		return false
+	}
+	code := reasons[len(reasons)-2].Code
+	return code != nil && *code == "ConditionalCheckFailed"
+}
+
+func auditHeadValues(event AuditEvent) map[string]types.AttributeValue {
+	values := map[string]types.AttributeValue{
+		":seq":  &types.AttributeValueMemberN{Value: strconv.FormatInt(event.Seq, 10)},
+		":hash": &types.AttributeValueMemberS{Value: event.Hash},
+	}
+	if event.Seq > 1 {
+		values[":prev"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(event.Seq-1, 10)}
+	}
+	return values
+}
+
+// QueryAuditEvents returns up to filter.Limit matching events, newest first.
+func QueryAuditEvents(ctx context.Context, chain string, filter AuditFilter) ([]AuditEvent, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	keyCondition := "chain = :chain"
+	values := map[string]types.AttributeValue{
+		":chain": &types.AttributeValueMemberS{Value: chain},
+	}
+	if filter.BeforeSeq > 0 {
+		keyCondition += " AND seq < :before"
+		values[":before"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(filter.BeforeSeq, 10)}
+	}
+
+	var filters []string
+	addFilter := func(attr, placeholder, op string, value types.AttributeValue) {
+		filters = append(filters, attr+" "+op+" "+placeholder)
+		values[placeholder] = value
+	}
+	if filter.ActorID != "" {
+		addFilter("actor_id", ":actor", "=", &types.AttributeValueMemberS{Value: filter.ActorID})
+	}
+	if filter.Action != "" {
+		addFilter("#action", ":action", "=", &types.AttributeValueMemberS{Value: filter.Action})
+	}
+	if filter.TargetType != "" {
+		addFilter("target_type", ":targetType", "=", &types.AttributeValueMemberS{Value: filter.TargetType})
+	}
+	if filter.TargetID != "" {
+		addFilter("target_id", ":targetID", "=", &types.AttributeValueMemberS{Value: filter.TargetID})
+	}
+	if !filter.From.IsZero() {
+		addFilter("created_at", ":from", ">=", &types.AttributeValueMemberS{Value: filter.From.UTC().Format(time.RFC3339Nano)})
+	}
+	if !filter.To.IsZero() {
+		addFilter("created_at", ":to", "<", &types.AttributeValueMemberS{Value: filter.To.UTC().Format(time.RFC3339Nano)})
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(auditTable),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		if filter.Action != "" {
+			input.ExpressionAttributeNames = map[string]string{"#action": "action"}
+		}
+	}
+
+	var events []AuditEvent
+	for len(events) < filter.Limit {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query audit events: %w", err)
+		}
+
+		var page []AuditEvent
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal audit events: %w", err)
+		}
+		events = append(events, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	if len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+
+	return events, nil
+}
+
+// WalkAuditChain calls fn for every event of the chain in sequence order,
+// stopping at the first error.
+func WalkAuditChain(ctx context.Context, chain string, fn func(AuditEvent) error) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(auditTable),
+		KeyConditionExpression: aws.String("chain = :chain"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":chain": &types.AttributeValueMemberS{Value: chain},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return fmt.Errorf("query audit events: %w", err)
+		}
+
+		var page []AuditEvent
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return fmt.Errorf("unmarshal audit events: %w", err)
+		}
+
+		for _, event := range page {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// maxBatchWriteItems is the most requests one BatchWriteItem call takes.
+	maxBatchWriteItems = 25
+
+	// batchWriteAttempts bounds how often a group of puts is sent.
+	batchWriteAttempts = 5
+)
+
+// batchPut is an item to put in table on behalf of owner, the record whose
+// write fails if the put does. Items are told apart by their id key.
+type batchPut struct {
+	table string
+	owner string
+	item  map[string]types.AttributeValue
+}
+
+// batchWrite puts items with BatchWriteItem in groups of 25, resending those
+// the service leaves unprocessed, or all of them after an error, with
+// exponential backoff. It returns the owners of puts that could not be
+// written, each once.
+func batchWrite(ctx context.Context, puts []batchPut) ([]string, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	failed := map[string]bool{}
+	var failedOwners []string
+
+	for start := 0; start < len(puts); start += maxBatchWriteItems {
+		chunk := puts[start:min(start+maxBatchWriteItems, len(puts))]
+
+		requests := map[string][]types.WriteRequest{}
+		owners := map[string]string{}
+		for _, put := range chunk {
+			requests[put.table] = append(requests[put.table], types.WriteRequest{PutRequest: &types.PutRequest{Item: put.item}})
+			owners[put.table+"/"+itemID(put.item)] = put.owner
+		}
+
+		for attempt := 1; len(requests) > 0; attempt++ {
+			if attempt > batchWriteAttempts {
+				for table, pending := range requests {
+					for _, request := range pending {
+						owner := owners[table+"/"+itemID(request.PutRequest.Item)]
+						if !failed[owner] {
+							failed[owner] = true
+							failedOwners = append(failedOwners, owner)
+						}
+					}
+				}
+				break
+			}
+			if attempt > 1 {
+				select {
+				case <-ctx.Done():
+					return nil, fmt.Errorf("batch write: %w", ctx.Err())
+				case <-time.After(25 * time.Millisecond << attempt):
+				}
+			}
+
+			out, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: requests})
+			if err != nil {
+				log.Printf("batch write attempt %d: %v", attempt, err)
+				continue
+			}
+			requests = out.UnprocessedItems
+		}
+	}
+
+	return failedOwners, nil
+}
+
+// itemID is the id key of an item.
+func itemID(item map[string]types.AttributeValue) string {
+	if id, ok := item["id"].(*types.AttributeValueMemberS); ok {
+		return id.Value
+	}
+	return ""
+}
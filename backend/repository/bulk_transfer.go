@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	BulkStatusPending   = "pending"
+	BulkStatusCompleted = "completed"
+
+	BulkItemPending       = "pending"
+	BulkItemCompleted     = "completed"
+	BulkItemFailed        = "failed"
+	BulkItemPendingReview = "pending_review"
+)
+
+// MaxTransactItems is DynamoDB's limit on operations in one transaction.
+const MaxTransactItems = 100
+
+// BulkTransferItem is one transfer in a bulk transfer, with its own status.
+type BulkTransferItem struct {
+	ToAccountID string `json:"to_account_id" dynamodbav:"to_account_id"`
+	Amount      int64  `json:"amount" dynamodbav:"amount"`
+	Reference   string `json:"reference,omitempty" dynamodbav:"reference,omitempty"`
+	Status      string `json:"status" dynamodbav:"status"`
+	TransferID  string `json:"transfer_id,omitempty" dynamodbav:"transfer_id,omitempty"`
+	ReviewID    string `json:"review_id,omitempty" dynamodbav:"review_id,omitempty"`
+	Error       string `json:"error,omitempty" dynamodbav:"error,omitempty"`
+}
+
+// BulkTransfer is a set of transfers out of one account, executed in the
+// background. Items are stored inline so each one's status can be changed in
+// the same transaction that moves its money.
+type BulkTransfer struct {
+	ID             string             `json:"id" dynamodbav:"id"`
+	UserID         string             `json:"user_id" dynamodbav:"user_id"`
+	FromAccountID  string             `json:"from_account_id" dynamodbav:"from_account_id"`
+	IdempotencyKey string             `json:"idempotency_key,omitempty" dynamodbav:"idempotency_key,omitempty"`
+	Status         string             `json:"status" dynamodbav:"status"`
+	Items          []BulkTransferItem `json:"items" dynamodbav:"items"`
+	CreatedAt      time.Time          `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+var (
+	ErrBulkTransferNotFound = errors.New("bulk transfer not found")
+	ErrBulkTransferExists   = errors.New("bulk transfer already exists")
+	ErrBulkItemsClosed      = errors.New("bulk transfer items are no longer pending")
+)
+
+// BulkTransferID is the ID of the transfer made for item index of a bulk
+// transfer.
+func BulkTransferID(bulkID string, index int) string {
+	return "transfer_" + bulkID + "_" + strconv.Itoa(index)
+}
+
+// CreateBulkTransfer persists a new bulk transfer, or returns
+// ErrBulkTransferExists if its ID is taken.
+func CreateBulkTransfer(ctx context.Context, bulk BulkTransfer) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(bulk)
+	if err != nil {
+		return fmt.Errorf("marshal bulk transfer: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(bulkTransfersTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrBulkTransferExists
+		}
+		return fmt.Errorf("put bulk transfer: %w", err)
+	}
+
+	return nil
+}
+
+// GetBulkTransferByID fetches a single bulk transfer.
+func GetBulkTransferByID(ctx context.Context, id string) (BulkTransfer, error) {
+	client, err := getClient()
+	if err != nil {
+		return BulkTransfer{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(bulkTransfersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return BulkTransfer{}, fmt.Errorf("get bulk transfer: %w", err)
+	}
+
+	if out.Item == nil {
+		return BulkTransfer{}, ErrBulkTransferNotFound
+	}
+
+	var bulk BulkTransfer
+	if err := attributevalue.UnmarshalMap(out.Item, &bulk); err != nil {
+		return BulkTransfer{}, fmt.Errorf("unmarshal bulk transfer: %w", err)
+	}
+
+	return bulk, nil
+}
+
+// GetPendingBulkTransferIDs lists bulk transfers that still have work to do,
+// oldest first.
+func GetPendingBulkTransferIDs(ctx context.Context) ([]string, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(bulkTransfersTable),
+		IndexName:              aws.String("status-created_at-index"),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ProjectionExpression:   aws.String("id"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: BulkStatusPending},
+		},
+	}
+
+	var ids []string
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query bulk transfers: %w", err)
+		}
+
+		var page []struct {
+			ID string `dynamodbav:"id"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal bulk transfers: %w", err)
+		}
+		for _, bulk := range page {
+			ids = append(ids, bulk.ID)
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return ids, nil
+}
+
+// BulkChunkSize reports how many operations executing the given items in one
+// transaction takes: the debit, the bulk transfer's status update, one credit
+// per distinct recipient and two transaction records per item.
+func BulkChunkSize(bulk BulkTransfer, indexes []int) int {
+	recipients := map[string]bool{}
+	for _, i := range indexes {
+		recipients[bulk.Items[i].ToAccountID] = true
+	}
+	return 2 + len(recipients) + 2*len(indexes)
+}
+
+// ExecuteBulkTransferChunk moves the money for the given pending items in a
+// single transaction: one debit of their total from the source account, one
+// credit per recipient, the transfer records, and the items marked completed.
+// Items that are no longer pending fail the whole chunk with
+// ErrBulkItemsClosed, so a chunk can never be executed twice.
+func ExecuteBulkTransferChunk(ctx context.Context, bulk BulkTransfer, from Account, recipients map[string]Account, indexes []int, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	credits := map[string]int64{}
+	var order []string
+	var records []types.TransactWriteItem
+	updates := map[int]BulkTransferItem{}
+	for _, i := range indexes {
+		item := bulk.Items[i]
+		total += item.Amount
+		if _, ok := credits[item.ToAccountID]; !ok {
+			order = append(order, item.ToAccountID)
+		}
+		credits[item.ToAccountID] += item.Amount
+
+		puts, err := transferRecords(BulkTransferID(bulk.ID, i), from, recipients[item.ToAccountID], item.Amount, now)
+		if err != nil {
+			return err
+		}
+		records = append(records, puts...)
+
+		item.Status = BulkItemCompleted
+		item.TransferID = BulkTransferID(bulk.ID, i)
+		updates[i] = item
+	}
+
+	itemsUpdate, err := bulkItemsUpdate(bulk.ID, updates, now)
+	if err != nil {
+		return err
+	}
+
+	items := []types.TransactWriteItem{
+		{Update: debitUpdate(from, total)},
+		{Update: itemsUpdate},
+	}
+	for _, id := range order {
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+				UpdateExpression:    aws.String("SET balance = balance + :amount"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(credits[id], 10)},
+				},
+			},
+		})
+	}
+	items = append(items, records...)
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			for i, reason := range txCancel.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				switch {
+				case i == 0:
+					return ErrInsufficientBalance
+				case i == 1:
+					return ErrBulkItemsClosed
+				case i < 2+len(order):
+					return ErrAccountNotFound
+				default:
+					return ErrTransferConflict
+				}
+			}
+		}
+		return fmt.Errorf("execute bulk transfer: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateBulkTransferItems records the outcome of items that did not move money
+// directly, such as failures or ones queued for review. Items must still be
+// pending, otherwise ErrBulkItemsClosed is returned.
+func UpdateBulkTransferItems(ctx context.Context, bulkID string, updates map[int]BulkTransferItem, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	update, err := bulkItemsUpdate(bulkID, updates, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 update.TableName,
+		Key:                       update.Key,
+		UpdateExpression:          update.UpdateExpression,
+		ConditionExpression:       update.ConditionExpression,
+		ExpressionAttributeNames:  update.ExpressionAttributeNames,
+		ExpressionAttributeValues: update.ExpressionAttributeValues,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrBulkItemsClosed
+		}
+		return fmt.Errorf("update bulk transfer items: %w", err)
+	}
+
+	return nil
+}
+
+// CompleteBulkTransfer marks a bulk transfer completed once none of its items
+// are pending.
+func CompleteBulkTransfer(ctx context.Context, bulkID string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(bulkTransfersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: bulkID},
+		},
+		UpdateExpression: aws.String("SET #status = :completed, updated_at = :updated"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":completed": &types.AttributeValueMemberS{Value: BulkStatusCompleted},
+			":updated":   &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("complete bulk transfer: %w", err)
+	}
+
+	return nil
+}
+
+// bulkItemsUpdate builds the update that replaces the given items, each of
+// which must still be pending.
+func bulkItemsUpdate(bulkID string, updates map[int]BulkTransferItem, now time.Time) (*types.Update, error) {
+	sets := []string{"updated_at = :updated"}
+	var conditions []string
+	values := map[string]types.AttributeValue{
+		":updated": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		":pending": &types.AttributeValueMemberS{Value: BulkItemPending},
+	}
+
+	for i, item := range updates {
+		av, err := attributevalue.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("marshal bulk transfer item: %w", err)
+		}
+
+		placeholder := ":item" + strconv.Itoa(i)
+		values[placeholder] = av
+		sets = append(sets, fmt.Sprintf("#items[%d] = %s", i, placeholder))
+		conditions = append(conditions, fmt.Sprintf("#items[%d].#status = :pending", i))
+	}
+
+	return &types.Update{
+		TableName:           aws.String(bulkTransfersTable),
+		Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: bulkID}},
+		UpdateExpression:    aws.String("SET " + strings.Join(sets, ", ")),
+		ConditionExpression: aws.String(strings.Join(conditions, " AND ")),
+		ExpressionAttributeNames: map[string]string{
+			"#items":  "items",
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+	}, nil
+}
+
+// bulkItemReviewed builds the update settling the bulk transfer item a review
+// item was parked for, with the given status and, when set, its transfer ID
+// or error. The item must still be waiting on that review.
+func bulkItemReviewed(review ReviewItem, status, transferID, reason string, now time.Time) *types.Update {
+	item := fmt.Sprintf("#items[%d]", review.BulkItemIndex)
+	sets := []string{item + ".#status = :status", "updated_at = :updated"}
+	values := map[string]types.AttributeValue{
+		":status":    &types.AttributeValueMemberS{Value: status},
+		":in_review": &types.AttributeValueMemberS{Value: BulkItemPendingReview},
+		":review":    &types.AttributeValueMemberS{Value: review.ID},
+		":updated":   &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+	}
+	if transferID != "" {
+		sets = append(sets, item+".transfer_id = :transfer")
+		values[":transfer"] = &types.AttributeValueMemberS{Value: transferID}
+	}
+	names := map[string]string{
+		"#items":  "items",
+		"#status": "status",
+	}
+	if reason != "" {
+		sets = append(sets, item+".#error = :error")
+		values[":error"] = &types.AttributeValueMemberS{Value: reason}
+		names["#error"] = "error"
+	}
+
+	return &types.Update{
+		TableName:                 aws.String(bulkTransfersTable),
+		Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: review.BulkTransferID}},
+		UpdateExpression:          aws.String("SET " + strings.Join(sets, ", ")),
+		ConditionExpression:       aws.String(item + ".#status = :in_review AND " + item + ".review_id = :review"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+}
@@ -0,0 +1,330 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	ExternalDirectionDeposit    = "deposit"
+	ExternalDirectionWithdrawal = "withdrawal"
+
+	ExternalStatusPending = "pending"
+	ExternalStatusSettled = "settled"
+	ExternalStatusFailed  = "failed"
+)
+
+// ExternalTransfer is money moving between an account and the outside world
+// over a payment rail. Deposits only reach the balance once settled; pending
+// withdrawals hold their amount on the account until the rail reports back.
+// Source is the outside account a deposit is pulled from.
+type ExternalTransfer struct {
+	ID            string    `json:"id" dynamodbav:"id"`
+	UserID        string    `json:"user_id" dynamodbav:"user_id"`
+	AccountID     string    `json:"account_id" dynamodbav:"account_id"`
+	Direction     string    `json:"direction" dynamodbav:"direction"`
+	Amount        int64     `json:"amount" dynamodbav:"amount"`
+	Source        string    `json:"source,omitempty" dynamodbav:"source,omitempty"`
+	Status        string    `json:"status" dynamodbav:"status"`
+	Rail          string    `json:"rail" dynamodbav:"rail"`
+	RailReference string    `json:"rail_reference,omitempty" dynamodbav:"rail_reference,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty" dynamodbav:"failure_reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+var (
+	ErrExternalTransferNotFound = errors.New("external transfer not found")
+	ErrExternalTransferClosed   = errors.New("external transfer is no longer pending")
+)
+
+// CreateExternalTransfer persists a new pending transfer. Withdrawals also
+// hold their amount on the account in the same transaction, failing with
+// ErrInsufficientBalance when it is not available.
+func CreateExternalTransfer(ctx context.Context, transfer ExternalTransfer, account Account) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(transfer)
+	if err != nil {
+		return fmt.Errorf("marshal external transfer: %w", err)
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:           aws.String(externalTransfersTable),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+	}
+	if transfer.Direction == ExternalDirectionWithdrawal {
+		items = append(items, types.TransactWriteItem{Update: holdUpdate(account, transfer.Amount)})
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 1 {
+			if code := txCancel.CancellationReasons[1].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return ErrInsufficientBalance
+			}
+		}
+		return fmt.Errorf("create external transfer: %w", err)
+	}
+
+	return nil
+}
+
+// SetExternalTransferReference records the rail's own reference for a transfer.
+func SetExternalTransferReference(ctx context.Context, id, reference string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(externalTransfersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET rail_reference = :reference"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":reference": &types.AttributeValueMemberS{Value: reference},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrExternalTransferNotFound
+		}
+		return fmt.Errorf("set external transfer reference: %w", err)
+	}
+
+	return nil
+}
+
+// GetExternalTransferByID fetches a single external transfer.
+func GetExternalTransferByID(ctx context.Context, id string) (ExternalTransfer, error) {
+	client, err := getClient()
+	if err != nil {
+		return ExternalTransfer{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(externalTransfersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return ExternalTransfer{}, fmt.Errorf("get external transfer: %w", err)
+	}
+
+	if out.Item == nil {
+		return ExternalTransfer{}, ErrExternalTransferNotFound
+	}
+
+	var transfer ExternalTransfer
+	if err := attributevalue.UnmarshalMap(out.Item, &transfer); err != nil {
+		return ExternalTransfer{}, fmt.Errorf("unmarshal external transfer: %w", err)
+	}
+
+	return transfer, nil
+}
+
+// GetExternalTransfersByUserID lists a user's deposits and withdrawals.
+func GetExternalTransfersByUserID(ctx context.Context, userID string) ([]ExternalTransfer, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(externalTransfersTable),
+		IndexName:              aws.String("user_id-index"),
+		KeyConditionExpression: aws.String("user_id = :user"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query external transfers: %w", err)
+	}
+
+	var transfers []ExternalTransfer
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &transfers); err != nil {
+		return nil, fmt.Errorf("unmarshal external transfers: %w", err)
+	}
+
+	return transfers, nil
+}
+
+// GetStalePendingExternalTransfers lists transfers that have been pending
+// since before the cutoff.
+func GetStalePendingExternalTransfers(ctx context.Context, before time.Time) ([]ExternalTransfer, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(externalTransfersTable),
+		FilterExpression:         aws.String("#status = :pending AND created_at < :before"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: ExternalStatusPending},
+			":before":  &types.AttributeValueMemberS{Value: before.UTC().Format(time.RFC3339Nano)},
+		},
+	}
+
+	var transfers []ExternalTransfer
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("scan external transfers: %w", err)
+		}
+
+		var page []ExternalTransfer
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal external transfers: %w", err)
+		}
+		transfers = append(transfers, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return transfers, nil
+}
+
+// SettleExternalTransfer marks a pending transfer settled and applies it to the
+// ledger balance in one transaction: deposits are credited, withdrawals are
+// debited and their hold released. A matching transaction record is written
+// for the account history.
+func SettleExternalTransfer(ctx context.Context, transfer ExternalTransfer, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	amount := strconv.FormatInt(transfer.Amount, 10)
+	accountUpdate := &types.Update{
+		TableName:           aws.String(accountsTable),
+		Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: transfer.AccountID}},
+		UpdateExpression:    aws.String("SET balance = balance + :amount"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":amount": &types.AttributeValueMemberN{Value: amount},
+		},
+	}
+	if transfer.Direction == ExternalDirectionWithdrawal {
+		accountUpdate.UpdateExpression = aws.String("SET balance = balance - :amount ADD held :release")
+		accountUpdate.ExpressionAttributeValues[":release"] = &types.AttributeValueMemberN{Value: "-" + amount}
+	}
+
+	txnItem, err := attributevalue.MarshalMap(Transaction{
+		ID:              transfer.Direction + "_" + transfer.ID,
+		UserID:          transfer.UserID,
+		AccountID:       transfer.AccountID,
+		TotalAmount:     transfer.Amount,
+		TransactionType: transfer.Direction,
+		CreatedAt:       now,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal transaction: %w", err)
+	}
+
+	return closeExternalTransfer(ctx, client, transfer, ExternalStatusSettled, "", now,
+		types.TransactWriteItem{Update: accountUpdate},
+		types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(transactionsTable),
+				Item:                txnItem,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+	)
+}
+
+// FailExternalTransfer marks a pending transfer failed, releasing the hold of
+// a withdrawal.
+func FailExternalTransfer(ctx context.Context, transfer ExternalTransfer, reason string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	var extra []types.TransactWriteItem
+	if transfer.Direction == ExternalDirectionWithdrawal {
+		extra = append(extra, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: transfer.AccountID}},
+				UpdateExpression:    aws.String("ADD held :release"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":release": &types.AttributeValueMemberN{Value: strconv.FormatInt(-transfer.Amount, 10)},
+				},
+			},
+		})
+	}
+
+	return closeExternalTransfer(ctx, client, transfer, ExternalStatusFailed, reason, now, extra...)
+}
+
+func closeExternalTransfer(ctx context.Context, client *dynamodb.Client, transfer ExternalTransfer, status, reason string, now time.Time, extra ...types.TransactWriteItem) error {
+	update := "SET #status = :status, updated_at = :updated"
+	values := map[string]types.AttributeValue{
+		":status":  &types.AttributeValueMemberS{Value: status},
+		":pending": &types.AttributeValueMemberS{Value: ExternalStatusPending},
+		":updated": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+	}
+	if reason != "" {
+		update += ", failure_reason = :reason"
+		values[":reason"] = &types.AttributeValueMemberS{Value: reason}
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:                 aws.String(externalTransfersTable),
+				Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: transfer.ID}},
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String("#status = :pending"),
+				ExpressionAttributeNames:  map[string]string{"#status": "status"},
+				ExpressionAttributeValues: values,
+			},
+		},
+	}
+	items = append(items, extra...)
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		// Only the transfer's own condition means it was already closed; any
+		// other cancellation, such as a conflicting write, can be retried.
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 0 {
+			if code := txCancel.CancellationReasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return ErrExternalTransferClosed
+			}
+		}
+		return fmt.Errorf("close external transfer: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold is an authorization that reserves part of an account's available
+// balance without touching its ledger balance. While active its amount is
+// included in the account's Held total; capturing moves up to that amount to
+// PayeeAccountID, the merchant or other counterparty the hold was placed for,
+// and releasing or expiring gives it back.
+type Hold struct {
+	ID             string    `json:"id" dynamodbav:"id"`
+	AccountID      string    `json:"account_id" dynamodbav:"account_id"`
+	UserID         string    `json:"user_id" dynamodbav:"user_id"`
+	PayeeAccountID string    `json:"payee_account_id" dynamodbav:"payee_account_id"`
+	Amount         int64     `json:"amount" dynamodbav:"amount"`
+	CapturedAmount int64     `json:"captured_amount" dynamodbav:"captured_amount"`
+	Description    string    `json:"description" dynamodbav:"description"`
+	Status         string    `json:"status" dynamodbav:"status"`
+	ExpiresAt      time.Time `json:"expires_at" dynamodbav:"expires_at"`
+	CreatedAt      time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+var (
+	ErrHoldNotFound = errors.New("hold not found")
+	ErrHoldClosed   = errors.New("hold is no longer active")
+	ErrHoldNoPayee  = errors.New("hold has no payee to capture to")
+)
+
+// PlaceHold persists an active hold and adds it to the account's held total,
+// failing with ErrInsufficientBalance when the amount is not available.
+func PlaceHold(ctx context.Context, hold Hold, account Account) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(hold)
+	if err != nil {
+		return fmt.Errorf("marshal hold: %w", err)
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(holdsTable),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{Update: holdUpdate(account, hold.Amount)},
+		},
+	})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 1 {
+			if code := txCancel.CancellationReasons[1].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return ErrInsufficientBalance
+			}
+		}
+		return fmt.Errorf("place hold: %w", err)
+	}
+
+	return nil
+}
+
+// GetHoldByID fetches a single hold.
+func GetHoldByID(ctx context.Context, id string) (Hold, error) {
+	client, err := getClient()
+	if err != nil {
+		return Hold{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(holdsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Hold{}, fmt.Errorf("get hold: %w", err)
+	}
+
+	if out.Item == nil {
+		return Hold{}, ErrHoldNotFound
+	}
+
+	var hold Hold
+	if err := attributevalue.UnmarshalMap(out.Item, &hold); err != nil {
+		return Hold{}, fmt.Errorf("unmarshal hold: %w", err)
+	}
+
+	return hold, nil
+}
+
+// GetHoldsByAccountID lists the holds placed on an account.
+func GetHoldsByAccountID(ctx context.Context, accountID string) ([]Hold, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(holdsTable),
+		IndexName:              aws.String("account_id-index"),
+		KeyConditionExpression: aws.String("account_id = :account"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":account": &types.AttributeValueMemberS{Value: accountID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query holds: %w", err)
+	}
+
+	var holds []Hold
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &holds); err != nil {
+		return nil, fmt.Errorf("unmarshal holds: %w", err)
+	}
+
+	return holds, nil
+}
+
+// GetExpiredHolds returns active holds whose expiry is at or before now.
+func GetExpiredHolds(ctx context.Context, now time.Time) ([]Hold, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(holdsTable),
+		IndexName:              aws.String("status-expires_at-index"),
+		KeyConditionExpression: aws.String("#status = :active AND expires_at <= :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: HoldStatusActive},
+			":now":    &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		},
+	}
+
+	var holds []Hold
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query expired holds: %w", err)
+		}
+
+		var page []Hold
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal holds: %w", err)
+		}
+		holds = append(holds, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return holds, nil
+}
+
+// CaptureHold moves amount (at most the held amount) from the account to the
+// hold's payee and releases the whole hold in one transaction, recording a
+// "capture" transaction on each side. Any uncaptured remainder becomes
+// available again. Holds placed without a payee fail with ErrHoldNoPayee and
+// can only be released.
+func CaptureHold(ctx context.Context, hold Hold, amount int64, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	if hold.PayeeAccountID == "" {
+		return ErrHoldNoPayee
+	}
+
+	payee, err := GetAccountByID(ctx, hold.PayeeAccountID)
+	if err != nil {
+		return err
+	}
+
+	records := []Transaction{
+		{
+			ID:              "capture_" + hold.ID + "_out",
+			UserID:          hold.UserID,
+			AccountID:       hold.AccountID,
+			TotalAmount:     amount,
+			TransactionType: "capture",
+			Direction:       "debit",
+			Counterparty:    payee.ID,
+			CreatedAt:       now,
+		},
+		{
+			ID:              "capture_" + hold.ID + "_in",
+			UserID:          payee.UserID,
+			AccountID:       payee.ID,
+			TotalAmount:     amount,
+			TransactionType: "capture",
+			Direction:       "credit",
+			Counterparty:    hold.AccountID,
+			CreatedAt:       now,
+		},
+	}
+
+	extra := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: payee.ID}},
+				UpdateExpression:    aws.String("SET balance = balance + :captured"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":captured": &types.AttributeValueMemberN{Value: strconv.FormatInt(amount, 10)},
+				},
+			},
+		},
+	}
+	for _, record := range records {
+		txnItem, err := attributevalue.MarshalMap(record)
+		if err != nil {
+			return fmt.Errorf("marshal transaction: %w", err)
+		}
+		extra = append(extra, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(transactionsTable),
+				Item:                txnItem,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		})
+	}
+
+	return closeHold(ctx, client, hold, HoldStatusCaptured, amount, now, extra...)
+}
+
+// ReleaseHold closes an active hold without debiting anything. The status is
+// HoldStatusReleased or HoldStatusExpired.
+func ReleaseHold(ctx context.Context, hold Hold, status string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	return closeHold(ctx, client, hold, status, 0, now)
+}
+
+func closeHold(ctx context.Context, client *dynamodb.Client, hold Hold, status string, captured int64, now time.Time, extra ...types.TransactWriteItem) error {
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(holdsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: hold.ID}},
+				UpdateExpression:    aws.String("SET #status = :status, captured_amount = :captured, updated_at = :updated"),
+				ConditionExpression: aws.String("#status = :active"),
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":status":   &types.AttributeValueMemberS{Value: status},
+					":active":   &types.AttributeValueMemberS{Value: HoldStatusActive},
+					":captured": &types.AttributeValueMemberN{Value: strconv.FormatInt(captured, 10)},
+					":updated":  &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+				},
+			},
+		},
+		{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: hold.AccountID}},
+				UpdateExpression:    aws.String("SET balance = balance - :captured ADD held :release"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":captured": &types.AttributeValueMemberN{Value: strconv.FormatInt(captured, 10)},
+					":release":  &types.AttributeValueMemberN{Value: strconv.FormatInt(-hold.Amount, 10)},
+				},
+			},
+		},
+	}
+	items = append(items, extra...)
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			for i, reason := range txCancel.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				if i == 0 {
+					return ErrHoldClosed
+				}
+				return ErrAccountNotFound
+			}
+		}
+		return fmt.Errorf("close hold: %w", err)
+	}
+
+	return nil
+}
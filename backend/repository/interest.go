@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// InterestAccrual records one day of interest accrued on an account, negative
+// when the account was overdrawn, along with any overdraft fee. Its ID is the
+// account ID and date, so each account accrues at most once per day.
+type InterestAccrual struct {
+	ID             string    `json:"id" dynamodbav:"id"`
+	AccountID      string    `json:"account_id" dynamodbav:"account_id"`
+	Date           string    `json:"date" dynamodbav:"date"`
+	Balance        int64     `json:"balance" dynamodbav:"balance"`
+	APRBasisPoints int64     `json:"apr_bps" dynamodbav:"apr_bps"`
+	AmountMicros   int64     `json:"amount_micros" dynamodbav:"amount_micros"`
+	Fee            int64     `json:"fee" dynamodbav:"fee"`
+	CreatedAt      time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+var (
+	ErrInterestAlreadyAccrued = errors.New("interest already accrued for this day")
+	ErrInterestAlreadyPosted  = errors.New("interest already posted for this month")
+	// ErrInterestConflict means the write lost to a concurrent change of the
+	// account and nothing was written; it is safe to retry from fresh state.
+	ErrInterestConflict = errors.New("interest write conflicted with another change")
+)
+
+// AccrueInterest records a day's accrual and adds it to the account's unposted
+// interest and fees in one transaction. It returns ErrInterestAlreadyAccrued
+// only if the day's accrual record exists, and ErrInterestConflict if the
+// transaction was cancelled for any other reason.
+func AccrueInterest(ctx context.Context, accrual InterestAccrual) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	accrual.ID = accrual.AccountID + "#" + accrual.Date
+	item, err := attributevalue.MarshalMap(accrual)
+	if err != nil {
+		return fmt.Errorf("marshal interest accrual: %w", err)
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(accrualsTable),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:           aws.String(accountsTable),
+					Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: accrual.AccountID}},
+					UpdateExpression:    aws.String("SET last_accrual_date = :date ADD accrued_interest_micros :micros, accrued_fees :fee"),
+					ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(last_accrual_date) OR last_accrual_date < :date)"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":date":   &types.AttributeValueMemberS{Value: accrual.Date},
+						":micros": &types.AttributeValueMemberN{Value: strconv.FormatInt(accrual.AmountMicros, 10)},
+						":fee":    &types.AttributeValueMemberN{Value: strconv.FormatInt(accrual.Fee, 10)},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			if reasons := txCancel.CancellationReasons; len(reasons) > 0 {
+				if code := reasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+					return ErrInterestAlreadyAccrued
+				}
+			}
+			return fmt.Errorf("%w: %v", ErrInterestConflict, err)
+		}
+		return fmt.Errorf("accrue interest: %w", err)
+	}
+
+	return nil
+}
+
+// PostInterest posts a month's rounded interest and overdraft fees to the
+// account and deducts them from the unposted accruals. Positive interest is
+// credited as an "interest" transaction, negative interest is debited as
+// "overdraft_interest" and fees as "overdraft_fee"; when everything is zero
+// the month is only marked as posted. It returns ErrInterestAlreadyPosted
+// only if the account shows the month as posted, and ErrInterestConflict if
+// the transaction was cancelled for any other reason.
+func PostInterest(ctx context.Context, account Account, month string, interest, fees int64) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: account.ID}},
+				UpdateExpression:    aws.String("SET last_interest_posting = :month, balance = balance + :net ADD accrued_interest_micros :posted, accrued_fees :fees"),
+				ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(last_interest_posting) OR last_interest_posting < :month)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":month":  &types.AttributeValueMemberS{Value: month},
+					":net":    &types.AttributeValueMemberN{Value: strconv.FormatInt(interest-fees, 10)},
+					":posted": &types.AttributeValueMemberN{Value: strconv.FormatInt(-interest*1_000_000, 10)},
+					":fees":   &types.AttributeValueMemberN{Value: strconv.FormatInt(-fees, 10)},
+				},
+			},
+		},
+	}
+
+	postings := []struct {
+		txnType string
+		amount  int64
+	}{
+		{"interest", interest},
+		{"overdraft_interest", -interest},
+		{"overdraft_fee", fees},
+	}
+	for _, posting := range postings {
+		if posting.amount <= 0 {
+			continue
+		}
+
+		txnItem, err := attributevalue.MarshalMap(Transaction{
+			ID:              posting.txnType + "_" + account.ID + "_" + month,
+			UserID:          account.UserID,
+			AccountID:       account.ID,
+			TotalAmount:     posting.amount,
+			TransactionType: posting.txnType,
+			CreatedAt:       time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("marshal transaction: %w", err)
+		}
+
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(transactionsTable),
+				Item:                txnItem,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		})
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			if reasons := txCancel.CancellationReasons; len(reasons) > 0 {
+				if code := reasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+					return postingConflict(ctx, account.ID, month, err)
+				}
+			}
+			return fmt.Errorf("%w: %v", ErrInterestConflict, err)
+		}
+		return fmt.Errorf("post interest: %w", err)
+	}
+
+	return nil
+}
+
+// postingConflict works out why the account update of a posting failed its
+// condition: the month was already posted, or the account is gone.
+func postingConflict(ctx context.Context, accountID, month string, err error) error {
+	account, getErr := GetAccountByID(ctx, accountID)
+	switch {
+	case errors.Is(getErr, ErrAccountNotFound):
+		return ErrAccountNotFound
+	case getErr != nil:
+		return fmt.Errorf("%w: %v", ErrInterestConflict, err)
+	case account.LastInterestPosting >= month:
+		return ErrInterestAlreadyPosted
+	default:
+		return fmt.Errorf("%w: %v", ErrInterestConflict, err)
+	}
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	MovementRestock    = "restock"
+	MovementDamage     = "damage"
+	MovementCorrection = "correction"
+	MovementSale       = "sale"
+	MovementRefund     = "refund"
+)
+
+// InventoryMovement records one change to a product's stock on hand, or to
+// that of its variant SKU. Delta is signed: sales and damage are negative,
+// restocks and refunds positive. Reference links a sale to its purchase
+// transaction.
+type InventoryMovement struct {
+	ID        string    `json:"id" dynamodbav:"id"`
+	ProductID string    `json:"product_id" dynamodbav:"product_id"`
+	SKU       string    `json:"sku,omitempty" dynamodbav:"sku,omitempty"`
+	Type      string    `json:"type" dynamodbav:"type"`
+	Delta     int       `json:"delta" dynamodbav:"delta"`
+	Reference string    `json:"reference,omitempty" dynamodbav:"reference,omitempty"`
+	Note      string    `json:"note,omitempty" dynamodbav:"note,omitempty"`
+	ActorID   string    `json:"actor_id,omitempty" dynamodbav:"actor_id,omitempty"`
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+// saleMovement is the movement recorded alongside a purchase transaction.
+func saleMovement(txn Transaction) InventoryMovement {
+	return InventoryMovement{
+		ID:        "stock_" + txn.ID,
+		ProductID: txn.ProductID,
+		SKU:       txn.SKU,
+		Type:      MovementSale,
+		Delta:     -txn.Quantity,
+		Reference: txn.ID,
+		ActorID:   txn.UserID,
+		CreatedAt: txn.CreatedAt,
+	}
+}
+
+// movementPut builds the write that appends movement to the log.
+func movementPut(movement InventoryMovement) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(movement)
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("marshal inventory movement: %w", err)
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:           aws.String(inventoryMovementsTable),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		},
+	}, nil
+}
+
+// AdjustStock adds movement.Delta to the stock on hand of the product, or of
+// its variant movement.SKU, and logs the movement in one transaction. A
+// negative delta may not take stock below the reserved quantity read with
+// product; that, or a concurrent reservation, fails with ErrProductOutOfStock.
+func AdjustStock(ctx context.Context, product Product, movement InventoryMovement) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	put, err := movementPut(movement)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{}
+	names := map[string]string{}
+	update := stockChange(movement.SKU, movement.Delta, 0, values, names)
+
+	condition := stockExists(movement.SKU)
+	if movement.Delta < 0 {
+		condition = stockCondition(product, movement.SKU, -movement.Delta, values, names)
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:                 aws.String(productsTable),
+					Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: product.ID}},
+					UpdateExpression:          aws.String(update),
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeNames:  attributeNames(names),
+					ExpressionAttributeValues: values,
+				},
+			},
+			put,
+		},
+	})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 0 {
+			if code := txCancel.CancellationReasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+				switch {
+				case movement.Delta < 0:
+					return ErrProductOutOfStock
+				case movement.SKU != "":
+					return ErrVariantNotFound
+				}
+				return ErrProductNotFound
+			}
+		}
+		return fmt.Errorf("adjust stock: %w", err)
+	}
+
+	return nil
+}
+
+// GetInventoryMovements lists a product's stock movements, newest first.
+func GetInventoryMovements(ctx context.Context, productID string) ([]InventoryMovement, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(inventoryMovementsTable),
+		IndexName:              aws.String("product_id-created_at-index"),
+		KeyConditionExpression: aws.String("product_id = :product_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":product_id": &types.AttributeValueMemberS{Value: productID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	movements := []InventoryMovement{}
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query inventory movements: %w", err)
+		}
+
+		var page []InventoryMovement
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal inventory movements: %w", err)
+		}
+		movements = append(movements, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return movements, nil
+}
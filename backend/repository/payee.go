@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Payee is another user saved to a user's address book. Transfers to a payee
+// are always credited to the payee's current default receiving account.
+type Payee struct {
+	ID          string    `json:"id" dynamodbav:"id"`
+	UserID      string    `json:"user_id" dynamodbav:"user_id"`
+	PayeeUserID string    `json:"payee_user_id" dynamodbav:"payee_user_id"`
+	Nickname    string    `json:"nickname" dynamodbav:"nickname"`
+	MaskedName  string    `json:"masked_name" dynamodbav:"masked_name"`
+	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+var ErrPayeeNotFound = errors.New("payee not found")
+
+// CreatePayee persists a saved payee.
+func CreatePayee(ctx context.Context, payee Payee) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(payee)
+	if err != nil {
+		return fmt.Errorf("marshal payee: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(payeesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("put payee: %w", err)
+	}
+
+	return nil
+}
+
+// GetPayeesByUserID lists the payees saved by a user.
+func GetPayeesByUserID(ctx context.Context, userID string) ([]Payee, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(payeesTable),
+		IndexName:              aws.String("user_id-index"),
+		KeyConditionExpression: aws.String("user_id = :user"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query payees: %w", err)
+	}
+
+	var payees []Payee
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &payees); err != nil {
+		return nil, fmt.Errorf("unmarshal payees: %w", err)
+	}
+
+	return payees, nil
+}
+
+// GetPayeeByID fetches a single saved payee.
+func GetPayeeByID(ctx context.Context, id string) (Payee, error) {
+	client, err := getClient()
+	if err != nil {
+		return Payee{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(payeesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Payee{}, fmt.Errorf("get payee: %w", err)
+	}
+
+	if out.Item == nil {
+		return Payee{}, ErrPayeeNotFound
+	}
+
+	var payee Payee
+	if err := attributevalue.UnmarshalMap(out.Item, &payee); err != nil {
+		return Payee{}, fmt.Errorf("unmarshal payee: %w", err)
+	}
+
+	return payee, nil
+}
+
+// DeletePayee removes a saved payee owned by the given user.
+func DeletePayee(ctx context.Context, userID, id string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(payeesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(id) AND user_id = :user"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrPayeeNotFound
+		}
+		return fmt.Errorf("delete payee: %w", err)
+	}
+
+	return nil
+}
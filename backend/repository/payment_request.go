@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	RequestStatusPending   = "pending"
+	RequestStatusPaid      = "paid"
+	RequestStatusDeclined  = "declined"
+	RequestStatusCancelled = "cancelled"
+	RequestStatusExpired   = "expired"
+)
+
+// PaymentRequest asks another user (the payer) to send money to one of the
+// requester's accounts.
+type PaymentRequest struct {
+	ID                 string    `json:"id" dynamodbav:"id"`
+	RequesterID        string    `json:"requester_id" dynamodbav:"requester_id"`
+	RequesterAccountID string    `json:"requester_account_id" dynamodbav:"requester_account_id"`
+	RequesterName      string    `json:"requester_name" dynamodbav:"requester_name"`
+	PayerID            string    `json:"payer_id" dynamodbav:"payer_id"`
+	PayerName          string    `json:"payer_name" dynamodbav:"payer_name"`
+	Amount             int64     `json:"amount" dynamodbav:"amount"`
+	Note               string    `json:"note" dynamodbav:"note"`
+	Status             string    `json:"status" dynamodbav:"status"`
+	PaidFromAccountID  string    `json:"paid_from_account_id,omitempty" dynamodbav:"paid_from_account_id,omitempty"`
+	ExpiresAt          time.Time `json:"expires_at" dynamodbav:"expires_at"`
+	CreatedAt          time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+var (
+	ErrPaymentRequestNotFound = errors.New("payment request not found")
+	ErrPaymentRequestClosed   = errors.New("payment request is no longer pending")
+)
+
+// CreatePaymentRequest persists a new payment request.
+func CreatePaymentRequest(ctx context.Context, request PaymentRequest) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(request)
+	if err != nil {
+		return fmt.Errorf("marshal payment request: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(requestsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("put payment request: %w", err)
+	}
+
+	return nil
+}
+
+// GetPaymentRequestByID fetches a single payment request.
+func GetPaymentRequestByID(ctx context.Context, id string) (PaymentRequest, error) {
+	client, err := getClient()
+	if err != nil {
+		return PaymentRequest{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(requestsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return PaymentRequest{}, fmt.Errorf("get payment request: %w", err)
+	}
+
+	if out.Item == nil {
+		return PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+
+	var request PaymentRequest
+	if err := attributevalue.UnmarshalMap(out.Item, &request); err != nil {
+		return PaymentRequest{}, fmt.Errorf("unmarshal payment request: %w", err)
+	}
+
+	return request, nil
+}
+
+// GetPaymentRequestsByPayerID lists requests the user has been asked to pay.
+func GetPaymentRequestsByPayerID(ctx context.Context, payerID string) ([]PaymentRequest, error) {
+	return queryPaymentRequests(ctx, "payer_id-index", "payer_id", payerID)
+}
+
+// GetPaymentRequestsByRequesterID lists requests the user has sent.
+func GetPaymentRequestsByRequesterID(ctx context.Context, requesterID string) ([]PaymentRequest, error) {
+	return queryPaymentRequests(ctx, "requester_id-index", "requester_id", requesterID)
+}
+
+func queryPaymentRequests(ctx context.Context, index, attr, userID string) ([]PaymentRequest, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(requestsTable),
+		IndexName:              aws.String(index),
+		KeyConditionExpression: aws.String(attr + " = :user"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query payment requests: %w", err)
+	}
+
+	var requests []PaymentRequest
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &requests); err != nil {
+		return nil, fmt.Errorf("unmarshal payment requests: %w", err)
+	}
+
+	return requests, nil
+}
+
+// ClosePaymentRequest moves a pending request to a terminal status such as
+// declined, cancelled or expired.
+func ClosePaymentRequest(ctx context.Context, id, status string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(requestsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, updated_at = :updated"),
+		ConditionExpression: aws.String("attribute_exists(id) AND #status = :pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status":  &types.AttributeValueMemberS{Value: status},
+			":pending": &types.AttributeValueMemberS{Value: RequestStatusPending},
+			":updated": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339Nano)},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrPaymentRequestClosed
+		}
+		return fmt.Errorf("close payment request: %w", err)
+	}
+
+	return nil
+}
+
+// PayPaymentRequest transfers the requested amount from the payer's account
+// and marks the request paid in the same transaction. The request must still
+// be pending and unexpired when the transaction commits.
+func PayPaymentRequest(ctx context.Context, request PaymentRequest, fromAccountID string, now time.Time) error {
+	markPaid := paymentRequestPaid(request.ID, fromAccountID, now)
+	markPaid.ConditionExpression = aws.String("#status = :pending AND expires_at > :now")
+	markPaid.ExpressionAttributeValues[":now"] = &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)}
+
+	err := TransferMoney(ctx, fromAccountID, request.RequesterAccountID, request.Amount, types.TransactWriteItem{Update: markPaid})
+	if errors.Is(err, ErrTransferConflict) {
+		return ErrPaymentRequestClosed
+	}
+	return err
+}
+
+// paymentRequestPaid marks a pending request paid from fromAccountID, for
+// inclusion in the transaction that moves the money.
+func paymentRequestPaid(id, fromAccountID string, now time.Time) *types.Update {
+	return &types.Update{
+		TableName: aws.String(requestsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET #status = :paid, paid_from_account_id = :from, updated_at = :updated"),
+		ConditionExpression: aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":paid":    &types.AttributeValueMemberS{Value: RequestStatusPaid},
+			":pending": &types.AttributeValueMemberS{Value: RequestStatusPending},
+			":from":    &types.AttributeValueMemberS{Value: fromAccountID},
+			":updated": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		},
+	}
+}
@@ -2,8 +2,14 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,17 +18,113 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// Product is an item for sale. Stock is the quantity on hand, of which
+// Reserved is set aside by active reservations; for a product with Variants,
+// keyed by SKU, both are totals over its variants. Version counts edits to the
+// product's details and is served as its ETag. An archived product is hidden
+// from the catalogue and cannot be bought or reserved, but still resolves by
+// ID for purchase history. SKU, when set, identifies the product in bulk
+// imports. Category groups products for promotions, and TaxClass picks the
+// tax rate charged on them. Images are listed in upload order. RatingCount
+// and RatingSum total the stars of its visible reviews.
 type Product struct {
-	ID          string    `json:"id" dynamodbav:"id"`
-	Name        string    `json:"name" dynamodbav:"name"`
-	Description string    `json:"description" dynamodbav:"description"`
-	Price       int64     `json:"price" dynamodbav:"price"`
-	Stock       int       `json:"stock" dynamodbav:"stock"`
-	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
+	ID          string     `json:"id" dynamodbav:"id"`
+	SKU         string     `json:"sku,omitempty" dynamodbav:"sku,omitempty"`
+	Name        string     `json:"name" dynamodbav:"name"`
+	Description string     `json:"description" dynamodbav:"description"`
+	Category    string     `json:"category,omitempty" dynamodbav:"category,omitempty"`
+	TaxClass    string     `json:"tax_class,omitempty" dynamodbav:"tax_class,omitempty"`
+	Price       int64      `json:"price" dynamodbav:"price"`
+	Stock       int        `json:"stock" dynamodbav:"stock"`
+	Reserved    int        `json:"reserved" dynamodbav:"reserved"`
+	Version     int64      `json:"version" dynamodbav:"version"`
+	CreatedAt   time.Time  `json:"created_at" dynamodbav:"created_at"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty" dynamodbav:"archived_at,omitempty"`
+	RatingCount int        `json:"rating_count" dynamodbav:"rating_count"`
+	RatingSum   int        `json:"-" dynamodbav:"rating_sum"`
+
+	Variants map[string]ProductVariant `json:"-" dynamodbav:"variants,omitempty"`
+	Images   []ProductImage            `json:"images,omitempty" dynamodbav:"images,omitempty"`
+}
+
+// Archived reports whether the product has been withdrawn from sale.
+func (p Product) Archived() bool {
+	return p.ArchivedAt != nil
+}
+
+// AvailableStock is the quantity that can still be bought or reserved.
+func (p Product) AvailableStock() int {
+	return p.Stock - p.Reserved
+}
+
+// AverageRating is the mean stars of the product's visible reviews to one
+// decimal place, or 0 if it has none.
+func (p Product) AverageRating() float64 {
+	if p.RatingCount <= 0 {
+		return 0
+	}
+	return math.Round(float64(p.RatingSum)*10/float64(p.RatingCount)) / 10
+}
+
+// MarshalJSON adds the available quantity and average rating to the product
+// and lists its variants by SKU.
+func (p Product) MarshalJSON() ([]byte, error) {
+	type product Product
+
+	var variants []ProductVariant
+	for _, variant := range p.Variants {
+		variants = append(variants, variant)
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].SKU < variants[j].SKU })
+
+	return json.Marshal(struct {
+		product
+		Available int              `json:"available"`
+		Rating    float64          `json:"rating"`
+		Variants  []ProductVariant `json:"variants,omitempty"`
+	}{product(p), p.AvailableStock(), p.AverageRating(), variants})
 }
 
-var ErrProductNotFound = errors.New("product not found")
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrProductArchived = errors.New("product archived")
+)
+
+// notArchived is the condition that a product is still on sale.
+const notArchived = "attribute_not_exists(archived_at)"
 
+// stockCondition requires quantity to fit in the available stock of sku, or
+// of the product when sku is empty. As with availableCondition, the reserved
+// quantity read by the caller is pinned so a concurrent reservation fails the
+// write instead of overselling.
+func stockCondition(product Product, sku string, quantity int, values map[string]types.AttributeValue, names map[string]string) string {
+	stockPath, reservedPath := stockPaths(sku, names)
+	_, reserved := product.stockLevels(sku)
+	values[":required"] = &types.AttributeValueMemberN{Value: strconv.Itoa(quantity + reserved)}
+
+	return "attribute_exists(id) AND " + stockPath + " >= :required" +
+		pinCondition(reservedPath, ":reserved", int64(reserved), values)
+}
+
+// stockUpdate builds the update that sells quantity of sku from a product's
+// available stock. It fails if the product has been archived.
+func stockUpdate(product Product, sku string, quantity int) *types.Update {
+	values := map[string]types.AttributeValue{}
+	names := map[string]string{}
+	update := stockChange(sku, -quantity, 0, values, names)
+
+	return &types.Update{
+		TableName:                 aws.String(productsTable),
+		Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: product.ID}},
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String(stockCondition(product, sku, quantity, values, names) + " AND " + notArchived),
+		ExpressionAttributeNames:  attributeNames(names),
+		ExpressionAttributeValues: values,
+	}
+}
+
+// CreateProduct persists a new product, logging its initial stock, or that
+// of each variant, as a restock movement.
 func CreateProduct(ctx context.Context, product Product) error {
 	client, err := getClient()
 	if err != nil {
@@ -34,11 +136,25 @@ func CreateProduct(ctx context.Context, product Product) error {
 		return fmt.Errorf("marshal product: %w", err)
 	}
 
-	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName:           aws.String(productsTable),
-		Item:                item,
-		ConditionExpression: aws.String("attribute_not_exists(id)"),
-	})
+	items := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:           aws.String(productsTable),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+	}
+
+	for _, movement := range initialMovements(product) {
+		put, err := movementPut(movement)
+		if err != nil {
+			return err
+		}
+		items = append(items, put)
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
 	if err != nil {
 		return fmt.Errorf("put product: %w", err)
 	}
@@ -46,20 +162,119 @@ func CreateProduct(ctx context.Context, product Product) error {
 	return nil
 }
 
-func GetAllProducts(ctx context.Context) ([]Product, error) {
-	client, err := getClient()
+// initialMovements are the restock movements logging a new product's stock,
+// or that of each of its variants.
+func initialMovements(product Product) []InventoryMovement {
+	initial := []InventoryMovement{}
+	for _, variant := range product.Variants {
+		if variant.Stock > 0 {
+			initial = append(initial, InventoryMovement{
+				ID:    "stock_" + product.ID + "_" + variant.SKU,
+				SKU:   variant.SKU,
+				Delta: variant.Stock,
+			})
+		}
+	}
+	if len(product.Variants) == 0 && product.Stock > 0 {
+		initial = append(initial, InventoryMovement{
+			ID:    "stock_" + product.ID,
+			Delta: product.Stock,
+		})
+	}
+
+	for i := range initial {
+		initial[i].ProductID = product.ID
+		initial[i].Type = MovementRestock
+		initial[i].Note = "Initial stock"
+		initial[i].CreatedAt = product.CreatedAt
+	}
+	return initial
+}
+
+// BatchCreateProducts writes new products and their initial stock movements
+// with BatchWriteItem rather than a transaction per product. The movements go
+// first and a product is only written once all of its own have been, so a
+// product never exists without its initial stock logged; a product that fails
+// may leave movements under its unused ID behind. The writes are
+// unconditional, so the products must have fresh IDs. It returns the IDs of
+// products that could not be written.
+func BatchCreateProducts(ctx context.Context, products []Product) ([]string, error) {
+	var movements, puts []batchPut
+	for _, product := range products {
+		item, err := attributevalue.MarshalMap(product)
+		if err != nil {
+			return nil, fmt.Errorf("marshal product: %w", err)
+		}
+		puts = append(puts, batchPut{table: productsTable, owner: product.ID, item: item})
+
+		for _, movement := range initialMovements(product) {
+			item, err := attributevalue.MarshalMap(movement)
+			if err != nil {
+				return nil, fmt.Errorf("marshal inventory movement: %w", err)
+			}
+			movements = append(movements, batchPut{table: inventoryMovementsTable, owner: product.ID, item: item})
+		}
+	}
+
+	failed, err := batchWrite(ctx, movements)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[string]bool{}
+	for _, id := range failed {
+		skip[id] = true
+	}
+	puts = slices.DeleteFunc(puts, func(put batchPut) bool { return skip[put.owner] })
+
+	failedProducts, err := batchWrite(ctx, puts)
 	if err != nil {
 		return nil, err
 	}
+	return append(failed, failedProducts...), nil
+}
+
+// GetProductBySKU finds the product with the given SKU. Products are not
+// indexed by SKU, so this scans the table.
+func GetProductBySKU(ctx context.Context, sku string) (Product, error) {
+	products, err := GetAllProducts(ctx)
+	if err != nil {
+		return Product{}, err
+	}
+
+	for _, product := range products {
+		if product.SKU == sku {
+			return product, nil
+		}
+	}
+	return Product{}, ErrProductNotFound
+}
 
-	out, err := client.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(productsTable)})
+func GetAllProducts(ctx context.Context) ([]Product, error) {
+	client, err := getClient()
 	if err != nil {
-		return nil, fmt.Errorf("scan products: %w", err)
+		return nil, err
 	}
 
+	input := &dynamodb.ScanInput{TableName: aws.String(productsTable)}
+
 	var products []Product
-	if err := attributevalue.UnmarshalListOfMaps(out.Items, &products); err != nil {
-		return nil, fmt.Errorf("unmarshal products: %w", err)
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("scan products: %w", err)
+		}
+
+		var page []Product
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal products: %w", err)
+		}
+		products = append(products, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
 	}
 
 	return products, nil
@@ -93,32 +308,74 @@ func GetProductByID(ctx context.Context, id string) (Product, error) {
 	return product, nil
 }
 
-func UpdateProduct(ctx context.Context, product Product) error {
+// UpdateProduct changes a product's details and variant definitions from
+// current to updated if it is still at current.Version, failing with
+// ErrVersionConflict otherwise, or with ErrVariantInUse if a removed variant
+// still has stock. Stock is only changed through AdjustStock and purchases.
+func UpdateProduct(ctx context.Context, current, updated Product) error {
 	client, err := getClient()
 	if err != nil {
 		return err
 	}
 
 	exprValues := map[string]types.AttributeValue{
-		":name":  &types.AttributeValueMemberS{Value: product.Name},
-		":desc":  &types.AttributeValueMemberS{Value: product.Description},
-		":price": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", product.Price)},
-		":stock": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", product.Stock)},
+		":name":  &types.AttributeValueMemberS{Value: updated.Name},
+		":desc":  &types.AttributeValueMemberS{Value: updated.Description},
+		":price": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", updated.Price)},
+	}
+	names := map[string]string{}
+	condition, setVersion := versionUpdate(current.Version, exprValues)
+
+	set, remove, conditions, err := variantsUpdate(current.Variants, updated.Variants, exprValues, names)
+	if err != nil {
+		return err
+	}
+
+	fields := []string{"name = :name", "description = :desc", "price = :price", setVersion}
+	if updated.SKU != "" {
+		exprValues[":sku"] = &types.AttributeValueMemberS{Value: updated.SKU}
+		fields = append(fields, "sku = :sku")
+	} else {
+		remove = append(remove, "sku")
+	}
+	if updated.Category != "" {
+		exprValues[":category"] = &types.AttributeValueMemberS{Value: updated.Category}
+		fields = append(fields, "category = :category")
+	} else {
+		remove = append(remove, "category")
+	}
+	if updated.TaxClass != "" {
+		exprValues[":taxClass"] = &types.AttributeValueMemberS{Value: updated.TaxClass}
+		fields = append(fields, "tax_class = :taxClass")
+	} else {
+		remove = append(remove, "tax_class")
+	}
+
+	update := "SET " + strings.Join(append(fields, set...), ", ")
+	if len(remove) > 0 {
+		update += " REMOVE " + strings.Join(remove, ", ")
 	}
 
 	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(productsTable),
 		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{Value: product.ID},
+			"id": &types.AttributeValueMemberS{Value: current.ID},
 		},
-		UpdateExpression:          aws.String("SET name = :name, description = :desc, price = :price, stock = :stock"),
-		ConditionExpression:       aws.String("attribute_exists(id)"),
-		ExpressionAttributeValues: exprValues,
+		UpdateExpression:                    aws.String(update),
+		ConditionExpression:                 aws.String(strings.Join(append([]string{condition}, conditions...), " AND ")),
+		ExpressionAttributeNames:            attributeNames(names),
+		ExpressionAttributeValues:           exprValues,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 	if err != nil {
 		var ccf *types.ConditionalCheckFailedException
 		if errors.As(err, &ccf) {
-			return ErrProductNotFound
+			err := versionFailure(ccf, ErrProductNotFound)
+			var old Product
+			if errors.Is(err, ErrVersionConflict) && attributevalue.UnmarshalMap(ccf.Item, &old) == nil && old.Version == current.Version {
+				return ErrVariantInUse
+			}
+			return err
 		}
 		return fmt.Errorf("update product: %w", err)
 	}
@@ -126,17 +383,49 @@ func UpdateProduct(ctx context.Context, product Product) error {
 	return nil
 }
 
-func DeleteProduct(ctx context.Context, id string) error {
+// ArchiveProduct withdraws a product from sale. Archiving an archived
+// product keeps its original archive time.
+func ArchiveProduct(ctx context.Context, id string, now time.Time) error {
 	client, err := getClient()
 	if err != nil {
 		return err
 	}
 
-	_, err = client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET archived_at = if_not_exists(archived_at, :now)"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrProductNotFound
+		}
+		return fmt.Errorf("archive product: %w", err)
+	}
+
+	return nil
+}
+
+// RestoreProduct puts an archived product back on sale.
+func RestoreProduct(ctx context.Context, id string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(productsTable),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
+		UpdateExpression:    aws.String("REMOVE archived_at"),
 		ConditionExpression: aws.String("attribute_exists(id)"),
 	})
 	if err != nil {
@@ -144,7 +433,7 @@ func DeleteProduct(ctx context.Context, id string) error {
 		if errors.As(err, &ccf) {
 			return ErrProductNotFound
 		}
-		return fmt.Errorf("delete product: %w", err)
+		return fmt.Errorf("restore product: %w", err)
 	}
 
 	return nil
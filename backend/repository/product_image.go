@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MaxProductImages bounds the images of one product.
+const MaxProductImages = 10
+
+var (
+	ErrProductImageNotFound = errors.New("product image not found")
+	ErrTooManyProductImages = errors.New("product has too many images")
+)
+
+// ProductImage is a picture of a product. Key and ThumbnailKey name the
+// original and its thumbnail in the blob store; both are served under /media/.
+type ProductImage struct {
+	ID           string    `json:"id" dynamodbav:"id"`
+	Key          string    `json:"-" dynamodbav:"key"`
+	ThumbnailKey string    `json:"-" dynamodbav:"thumbnail_key"`
+	ContentType  string    `json:"content_type" dynamodbav:"content_type"`
+	Width        int       `json:"width" dynamodbav:"width"`
+	Height       int       `json:"height" dynamodbav:"height"`
+	Size         int64     `json:"size" dynamodbav:"size"`
+	CreatedAt    time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+// MediaURL is the path a stored blob is served at.
+func MediaURL(key string) string {
+	return "/media/" + key
+}
+
+// MarshalJSON adds the URLs of the image and its thumbnail.
+func (i ProductImage) MarshalJSON() ([]byte, error) {
+	type image ProductImage
+	return json.Marshal(struct {
+		image
+		URL          string `json:"url"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}{image(i), MediaURL(i.Key), MediaURL(i.ThumbnailKey)})
+}
+
+// AddProductImage appends an image to a product, failing with
+// ErrTooManyProductImages once it has MaxProductImages.
+func AddProductImage(ctx context.Context, productID string, image ProductImage) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(image)
+	if err != nil {
+		return fmt.Errorf("marshal product image: %w", err)
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: productID},
+		},
+		UpdateExpression:    aws.String("SET images = list_append(if_not_exists(images, :empty), :image)"),
+		ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(images) OR size(images) < :max)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":image": &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberM{Value: item}}},
+			":max":   &types.AttributeValueMemberN{Value: strconv.Itoa(MaxProductImages)},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			if len(ccf.Item) == 0 {
+				return ErrProductNotFound
+			}
+			return ErrTooManyProductImages
+		}
+		return fmt.Errorf("add product image: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveProductImage removes the image with imageID from product, which must
+// be current: if the product's images have moved since it was read, the
+// removal fails with ErrVersionConflict.
+func RemoveProductImage(ctx context.Context, product Product, imageID string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, image := range product.Images {
+		if image.ID == imageID {
+			index = i
+		}
+	}
+	if index < 0 {
+		return ErrProductImageNotFound
+	}
+
+	path := fmt.Sprintf("images[%d]", index)
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: product.ID},
+		},
+		UpdateExpression:    aws.String("REMOVE " + path),
+		ConditionExpression: aws.String(path + ".id = :imageID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":imageID": &types.AttributeValueMemberS{Value: imageID},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrVersionConflict
+		}
+		return fmt.Errorf("remove product image: %w", err)
+	}
+
+	return nil
+}
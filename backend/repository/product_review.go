@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrProductReviewNotFound = errors.New("product review not found")
+	ErrProductReviewExists   = errors.New("product already reviewed")
+)
+
+// ProductReview is a buyer's rating of a product from 1 to 5 stars, with
+// optional text. A user reviews a product once, so the ID is derived from
+// both. Hidden reviews are withheld from the catalogue by a moderator and
+// left out of the product's rating.
+type ProductReview struct {
+	ID        string    `json:"id" dynamodbav:"id"`
+	ProductID string    `json:"product_id" dynamodbav:"product_id"`
+	UserID    string    `json:"user_id" dynamodbav:"user_id"`
+	Username  string    `json:"username" dynamodbav:"username"`
+	Rating    int       `json:"rating" dynamodbav:"rating"`
+	Text      string    `json:"text" dynamodbav:"text"`
+	Hidden    bool      `json:"hidden" dynamodbav:"hidden"`
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// ProductReviewID is the ID of userID's review of productID.
+func ProductReviewID(productID, userID string) string {
+	return "rev_" + productID + "_" + userID
+}
+
+// ratingUpdate adds delta reviews totalling sum stars to a product's rating.
+func ratingUpdate(productID string, delta, sum int) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: aws.String(productsTable),
+			Key: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: productID},
+			},
+			UpdateExpression:    aws.String("ADD rating_count :count, rating_sum :sum"),
+			ConditionExpression: aws.String("attribute_exists(id)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":count": &types.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+				":sum":   &types.AttributeValueMemberN{Value: strconv.Itoa(sum)},
+			},
+		},
+	}
+}
+
+// reviewFailure explains a failed moderation transaction, whose first item
+// is the review: ErrProductReviewNotFound if the review is gone,
+// ErrVersionConflict if it was moderated meanwhile, or ErrProductNotFound if
+// its product is gone.
+func reviewFailure(op string, err error) error {
+	var txCancel *types.TransactionCanceledException
+	if errors.As(err, &txCancel) {
+		for i, reason := range txCancel.CancellationReasons {
+			if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+				continue
+			}
+			switch {
+			case i > 0:
+				return ErrProductNotFound
+			case len(reason.Item) > 0:
+				return ErrVersionConflict
+			default:
+				return ErrProductReviewNotFound
+			}
+		}
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// CreateProductReview saves a review and counts it in the product's rating in
+// one transaction, failing with ErrProductReviewExists if the user has
+// already reviewed the product.
+func CreateProductReview(ctx context.Context, review ProductReview) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(review)
+	if err != nil {
+		return fmt.Errorf("marshal product review: %w", err)
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(productReviewsTable),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			ratingUpdate(review.ProductID, 1, review.Rating),
+		},
+	})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			for i, reason := range txCancel.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				if i == 0 {
+					return ErrProductReviewExists
+				}
+				return ErrProductNotFound
+			}
+		}
+		return fmt.Errorf("create product review: %w", err)
+	}
+
+	return nil
+}
+
+// GetProductReviewByID fetches a single product review.
+func GetProductReviewByID(ctx context.Context, id string) (ProductReview, error) {
+	client, err := getClient()
+	if err != nil {
+		return ProductReview{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(productReviewsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return ProductReview{}, fmt.Errorf("get product review: %w", err)
+	}
+	if out.Item == nil {
+		return ProductReview{}, ErrProductReviewNotFound
+	}
+
+	var review ProductReview
+	if err := attributevalue.UnmarshalMap(out.Item, &review); err != nil {
+		return ProductReview{}, fmt.Errorf("unmarshal product review: %w", err)
+	}
+
+	return review, nil
+}
+
+// GetProductReviews lists a product's reviews, hidden ones included, newest
+// first.
+func GetProductReviews(ctx context.Context, productID string) ([]ProductReview, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(productReviewsTable),
+		IndexName:              aws.String("product_id-created_at-index"),
+		KeyConditionExpression: aws.String("product_id = :product_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":product_id": &types.AttributeValueMemberS{Value: productID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	reviews := []ProductReview{}
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query product reviews: %w", err)
+		}
+
+		var page []ProductReview
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal product reviews: %w", err)
+		}
+		reviews = append(reviews, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return reviews, nil
+}
+
+// GetAllProductReviews lists every review, for moderation.
+func GetAllProductReviews(ctx context.Context) ([]ProductReview, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.ScanInput{TableName: aws.String(productReviewsTable)}
+
+	reviews := []ProductReview{}
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("scan product reviews: %w", err)
+		}
+
+		var page []ProductReview
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal product reviews: %w", err)
+		}
+		reviews = append(reviews, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return reviews, nil
+}
+
+// SetProductReviewHidden hides or shows a review as read, taking it out of
+// or putting it back into the product's rating in the same transaction.
+func SetProductReviewHidden(ctx context.Context, review ProductReview, hidden bool, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	if review.Hidden == hidden {
+		return nil
+	}
+
+	delta := 1
+	if hidden {
+		delta = -1
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName: aws.String(productReviewsTable),
+					Key: map[string]types.AttributeValue{
+						"id": &types.AttributeValueMemberS{Value: review.ID},
+					},
+					UpdateExpression:    aws.String("SET hidden = :hidden, updated_at = :now"),
+					ConditionExpression: aws.String("attribute_exists(id) AND hidden = :was"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":hidden": &types.AttributeValueMemberBOOL{Value: hidden},
+						":was":    &types.AttributeValueMemberBOOL{Value: review.Hidden},
+						":now":    &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+					},
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			ratingUpdate(review.ProductID, delta, delta*review.Rating),
+		},
+	})
+	if err != nil {
+		return reviewFailure("moderate product review", err)
+	}
+
+	return nil
+}
+
+// DeleteProductReview removes a review as read, taking it out of the
+// product's rating unless it was hidden.
+func DeleteProductReview(ctx context.Context, review ProductReview) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName: aws.String(productReviewsTable),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: review.ID},
+				},
+				ConditionExpression: aws.String("attribute_exists(id) AND hidden = :hidden"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":hidden": &types.AttributeValueMemberBOOL{Value: review.Hidden},
+				},
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			},
+		},
+	}
+	if !review.Hidden {
+		items = append(items, ratingUpdate(review.ProductID, -1, -review.Rating))
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		return reviewFailure("delete product review", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	PromotionPercent = "percent"
+	PromotionFixed   = "fixed"
+)
+
+// Promotion discounts purchases. One with a Code applies only when the buyer
+// enters it; one without is an automatic rule applied to every eligible
+// purchase. Value is a percentage for percent promotions and an amount in
+// minor units for fixed ones. Category, when set, limits the promotion to
+// products in it. MaxUses and PerUserLimit of zero mean no limit, and Uses
+// counts redemptions so far.
+type Promotion struct {
+	ID           string     `json:"id" dynamodbav:"id"`
+	Code         string     `json:"code,omitempty" dynamodbav:"code,omitempty"`
+	Name         string     `json:"name" dynamodbav:"name"`
+	Type         string     `json:"type" dynamodbav:"type"`
+	Value        int64      `json:"value" dynamodbav:"value"`
+	Category     string     `json:"category,omitempty" dynamodbav:"category,omitempty"`
+	MinSpend     int64      `json:"min_spend" dynamodbav:"min_spend"`
+	MaxUses      int        `json:"max_uses" dynamodbav:"max_uses"`
+	PerUserLimit int        `json:"per_user_limit" dynamodbav:"per_user_limit"`
+	Uses         int        `json:"uses" dynamodbav:"uses"`
+	Active       bool       `json:"active" dynamodbav:"active"`
+	StartsAt     *time.Time `json:"starts_at,omitempty" dynamodbav:"starts_at,omitempty"`
+	EndsAt       *time.Time `json:"ends_at,omitempty" dynamodbav:"ends_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" dynamodbav:"created_at"`
+}
+
+var (
+	ErrPromotionNotFound      = errors.New("promotion not found")
+	ErrPromotionCodeTaken     = errors.New("promotion code already exists")
+	ErrPromotionInactive      = errors.New("promotion is not active")
+	ErrPromotionNotApplicable = errors.New("promotion does not apply to this purchase")
+	ErrPromotionExhausted     = errors.New("promotion usage limit reached")
+	ErrPromotionUserLimit     = errors.New("promotion already used the maximum number of times")
+)
+
+// Applies reports why the promotion cannot discount subtotal spent on
+// product at now, or nil if it can. Per-user limits are checked separately.
+func (p Promotion) Applies(product Product, subtotal int64, now time.Time) error {
+	switch {
+	case !p.Active,
+		p.StartsAt != nil && now.Before(*p.StartsAt),
+		p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return ErrPromotionInactive
+	case p.MaxUses > 0 && p.Uses >= p.MaxUses:
+		return ErrPromotionExhausted
+	case p.Category != "" && p.Category != product.Category,
+		subtotal < p.MinSpend:
+		return ErrPromotionNotApplicable
+	}
+	return nil
+}
+
+// Discount is the amount the promotion takes off subtotal. Percentages are
+// rounded half up to the minor unit, and no discount exceeds the subtotal.
+func (p Promotion) Discount(subtotal int64) int64 {
+	discount := p.Value
+	if p.Type == PromotionPercent {
+		discount = (subtotal*p.Value + 50) / 100
+	}
+	return min(discount, subtotal)
+}
+
+// BestPromotion picks the promotion giving userID the largest discount on
+// subtotal spent on product, from the automatic rules and the promotion with
+// code if one was entered. An entered code that cannot be used is an error
+// rather than being skipped. It returns nil when nothing applies.
+func BestPromotion(ctx context.Context, product Product, userID string, subtotal int64, code string, now time.Time) (*Promotion, int64, error) {
+	candidates, err := getAutomaticPromotions(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entered *Promotion
+	if code != "" {
+		promotion, err := GetPromotionByCode(ctx, code)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := promotion.Applies(product, subtotal, now); err != nil {
+			return nil, 0, err
+		}
+		entered = &promotion
+		candidates = append(candidates, promotion)
+	}
+
+	var best *Promotion
+	var bestDiscount int64
+	for i := range candidates {
+		promotion := candidates[i]
+		if promotion.Applies(product, subtotal, now) != nil {
+			continue
+		}
+
+		if promotion.PerUserLimit > 0 {
+			used, err := getPromotionRedemptions(ctx, promotion.ID, userID)
+			if err != nil {
+				return nil, 0, err
+			}
+			if used >= promotion.PerUserLimit {
+				if entered != nil && promotion.ID == entered.ID {
+					return nil, 0, ErrPromotionUserLimit
+				}
+				continue
+			}
+		}
+
+		if discount := promotion.Discount(subtotal); discount > bestDiscount {
+			best, bestDiscount = &promotion, discount
+		}
+	}
+
+	return best, bestDiscount, nil
+}
+
+// promotionRedemption builds the writes that count one use of a promotion by
+// userID. They fail if the promotion has been ended or has run out of uses,
+// or if the user has reached their limit, so concurrent purchases cannot
+// redeem it more often than allowed.
+func promotionRedemption(promotion Promotion, userID string) []types.TransactWriteItem {
+	usage := &types.Update{
+		TableName:           aws.String(promotionsTable),
+		Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: promotion.ID}},
+		UpdateExpression:    aws.String("ADD #uses :one"),
+		ConditionExpression: aws.String("#active = :true AND (max_uses = :zero OR #uses < max_uses)"),
+		ExpressionAttributeNames: map[string]string{
+			"#uses":   "uses",
+			"#active": "active",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":  &types.AttributeValueMemberN{Value: "1"},
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	}
+
+	redemption := &types.Update{
+		TableName:        aws.String(promotionRedemptionsTable),
+		Key:              map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: redemptionID(promotion.ID, userID)}},
+		UpdateExpression: aws.String("SET promotion_id = :promotion, user_id = :user ADD #uses :one"),
+		ExpressionAttributeNames: map[string]string{
+			"#uses": "uses",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":promotion": &types.AttributeValueMemberS{Value: promotion.ID},
+			":user":      &types.AttributeValueMemberS{Value: userID},
+			":one":       &types.AttributeValueMemberN{Value: "1"},
+		},
+	}
+	if promotion.PerUserLimit > 0 {
+		redemption.ConditionExpression = aws.String("attribute_not_exists(#uses) OR #uses < :limit")
+		redemption.ExpressionAttributeValues[":limit"] = &types.AttributeValueMemberN{Value: strconv.Itoa(promotion.PerUserLimit)}
+	}
+
+	return []types.TransactWriteItem{{Update: usage}, {Update: redemption}}
+}
+
+func redemptionID(promotionID, userID string) string {
+	return promotionID + "#" + userID
+}
+
+// getPromotionRedemptions is the number of times userID has redeemed the
+// promotion.
+func getPromotionRedemptions(ctx context.Context, promotionID, userID string) (int, error) {
+	client, err := getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(promotionRedemptionsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: redemptionID(promotionID, userID)},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("get promotion redemptions: %w", err)
+	}
+
+	var redemption struct {
+		Uses int `dynamodbav:"uses"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &redemption); err != nil {
+		return 0, fmt.Errorf("unmarshal promotion redemptions: %w", err)
+	}
+
+	return redemption.Uses, nil
+}
+
+// CreatePromotion persists a promotion. Codes are checked for uniqueness by
+// the caller.
+func CreatePromotion(ctx context.Context, promotion Promotion) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(promotion)
+	if err != nil {
+		return fmt.Errorf("marshal promotion: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(promotionsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("put promotion: %w", err)
+	}
+
+	return nil
+}
+
+// GetPromotionByID fetches a single promotion.
+func GetPromotionByID(ctx context.Context, id string) (Promotion, error) {
+	client, err := getClient()
+	if err != nil {
+		return Promotion{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(promotionsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Promotion{}, fmt.Errorf("get promotion: %w", err)
+	}
+
+	if out.Item == nil {
+		return Promotion{}, ErrPromotionNotFound
+	}
+
+	var promotion Promotion
+	if err := attributevalue.UnmarshalMap(out.Item, &promotion); err != nil {
+		return Promotion{}, fmt.Errorf("unmarshal promotion: %w", err)
+	}
+
+	return promotion, nil
+}
+
+// GetPromotionByCode fetches the promotion with the given code.
+func GetPromotionByCode(ctx context.Context, code string) (Promotion, error) {
+	client, err := getClient()
+	if err != nil {
+		return Promotion{}, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(promotionsTable),
+		IndexName:              aws.String("code-index"),
+		KeyConditionExpression: aws.String("code = :code"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":code": &types.AttributeValueMemberS{Value: code},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		return Promotion{}, fmt.Errorf("query promotion by code: %w", err)
+	}
+
+	if len(out.Items) == 0 {
+		return Promotion{}, ErrPromotionNotFound
+	}
+
+	var promotion Promotion
+	if err := attributevalue.UnmarshalMap(out.Items[0], &promotion); err != nil {
+		return Promotion{}, fmt.Errorf("unmarshal promotion: %w", err)
+	}
+
+	return promotion, nil
+}
+
+// GetPromotions lists every promotion.
+func GetPromotions(ctx context.Context) ([]Promotion, error) {
+	return scanPromotions(ctx, &dynamodb.ScanInput{
+		TableName: aws.String(promotionsTable),
+	})
+}
+
+// getAutomaticPromotions lists the active promotions that need no code.
+func getAutomaticPromotions(ctx context.Context) ([]Promotion, error) {
+	return scanPromotions(ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(promotionsTable),
+		FilterExpression: aws.String("attribute_not_exists(code) AND #active = :true"),
+		ExpressionAttributeNames: map[string]string{
+			"#active": "active",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+}
+
+func scanPromotions(ctx context.Context, input *dynamodb.ScanInput) ([]Promotion, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var promotions []Promotion
+	for {
+		out, err := client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("scan promotions: %w", err)
+		}
+
+		var page []Promotion
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal promotions: %w", err)
+		}
+		promotions = append(promotions, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return promotions, nil
+}
+
+// EndPromotion deactivates a promotion so it can no longer be redeemed. Its
+// usage counts are kept.
+func EndPromotion(ctx context.Context, id string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(promotionsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET #active = :false"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#active": "active",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":false": &types.AttributeValueMemberBOOL{Value: false},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrPromotionNotFound
+		}
+		return fmt.Errorf("end promotion: %w", err)
+	}
+
+	return nil
+}
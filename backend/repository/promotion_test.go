@@ -0,0 +1,32 @@
+package repository
+
+import "testing"
+
+func TestPromotionDiscount(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion Promotion
+		subtotal  int64
+		want      int64
+	}{
+		{name: "percent", promotion: Promotion{Type: PromotionPercent, Value: 10}, subtotal: 2000, want: 200},
+		// 10% of 1.25 is 0.125, a tie: half up gives 0.13 where half-even
+		// would give 0.12.
+		{name: "percent tie rounds up", promotion: Promotion{Type: PromotionPercent, Value: 10}, subtotal: 125, want: 13},
+		{name: "percent tie on odd cent", promotion: Promotion{Type: PromotionPercent, Value: 10}, subtotal: 135, want: 14},
+		{name: "percent just under a tie", promotion: Promotion{Type: PromotionPercent, Value: 10}, subtotal: 124, want: 12},
+		{name: "percent just over a tie", promotion: Promotion{Type: PromotionPercent, Value: 10}, subtotal: 126, want: 13},
+		{name: "percent of one cent", promotion: Promotion{Type: PromotionPercent, Value: 49}, subtotal: 1, want: 0},
+		{name: "percent of one cent at half", promotion: Promotion{Type: PromotionPercent, Value: 50}, subtotal: 1, want: 1},
+		{name: "full percent", promotion: Promotion{Type: PromotionPercent, Value: 100}, subtotal: 999, want: 999},
+		{name: "fixed", promotion: Promotion{Type: PromotionFixed, Value: 500}, subtotal: 2000, want: 500},
+		{name: "fixed capped at subtotal", promotion: Promotion{Type: PromotionFixed, Value: 500}, subtotal: 300, want: 300},
+		{name: "zero subtotal", promotion: Promotion{Type: PromotionPercent, Value: 10}, subtotal: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.promotion.Discount(tt.subtotal); got != tt.want {
+			t.Errorf("%s: Discount(%d) = %d, want %d", tt.name, tt.subtotal, got, tt.want)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -17,29 +16,63 @@ var (
 	ErrProductOutOfStock = errors.New("insufficient stock")
 )
 
-func PurchaseProduct(ctx context.Context, accountID, productID string, quantity int) error {
+// PurchaseOrder asks to buy Quantity of a product, or of its variant SKU,
+// from an account. PromotionCode is the code the buyer entered, if any, and
+// Tax the rate the buyer pays on the product.
+type PurchaseOrder struct {
+	AccountID     string
+	ProductID     string
+	SKU           string
+	Quantity      int
+	PromotionCode string
+	Tax           TaxRate
+}
+
+// PurchaseProduct fills an order at the current price, less the best
+// promotion available to the account's owner, plus tax on the discounted
+// line. The promotion's usage is counted in the same transaction. It returns
+// the recorded purchase.
+func PurchaseProduct(ctx context.Context, order PurchaseOrder) (Transaction, error) {
 	client, err := getClient()
 	if err != nil {
-		return err
+		return Transaction{}, err
 	}
 
-	account, err := GetAccountByID(ctx, accountID)
+	account, err := GetAccountByID(ctx, order.AccountID)
 	if err != nil {
-		return err
+		return Transaction{}, err
 	}
 
-	product, err := GetProductByID(ctx, productID)
+	product, err := GetProductByID(ctx, order.ProductID)
 	if err != nil {
-		return err
+		return Transaction{}, err
+	}
+
+	if product.Archived() {
+		return Transaction{}, ErrProductArchived
 	}
 
-	if product.Stock < quantity {
-		return ErrProductOutOfStock
+	if err := product.CheckVariant(order.SKU); err != nil {
+		return Transaction{}, err
 	}
 
-	totalCost := product.Price * int64(quantity)
-	if account.Balance < totalCost {
-		return ErrInsufficientBalance
+	if product.AvailableFor(order.SKU) < order.Quantity {
+		return Transaction{}, ErrProductOutOfStock
+	}
+
+	unitPrice := product.UnitPrice(order.SKU)
+	subtotal := unitPrice * int64(order.Quantity)
+
+	now := time.Now()
+	promotion, discount, err := BestPromotion(ctx, product, account.UserID, subtotal, order.PromotionCode, now)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	tax := order.Tax.Apply(subtotal - discount)
+	totalCost := tax.Gross()
+	if account.AvailableBalance() < totalCost {
+		return Transaction{}, ErrInsufficientBalance
 	}
 
 	txn := Transaction{
@@ -47,45 +80,35 @@ func PurchaseProduct(ctx context.Context, accountID, productID string, quantity
 		UserID:          account.UserID,
 		AccountID:       account.ID,
 		ProductID:       product.ID,
-		Quantity:        quantity,
-		UnitPrice:       product.Price,
+		ProductName:     product.Name,
+		SKU:             order.SKU,
+		Quantity:        order.Quantity,
+		UnitPrice:       unitPrice,
+		Discount:        discount,
 		TotalAmount:     totalCost,
 		TransactionType: "purchase",
-		CreatedAt:       time.Now(),
+		CreatedAt:       now,
+		TaxBreakdown:    tax,
+	}
+	if promotion != nil {
+		txn.PromotionID = promotion.ID
+		txn.PromotionCode = promotion.Code
 	}
 
 	txnItem, err := attributevalue.MarshalMap(txn)
 	if err != nil {
-		return fmt.Errorf("marshal transaction: %w", err)
+		return Transaction{}, fmt.Errorf("marshal transaction: %w", err)
 	}
 
-	amountValue := &types.AttributeValueMemberN{Value: strconv.FormatInt(totalCost, 10)}
-	qtyValue := &types.AttributeValueMemberN{Value: strconv.Itoa(quantity)}
+	movement, err := movementPut(saleMovement(txn))
+	if err != nil {
+		return Transaction{}, err
+	}
 
 	input := &dynamodb.TransactWriteItemsInput{
 		TransactItems: []types.TransactWriteItem{
-			{
-				Update: &types.Update{
-					TableName:           aws.String(accountsTable),
-					Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: accountID}},
-					UpdateExpression:    aws.String("SET balance = balance - :amount"),
-					ConditionExpression: aws.String("attribute_exists(id) AND balance >= :amount"),
-					ExpressionAttributeValues: map[string]types.AttributeValue{
-						":amount": amountValue,
-					},
-				},
-			},
-			{
-				Update: &types.Update{
-					TableName:           aws.String(productsTable),
-					Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: productID}},
-					UpdateExpression:    aws.String("SET stock = stock - :qty"),
-					ConditionExpression: aws.String("attribute_exists(id) AND stock >= :qty"),
-					ExpressionAttributeValues: map[string]types.AttributeValue{
-						":qty": qtyValue,
-					},
-				},
-			},
+			{Update: debitUpdate(account, totalCost)},
+			{Update: stockUpdate(product, order.SKU, order.Quantity)},
 			{
 				Put: &types.Put{
 					TableName:           aws.String(transactionsTable),
@@ -93,28 +116,37 @@ func PurchaseProduct(ctx context.Context, accountID, productID string, quantity
 					ConditionExpression: aws.String("attribute_not_exists(id)"),
 				},
 			},
+			movement,
 		},
 	}
+	if promotion != nil {
+		input.TransactItems = append(input.TransactItems, promotionRedemption(*promotion, account.UserID)...)
+	}
 
 	if _, err := client.TransactWriteItems(ctx, input); err != nil {
 		var txCancel *types.TransactionCanceledException
 		if errors.As(err, &txCancel) {
-			for _, reason := range txCancel.CancellationReasons {
-				if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
-					// Fallback to precise error based on current state.
-					if account.Balance < totalCost {
-						return ErrInsufficientBalance
-					}
-					if product.Stock < quantity {
-						return ErrProductOutOfStock
-					}
-					return ErrAccountNotFound
+			for i, reason := range txCancel.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				switch i {
+				case 0:
+					return Transaction{}, ErrInsufficientBalance
+				case 1:
+					// The stock may have run out, or a reservation
+					// changed it since it was read.
+					return Transaction{}, ErrProductOutOfStock
+				case 4:
+					return Transaction{}, ErrPromotionExhausted
+				case 5:
+					return Transaction{}, ErrPromotionUserLimit
 				}
 			}
-			return ErrAccountNotFound
+			return Transaction{}, ErrAccountNotFound
 		}
-		return fmt.Errorf("purchase transaction: %w", err)
+		return Transaction{}, fmt.Errorf("purchase transaction: %w", err)
 	}
 
-	return nil
+	return txn, nil
 }
@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	ReservationStatusActive    = "active"
+	ReservationStatusPurchased = "purchased"
+	ReservationStatusReleased  = "released"
+	ReservationStatusExpired   = "expired"
+)
+
+// Reservation sets aside units of a product for a user while they check out.
+// While active its quantity is included in the product's Reserved total, at
+// the name and unit price quoted when it was made; purchasing takes the units
+// out of stock and releasing or expiring gives them back.
+type Reservation struct {
+	ID            string    `json:"id" dynamodbav:"id"`
+	ProductID     string    `json:"product_id" dynamodbav:"product_id"`
+	ProductName   string    `json:"product_name" dynamodbav:"product_name"`
+	SKU           string    `json:"sku,omitempty" dynamodbav:"sku,omitempty"`
+	UserID        string    `json:"user_id" dynamodbav:"user_id"`
+	Quantity      int       `json:"quantity" dynamodbav:"quantity"`
+	UnitPrice     int64     `json:"unit_price" dynamodbav:"unit_price"`
+	Status        string    `json:"status" dynamodbav:"status"`
+	TransactionID string    `json:"transaction_id,omitempty" dynamodbav:"transaction_id,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at" dynamodbav:"expires_at"`
+	CreatedAt     time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationClosed   = errors.New("reservation is no longer active")
+)
+
+// CreateReservation persists an active reservation and adds it to the
+// reserved total of the product and its variant, if any, failing with
+// ErrProductOutOfStock when the quantity is not available or the product has
+// been archived.
+func CreateReservation(ctx context.Context, reservation Reservation, product Product) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(reservation)
+	if err != nil {
+		return fmt.Errorf("marshal reservation: %w", err)
+	}
+
+	values := map[string]types.AttributeValue{}
+	names := map[string]string{}
+	update := stockChange(reservation.SKU, 0, reservation.Quantity, values, names)
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(reservationsTable),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:                 aws.String(productsTable),
+					Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: product.ID}},
+					UpdateExpression:          aws.String(update),
+					ConditionExpression:       aws.String(stockCondition(product, reservation.SKU, reservation.Quantity, values, names) + " AND " + notArchived),
+					ExpressionAttributeNames:  attributeNames(names),
+					ExpressionAttributeValues: values,
+				},
+			},
+		},
+	})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 1 {
+			if code := txCancel.CancellationReasons[1].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return ErrProductOutOfStock
+			}
+		}
+		return fmt.Errorf("create reservation: %w", err)
+	}
+
+	return nil
+}
+
+// GetReservationByID fetches a single reservation.
+func GetReservationByID(ctx context.Context, id string) (Reservation, error) {
+	client, err := getClient()
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(reservationsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Reservation{}, fmt.Errorf("get reservation: %w", err)
+	}
+
+	if out.Item == nil {
+		return Reservation{}, ErrReservationNotFound
+	}
+
+	var reservation Reservation
+	if err := attributevalue.UnmarshalMap(out.Item, &reservation); err != nil {
+		return Reservation{}, fmt.Errorf("unmarshal reservation: %w", err)
+	}
+
+	return reservation, nil
+}
+
+// GetReservationsByUserID lists a user's reservations.
+func GetReservationsByUserID(ctx context.Context, userID string) ([]Reservation, error) {
+	return queryReservations(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(reservationsTable),
+		IndexName:              aws.String("user_id-index"),
+		KeyConditionExpression: aws.String("user_id = :user_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+}
+
+// GetExpiredReservations lists active reservations whose expiry has passed.
+func GetExpiredReservations(ctx context.Context, now time.Time) ([]Reservation, error) {
+	return queryReservations(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(reservationsTable),
+		IndexName:              aws.String("status-expires_at-index"),
+		KeyConditionExpression: aws.String("#status = :active AND expires_at <= :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: ReservationStatusActive},
+			":now":    &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		},
+	})
+}
+
+func queryReservations(ctx context.Context, input *dynamodb.QueryInput) ([]Reservation, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	reservations := []Reservation{}
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query reservations: %w", err)
+		}
+
+		var page []Reservation
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal reservations: %w", err)
+		}
+		reservations = append(reservations, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return reservations, nil
+}
+
+// ReleaseReservation closes an active reservation and returns its units to
+// the product's available stock. The status is ReservationStatusReleased or
+// ReservationStatusExpired. A reservation on a deleted product or variant is
+// simply closed.
+func ReleaseReservation(ctx context.Context, reservation Reservation, status string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{}
+	names := map[string]string{}
+	update := stockChange(reservation.SKU, 0, -reservation.Quantity, values, names)
+
+	err = closeReservation(ctx, client, reservation, status, "", now,
+		types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:                 aws.String(productsTable),
+				Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: reservation.ProductID}},
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String(stockExists(reservation.SKU)),
+				ExpressionAttributeNames:  attributeNames(names),
+				ExpressionAttributeValues: values,
+			},
+		},
+	)
+	if errors.Is(err, ErrProductNotFound) {
+		return closeReservation(ctx, client, reservation, status, "", now)
+	}
+	return err
+}
+
+// PurchaseReservation buys an active, unexpired reservation of a product that
+// has not been archived from account: it debits the quoted total plus tax at
+// rate, takes the units out of the stock and reserved totals, records the
+// purchase and closes the reservation, all in one transaction.
+func PurchaseReservation(ctx context.Context, reservation Reservation, account Account, rate TaxRate, now time.Time) (Transaction, error) {
+	client, err := getClient()
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	tax := rate.Apply(reservation.UnitPrice * int64(reservation.Quantity))
+	txn := Transaction{
+		ID:              "purchase_" + reservation.ID,
+		UserID:          account.UserID,
+		AccountID:       account.ID,
+		ProductID:       reservation.ProductID,
+		ProductName:     reservation.ProductName,
+		SKU:             reservation.SKU,
+		Quantity:        reservation.Quantity,
+		UnitPrice:       reservation.UnitPrice,
+		TotalAmount:     tax.Gross(),
+		TransactionType: "purchase",
+		CreatedAt:       now,
+		TaxBreakdown:    tax,
+	}
+
+	txnItem, err := attributevalue.MarshalMap(txn)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("marshal transaction: %w", err)
+	}
+
+	movement, err := movementPut(saleMovement(txn))
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	values := map[string]types.AttributeValue{}
+	names := map[string]string{}
+	update := stockChange(reservation.SKU, -reservation.Quantity, -reservation.Quantity, values, names)
+
+	err = closeReservation(ctx, client, reservation, ReservationStatusPurchased, txn.ID, now,
+		types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:                 aws.String(productsTable),
+				Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: reservation.ProductID}},
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String(stockExists(reservation.SKU) + " AND " + notArchived),
+				ExpressionAttributeNames:  attributeNames(names),
+				ExpressionAttributeValues: values,
+			},
+		},
+		types.TransactWriteItem{Update: debitUpdate(account, txn.TotalAmount)},
+		types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(transactionsTable),
+				Item:                txnItem,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+		movement,
+	)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	return txn, nil
+}
+
+// closeReservation moves an active reservation to status together with the
+// extra writes. The first extra write must be the product update, and the
+// second, if any, the account debit; their failures are reported as
+// ErrProductNotFound and ErrInsufficientBalance. Only purchases require the
+// reservation to be unexpired, so the expiry job can still close it.
+func closeReservation(ctx context.Context, client *dynamodb.Client, reservation Reservation, status, transactionID string, now time.Time, extra ...types.TransactWriteItem) error {
+	condition := "#status = :active"
+	values := map[string]types.AttributeValue{
+		":status":  &types.AttributeValueMemberS{Value: status},
+		":active":  &types.AttributeValueMemberS{Value: ReservationStatusActive},
+		":updated": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+	}
+	update := "SET #status = :status, updated_at = :updated"
+	if status == ReservationStatusPurchased {
+		condition += " AND expires_at > :updated"
+		update += ", transaction_id = :txn"
+		values[":txn"] = &types.AttributeValueMemberS{Value: transactionID}
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(reservationsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: reservation.ID}},
+				UpdateExpression:    aws.String(update),
+				ConditionExpression: aws.String(condition),
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ExpressionAttributeValues: values,
+			},
+		},
+	}
+	items = append(items, extra...)
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			for i, reason := range txCancel.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				switch i {
+				case 0:
+					return ErrReservationClosed
+				case 1:
+					return ErrProductNotFound
+				case 2:
+					return ErrInsufficientBalance
+				}
+			}
+		}
+		return fmt.Errorf("close reservation: %w", err)
+	}
+
+	return nil
+}
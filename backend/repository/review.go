@@ -0,0 +1,512 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	ReviewKindTransfer   = "transfer"
+	ReviewKindPurchase   = "purchase"
+	ReviewKindWithdrawal = "withdrawal"
+
+	ReviewStatusPending  = "pending_review"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// ReviewItem is a transfer, purchase or withdrawal parked for an admin to
+// approve or reject. Its amount is held on the paying account while it waits,
+// so approval cannot fail for lack of funds. A transfer paying a payment
+// request carries its PaymentRequestID, and one from a bulk transfer its
+// BulkTransferID and BulkItemIndex so deciding it settles that item. DueAt is
+// when the review should be decided by; ClaimedAt and DecidedAt stay zero
+// until that happens.
+type ReviewItem struct {
+	ID               string        `json:"id" dynamodbav:"id"`
+	Kind             string        `json:"kind" dynamodbav:"kind"`
+	Status           string        `json:"status" dynamodbav:"status"`
+	UserID           string        `json:"user_id" dynamodbav:"user_id"`
+	AccountID        string        `json:"account_id" dynamodbav:"account_id"`
+	ToAccountID      string        `json:"to_account_id,omitempty" dynamodbav:"to_account_id,omitempty"`
+	PaymentRequestID string        `json:"payment_request_id,omitempty" dynamodbav:"payment_request_id,omitempty"`
+	BulkTransferID   string        `json:"bulk_transfer_id,omitempty" dynamodbav:"bulk_transfer_id,omitempty"`
+	BulkItemIndex    int           `json:"bulk_item_index,omitempty" dynamodbav:"bulk_item_index,omitempty"`
+	ProductID        string        `json:"product_id,omitempty" dynamodbav:"product_id,omitempty"`
+	ProductName      string        `json:"product_name,omitempty" dynamodbav:"product_name,omitempty"`
+	SKU              string        `json:"sku,omitempty" dynamodbav:"sku,omitempty"`
+	Quantity         int           `json:"quantity,omitempty" dynamodbav:"quantity,omitempty"`
+	UnitPrice        int64         `json:"unit_price,omitempty" dynamodbav:"unit_price,omitempty"`
+	Discount         int64         `json:"discount,omitempty" dynamodbav:"discount,omitempty"`
+	PromotionID      string        `json:"promotion_id,omitempty" dynamodbav:"promotion_id,omitempty"`
+	PromotionCode    string        `json:"promotion_code,omitempty" dynamodbav:"promotion_code,omitempty"`
+	Amount           int64         `json:"amount" dynamodbav:"amount"`
+	RiskAssessmentID string        `json:"risk_assessment_id" dynamodbav:"risk_assessment_id"`
+	Triggered        []RiskRuleHit `json:"triggered" dynamodbav:"triggered"`
+	ClaimedBy        string        `json:"claimed_by,omitempty" dynamodbav:"claimed_by,omitempty"`
+	ReviewedBy       string        `json:"reviewed_by,omitempty" dynamodbav:"reviewed_by,omitempty"`
+	ReviewNote       string        `json:"review_note,omitempty" dynamodbav:"review_note,omitempty"`
+	CreatedAt        time.Time     `json:"created_at" dynamodbav:"created_at"`
+	DueAt            time.Time     `json:"due_at" dynamodbav:"due_at"`
+	ClaimedAt        time.Time     `json:"claimed_at" dynamodbav:"claimed_at"`
+	DecidedAt        time.Time     `json:"decided_at" dynamodbav:"decided_at"`
+	UpdatedAt        time.Time     `json:"updated_at" dynamodbav:"updated_at"`
+
+	TaxBreakdown
+}
+
+var (
+	ErrReviewNotFound = errors.New("review item not found")
+	ErrReviewClosed   = errors.New("review item is no longer pending")
+	ErrReviewClaimed  = errors.New("review item is claimed by another admin")
+	ErrReviewOwnItem  = errors.New("review item belongs to the reviewer")
+	ErrReviewExists   = errors.New("review item already exists")
+)
+
+// CreateReviewItem parks a payment for review, holding its amount on the
+// account in the same transaction. It fails with ErrInsufficientBalance when
+// the amount is not available, or ErrReviewExists if the ID is taken.
+func CreateReviewItem(ctx context.Context, item ReviewItem, account Account) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("marshal review item: %w", err)
+	}
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(reviewItemsTable),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{Update: holdUpdate(account, item.Amount)},
+		},
+	})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 1 {
+			if code := txCancel.CancellationReasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return ErrReviewExists
+			}
+			if code := txCancel.CancellationReasons[1].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return ErrInsufficientBalance
+			}
+		}
+		return fmt.Errorf("create review item: %w", err)
+	}
+
+	return nil
+}
+
+// GetReviewItemByID fetches a single review item.
+func GetReviewItemByID(ctx context.Context, id string) (ReviewItem, error) {
+	client, err := getClient()
+	if err != nil {
+		return ReviewItem{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(reviewItemsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return ReviewItem{}, fmt.Errorf("get review item: %w", err)
+	}
+
+	if out.Item == nil {
+		return ReviewItem{}, ErrReviewNotFound
+	}
+
+	var item ReviewItem
+	if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return ReviewItem{}, fmt.Errorf("unmarshal review item: %w", err)
+	}
+
+	return item, nil
+}
+
+// GetReviewItemsByStatus lists review items with the given status, oldest
+// first.
+func GetReviewItemsByStatus(ctx context.Context, status string) ([]ReviewItem, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(reviewItemsTable),
+		IndexName:              aws.String("status-created_at-index"),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+		},
+	}
+
+	var items []ReviewItem
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query review items: %w", err)
+		}
+
+		var page []ReviewItem
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal review items: %w", err)
+		}
+		items = append(items, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return items, nil
+}
+
+// ClaimReviewItem assigns a pending item to reviewerID unless another admin
+// has already claimed it.
+func ClaimReviewItem(ctx context.Context, item ReviewItem, reviewerID string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(reviewItemsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: item.ID},
+		},
+		UpdateExpression:    aws.String("SET claimed_by = :reviewer, claimed_at = :now, updated_at = :now"),
+		ConditionExpression: aws.String(reviewCondition),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending":  &types.AttributeValueMemberS{Value: ReviewStatusPending},
+			":reviewer": &types.AttributeValueMemberS{Value: reviewerID},
+			":now":      &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return reviewConflict(ctx, item.ID, reviewerID)
+		}
+		return fmt.Errorf("claim review item: %w", err)
+	}
+
+	return nil
+}
+
+// ApproveReviewItem executes the parked payment from its held funds and marks
+// the item approved, all in one transaction. A purchase fails with
+// ErrProductOutOfStock if the stock has run out since it was parked, or with
+// ErrPromotionExhausted or ErrPromotionUserLimit if its promotion has. A
+// transfer paying a payment request fails with ErrPaymentRequestClosed if the
+// request was cancelled or paid meanwhile, and one from a bulk transfer
+// completes its item there. Withdrawals are approved with
+// ApproveReviewWithdrawal instead.
+func ApproveReviewItem(ctx context.Context, item ReviewItem, reviewerID, note string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	account, err := GetAccountByID(ctx, item.AccountID)
+	if err != nil {
+		return err
+	}
+
+	amount := strconv.FormatInt(item.Amount, 10)
+	items := []types.TransactWriteItem{
+		{
+			// Turn the hold into a debit.
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: item.AccountID}},
+				UpdateExpression:    aws.String("SET balance = balance - :amount ADD held :release"),
+				ConditionExpression: aws.String("attribute_exists(id) AND held >= :amount"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":amount":  &types.AttributeValueMemberN{Value: amount},
+					":release": &types.AttributeValueMemberN{Value: "-" + amount},
+				},
+			},
+		},
+	}
+
+	switch item.Kind {
+	case ReviewKindTransfer:
+		toAccount, err := GetAccountByID(ctx, item.ToAccountID)
+		if err != nil {
+			return err
+		}
+
+		records, err := transferRecords("transfer_"+item.ID, account, toAccount, item.Amount, now)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: toAccount.ID}},
+				UpdateExpression:    aws.String("SET balance = balance + :amount"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":amount": &types.AttributeValueMemberN{Value: amount},
+				},
+			},
+		})
+		if item.PaymentRequestID != "" {
+			items = append(items, types.TransactWriteItem{Update: paymentRequestPaid(item.PaymentRequestID, item.AccountID, now)})
+		}
+		items = append(items, records...)
+		if item.BulkTransferID != "" {
+			items = append(items, types.TransactWriteItem{
+				Update: bulkItemReviewed(item, BulkItemCompleted, "transfer_"+item.ID, "", now),
+			})
+		}
+	case ReviewKindPurchase:
+		txn := Transaction{
+			ID:              "purchase_" + item.ID,
+			UserID:          item.UserID,
+			AccountID:       item.AccountID,
+			ProductID:       item.ProductID,
+			ProductName:     item.ProductName,
+			SKU:             item.SKU,
+			Quantity:        item.Quantity,
+			UnitPrice:       item.UnitPrice,
+			Discount:        item.Discount,
+			PromotionID:     item.PromotionID,
+			PromotionCode:   item.PromotionCode,
+			TotalAmount:     item.Amount,
+			TaxBreakdown:    item.TaxBreakdown,
+			TransactionType: "purchase",
+			CreatedAt:       now,
+		}
+
+		txnItem, err := attributevalue.MarshalMap(txn)
+		if err != nil {
+			return fmt.Errorf("marshal transaction: %w", err)
+		}
+
+		movement, err := movementPut(saleMovement(txn))
+		if err != nil {
+			return err
+		}
+
+		product, err := GetProductByID(ctx, item.ProductID)
+		if err != nil {
+			return err
+		}
+		if product.Archived() {
+			return ErrProductArchived
+		}
+		if err := product.CheckVariant(item.SKU); err != nil {
+			return err
+		}
+
+		items = append(items,
+			types.TransactWriteItem{Update: stockUpdate(product, item.SKU, item.Quantity)},
+			types.TransactWriteItem{
+				Put: &types.Put{
+					TableName:           aws.String(transactionsTable),
+					Item:                txnItem,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			movement,
+		)
+
+		// The discount was quoted when the purchase was parked; it is
+		// redeemed now, and approval fails if the promotion ran out since.
+		if item.PromotionID != "" {
+			promotion, err := GetPromotionByID(ctx, item.PromotionID)
+			if err != nil {
+				return err
+			}
+			items = append(items, promotionRedemption(promotion, item.UserID)...)
+		}
+	default:
+		return fmt.Errorf("approve review item: unknown kind %q", item.Kind)
+	}
+
+	err = decideReviewItem(ctx, client, item, ReviewStatusApproved, reviewerID, note, now, items...)
+
+	var txCancel *types.TransactionCanceledException
+	if errors.As(err, &txCancel) {
+		for i, reason := range txCancel.CancellationReasons {
+			if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+				continue
+			}
+			if item.Kind == ReviewKindTransfer && item.PaymentRequestID != "" && i == 3 {
+				return ErrPaymentRequestClosed
+			}
+			if item.Kind == ReviewKindTransfer && item.BulkTransferID != "" && i == len(items) {
+				return ErrBulkItemsClosed
+			}
+			if item.Kind == ReviewKindPurchase {
+				switch i {
+				case 2:
+					return ErrProductOutOfStock
+				case 5:
+					return ErrPromotionExhausted
+				case 6:
+					return ErrPromotionUserLimit
+				}
+			}
+			return ErrAccountNotFound
+		}
+	}
+	return err
+}
+
+// ApproveReviewWithdrawal marks a parked withdrawal approved and records it
+// as the pending external transfer in one transaction. The amount stays held,
+// now on behalf of the transfer, until the rail settles or fails it.
+func ApproveReviewWithdrawal(ctx context.Context, item ReviewItem, transfer ExternalTransfer, reviewerID, note string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	av, err := attributevalue.MarshalMap(transfer)
+	if err != nil {
+		return fmt.Errorf("marshal external transfer: %w", err)
+	}
+
+	return decideReviewItem(ctx, client, item, ReviewStatusApproved, reviewerID, note, now,
+		types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(externalTransfersTable),
+				Item:                av,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+	)
+}
+
+// RejectReviewItem marks a pending item rejected and releases its held funds.
+// An item from a bulk transfer fails there in the same transaction.
+func RejectReviewItem(ctx context.Context, item ReviewItem, reviewerID, note string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(accountsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: item.AccountID}},
+				UpdateExpression:    aws.String("ADD held :release"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":release": &types.AttributeValueMemberN{Value: strconv.FormatInt(-item.Amount, 10)},
+				},
+			},
+		},
+	}
+	if item.BulkTransferID != "" {
+		items = append(items, types.TransactWriteItem{
+			Update: bulkItemReviewed(item, BulkItemFailed, "", "Rejected in review", now),
+		})
+	}
+
+	err = decideReviewItem(ctx, client, item, ReviewStatusRejected, reviewerID, note, now, items...)
+
+	var txCancel *types.TransactionCanceledException
+	if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 2 {
+		if code := txCancel.CancellationReasons[2].Code; code != nil && *code == "ConditionalCheckFailed" {
+			return ErrBulkItemsClosed
+		}
+	}
+	return err
+}
+
+// reviewCondition admits a pending item that is unclaimed or claimed by the
+// reviewer, and never lets anyone review their own payment.
+const reviewCondition = "#status = :pending AND (attribute_not_exists(claimed_by) OR claimed_by = :reviewer) AND user_id <> :reviewer"
+
+// decideReviewItem moves an item out of pending_review, claiming it for the
+// reviewer if nobody had. A failure of the item's own condition is reported
+// as ErrReviewClosed, ErrReviewClaimed or ErrReviewOwnItem; failures of extra
+// items are returned as the raw cancellation for the caller to interpret.
+func decideReviewItem(ctx context.Context, client *dynamodb.Client, item ReviewItem, status, reviewerID, note string, now time.Time, extra ...types.TransactWriteItem) error {
+	update := "SET #status = :status, reviewed_by = :reviewer, review_note = :note, decided_at = :now, updated_at = :now"
+	if item.ClaimedBy == "" {
+		update += ", claimed_by = :reviewer, claimed_at = :now"
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:           aws.String(reviewItemsTable),
+				Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: item.ID}},
+				UpdateExpression:    aws.String(update),
+				ConditionExpression: aws.String(reviewCondition),
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":status":   &types.AttributeValueMemberS{Value: status},
+					":pending":  &types.AttributeValueMemberS{Value: ReviewStatusPending},
+					":reviewer": &types.AttributeValueMemberS{Value: reviewerID},
+					":note":     &types.AttributeValueMemberS{Value: note},
+					":now":      &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+				},
+			},
+		},
+	}
+	items = append(items, extra...)
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) && len(txCancel.CancellationReasons) > 0 {
+			if code := txCancel.CancellationReasons[0].Code; code != nil && *code == "ConditionalCheckFailed" {
+				return reviewConflict(ctx, item.ID, reviewerID)
+			}
+			return txCancel
+		}
+		return fmt.Errorf("decide review item: %w", err)
+	}
+
+	return nil
+}
+
+// reviewConflict explains why reviewCondition failed for reviewerID.
+func reviewConflict(ctx context.Context, id, reviewerID string) error {
+	current, err := GetReviewItemByID(ctx, id)
+	switch {
+	case err != nil:
+		return err
+	case current.Status != ReviewStatusPending:
+		return ErrReviewClosed
+	case current.UserID == reviewerID:
+		return ErrReviewOwnItem
+	default:
+		return ErrReviewClaimed
+	}
+}
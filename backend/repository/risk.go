@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// RiskRuleHit is a risk rule that fired, with the outcome it asked for.
+type RiskRuleHit struct {
+	Rule    string `json:"rule" dynamodbav:"rule"`
+	Outcome string `json:"outcome" dynamodbav:"outcome"`
+	Reason  string `json:"reason" dynamodbav:"reason"`
+}
+
+// RiskAssessment records the risk engine's decision on an outgoing payment
+// and the rules that led to it.
+type RiskAssessment struct {
+	ID          string        `json:"id" dynamodbav:"id"`
+	UserID      string        `json:"user_id" dynamodbav:"user_id"`
+	AccountID   string        `json:"account_id" dynamodbav:"account_id"`
+	Kind        string        `json:"kind" dynamodbav:"kind"`
+	ToAccountID string        `json:"to_account_id,omitempty" dynamodbav:"to_account_id,omitempty"`
+	ProductID   string        `json:"product_id,omitempty" dynamodbav:"product_id,omitempty"`
+	Amount      int64         `json:"amount" dynamodbav:"amount"`
+	Decision    string        `json:"decision" dynamodbav:"decision"`
+	Triggered   []RiskRuleHit `json:"triggered" dynamodbav:"triggered"`
+	CreatedAt   time.Time     `json:"created_at" dynamodbav:"created_at"`
+}
+
+// CreateRiskAssessment persists an assessment.
+func CreateRiskAssessment(ctx context.Context, assessment RiskAssessment) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(assessment)
+	if err != nil {
+		return fmt.Errorf("marshal risk assessment: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(riskAssessmentsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("put risk assessment: %w", err)
+	}
+
+	return nil
+}
+
+// GetRiskAssessmentsByUserID lists a user's assessments, newest first.
+func GetRiskAssessmentsByUserID(ctx context.Context, userID string) ([]RiskAssessment, error) {
+	return queryRiskAssessments(ctx, "user_id-created_at-index", "user_id", userID)
+}
+
+// GetRiskAssessmentsByDecision lists assessments with the given decision,
+// newest first.
+func GetRiskAssessmentsByDecision(ctx context.Context, decision string) ([]RiskAssessment, error) {
+	return queryRiskAssessments(ctx, "decision-created_at-index", "decision", decision)
+}
+
+func queryRiskAssessments(ctx context.Context, index, attr, value string) ([]RiskAssessment, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(riskAssessmentsTable),
+		IndexName:              aws.String(index),
+		KeyConditionExpression: aws.String("#key = :value"),
+		ExpressionAttributeNames: map[string]string{
+			"#key": attr,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value": &types.AttributeValueMemberS{Value: value},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	var assessments []RiskAssessment
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query risk assessments: %w", err)
+		}
+
+		var page []RiskAssessment
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal risk assessments: %w", err)
+		}
+		assessments = append(assessments, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return assessments, nil
+}
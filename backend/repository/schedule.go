@@ -0,0 +1,354 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	ScheduleStatusActive    = "active"
+	ScheduleStatusPaused    = "paused"
+	ScheduleStatusCancelled = "cancelled"
+	ScheduleStatusCompleted = "completed"
+	ScheduleStatusFailed    = "failed"
+
+	FrequencyOnce    = "once"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// ScheduledTransfer is a future-dated or recurring transfer instruction.
+// Occurrence is the zero-based index of the next occurrence to execute and
+// NextRunAt is when the worker should attempt it, which is later than the
+// nominal occurrence time while a failed attempt is waiting to be retried.
+type ScheduledTransfer struct {
+	ID             string    `json:"id" dynamodbav:"id"`
+	UserID         string    `json:"user_id" dynamodbav:"user_id"`
+	FromAccountID  string    `json:"from_account_id" dynamodbav:"from_account_id"`
+	ToAccountID    string    `json:"to_account_id" dynamodbav:"to_account_id"`
+	Amount         int64     `json:"amount" dynamodbav:"amount"`
+	Frequency      string    `json:"frequency" dynamodbav:"frequency"`
+	StartAt        time.Time `json:"start_at" dynamodbav:"start_at"`
+	EndAt          time.Time `json:"end_at" dynamodbav:"end_at"`
+	MaxOccurrences int       `json:"max_occurrences,omitempty" dynamodbav:"max_occurrences,omitempty"`
+	Occurrence     int       `json:"occurrence" dynamodbav:"occurrence"`
+	NextRunAt      time.Time `json:"next_run_at" dynamodbav:"next_run_at"`
+	RunCount       int       `json:"run_count" dynamodbav:"run_count"`
+	FailureCount   int       `json:"failure_count" dynamodbav:"failure_count"`
+	Status         string    `json:"status" dynamodbav:"status"`
+	LastError      string    `json:"last_error,omitempty" dynamodbav:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// ScheduleRun records a single execution attempt of a scheduled transfer.
+// Successful runs, and runs handed to the review queue under ReviewID, are
+// keyed by schedule and occurrence so that an occurrence can only ever be
+// executed once.
+type ScheduleRun struct {
+	ID         string    `json:"id" dynamodbav:"id"`
+	ScheduleID string    `json:"schedule_id" dynamodbav:"schedule_id"`
+	Occurrence int       `json:"occurrence" dynamodbav:"occurrence"`
+	Attempt    int       `json:"attempt" dynamodbav:"attempt"`
+	Status     string    `json:"status" dynamodbav:"status"`
+	Error      string    `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	ReviewID   string    `json:"review_id,omitempty" dynamodbav:"review_id,omitempty"`
+	Amount     int64     `json:"amount" dynamodbav:"amount"`
+	ExecutedAt time.Time `json:"executed_at" dynamodbav:"executed_at"`
+}
+
+var (
+	ErrScheduleNotFound      = errors.New("scheduled transfer not found")
+	ErrScheduleStateConflict = errors.New("scheduled transfer state changed")
+	ErrScheduleRunExists     = errors.New("schedule run already recorded")
+)
+
+// ScheduleRunID returns the idempotency key for a successful occurrence.
+func ScheduleRunID(scheduleID string, occurrence int) string {
+	return scheduleID + "#" + strconv.Itoa(occurrence)
+}
+
+// CreateScheduledTransfer persists a new scheduled transfer.
+func CreateScheduledTransfer(ctx context.Context, schedule ScheduledTransfer) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(schedule)
+	if err != nil {
+		return fmt.Errorf("marshal scheduled transfer: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(schedulesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("put scheduled transfer: %w", err)
+	}
+
+	return nil
+}
+
+// GetScheduledTransferByID fetches a single scheduled transfer.
+func GetScheduledTransferByID(ctx context.Context, id string) (ScheduledTransfer, error) {
+	client, err := getClient()
+	if err != nil {
+		return ScheduledTransfer{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(schedulesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return ScheduledTransfer{}, fmt.Errorf("get scheduled transfer: %w", err)
+	}
+
+	if out.Item == nil {
+		return ScheduledTransfer{}, ErrScheduleNotFound
+	}
+
+	var schedule ScheduledTransfer
+	if err := attributevalue.UnmarshalMap(out.Item, &schedule); err != nil {
+		return ScheduledTransfer{}, fmt.Errorf("unmarshal scheduled transfer: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// GetScheduledTransfersByUserID lists scheduled transfers created by the user.
+func GetScheduledTransfersByUserID(ctx context.Context, userID string) ([]ScheduledTransfer, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(schedulesTable),
+		IndexName:              aws.String("user_id-index"),
+		KeyConditionExpression: aws.String("user_id = :user"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query scheduled transfers: %w", err)
+	}
+
+	var schedules []ScheduledTransfer
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &schedules); err != nil {
+		return nil, fmt.Errorf("unmarshal scheduled transfers: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// GetDueScheduledTransfers returns active schedules whose next run is at or before now.
+func GetDueScheduledTransfers(ctx context.Context, now time.Time) ([]ScheduledTransfer, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(schedulesTable),
+		IndexName:              aws.String("status-next_run_at-index"),
+		KeyConditionExpression: aws.String("#status = :active AND next_run_at <= :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: ScheduleStatusActive},
+			":now":    &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339Nano)},
+		},
+	}
+
+	var schedules []ScheduledTransfer
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query due scheduled transfers: %w", err)
+		}
+
+		var page []ScheduledTransfer
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal scheduled transfers: %w", err)
+		}
+		schedules = append(schedules, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return schedules, nil
+}
+
+// UpdateScheduledTransferStatus moves a schedule to a new status, provided its
+// current status is one of the allowed ones.
+func UpdateScheduledTransferStatus(ctx context.Context, id, status string, allowed ...string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	exprValues := map[string]types.AttributeValue{
+		":status":  &types.AttributeValueMemberS{Value: status},
+		":updated": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339Nano)},
+	}
+	condition := "attribute_exists(id)"
+	if len(allowed) > 0 {
+		condition += " AND " + inCondition("#status", allowed, exprValues)
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(schedulesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          aws.String("SET #status = :status, updated_at = :updated"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: exprValues,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrScheduleStateConflict
+		}
+		return fmt.Errorf("update scheduled transfer status: %w", err)
+	}
+
+	return nil
+}
+
+// SaveScheduledTransferProgress writes the worker's bookkeeping for a schedule.
+// The update only applies while the schedule is still active and still on the
+// occurrence the worker processed, so a concurrent pause or cancel wins.
+func SaveScheduledTransferProgress(ctx context.Context, schedule ScheduledTransfer, processedOccurrence int) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	exprValues := map[string]types.AttributeValue{
+		":occurrence": &types.AttributeValueMemberN{Value: strconv.Itoa(schedule.Occurrence)},
+		":next":       &types.AttributeValueMemberS{Value: schedule.NextRunAt.UTC().Format(time.RFC3339Nano)},
+		":runs":       &types.AttributeValueMemberN{Value: strconv.Itoa(schedule.RunCount)},
+		":failures":   &types.AttributeValueMemberN{Value: strconv.Itoa(schedule.FailureCount)},
+		":status":     &types.AttributeValueMemberS{Value: schedule.Status},
+		":lastError":  &types.AttributeValueMemberS{Value: schedule.LastError},
+		":updated":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339Nano)},
+		":active":     &types.AttributeValueMemberS{Value: ScheduleStatusActive},
+		":processed":  &types.AttributeValueMemberN{Value: strconv.Itoa(processedOccurrence)},
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(schedulesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: schedule.ID},
+		},
+		UpdateExpression:          aws.String("SET occurrence = :occurrence, next_run_at = :next, run_count = :runs, failure_count = :failures, #status = :status, last_error = :lastError, updated_at = :updated"),
+		ConditionExpression:       aws.String("#status = :active AND occurrence = :processed"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: exprValues,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrScheduleStateConflict
+		}
+		return fmt.Errorf("save scheduled transfer progress: %w", err)
+	}
+
+	return nil
+}
+
+// ScheduleRunPut builds a transaction item that records a successful run and
+// fails if the occurrence has already been executed.
+func ScheduleRunPut(run ScheduleRun) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(run)
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("marshal schedule run: %w", err)
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:           aws.String(scheduleRunsTable),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		},
+	}, nil
+}
+
+// CreateScheduleRun records a run outside of a transfer, e.g. a failed
+// attempt, failing with ErrScheduleRunExists if a run with its ID has already
+// been recorded.
+func CreateScheduleRun(ctx context.Context, run ScheduleRun) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(run)
+	if err != nil {
+		return fmt.Errorf("marshal schedule run: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(scheduleRunsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrScheduleRunExists
+		}
+		return fmt.Errorf("put schedule run: %w", err)
+	}
+
+	return nil
+}
+
+// GetScheduleRuns lists recorded runs for a scheduled transfer.
+func GetScheduleRuns(ctx context.Context, scheduleID string) ([]ScheduleRun, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(scheduleRunsTable),
+		IndexName:              aws.String("schedule_id-index"),
+		KeyConditionExpression: aws.String("schedule_id = :schedule"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":schedule": &types.AttributeValueMemberS{Value: scheduleID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query schedule runs: %w", err)
+	}
+
+	var runs []ScheduleRun
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &runs); err != nil {
+		return nil, fmt.Errorf("unmarshal schedule runs: %w", err)
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// IssuedStatement is an account's statement for one calendar month, frozen
+// when it was issued. DocumentKey names the gzipped JSON statement in the
+// statement blob store and Checksum is the hex SHA-256 of the uncompressed
+// JSON. Statements issued before documents moved out of the table carry the
+// gzipped JSON in Document instead. Issued statements are never updated.
+type IssuedStatement struct {
+	ID             string           `json:"id" dynamodbav:"id"`
+	AccountID      string           `json:"account_id" dynamodbav:"account_id"`
+	UserID         string           `json:"user_id" dynamodbav:"user_id"`
+	Month          string           `json:"month" dynamodbav:"month"`
+	PeriodStart    time.Time        `json:"period_start" dynamodbav:"period_start"`
+	PeriodEnd      time.Time        `json:"period_end" dynamodbav:"period_end"`
+	OpeningBalance int64            `json:"opening_balance" dynamodbav:"opening_balance"`
+	ClosingBalance int64            `json:"closing_balance" dynamodbav:"closing_balance"`
+	Totals         map[string]int64 `json:"totals" dynamodbav:"totals"`
+	TaxTotal       int64            `json:"tax_total" dynamodbav:"tax_total"`
+	LineCount      int              `json:"line_count" dynamodbav:"line_count"`
+	Checksum       string           `json:"checksum" dynamodbav:"checksum"`
+	DocumentKey    string           `json:"-" dynamodbav:"document_key,omitempty"`
+	Document       []byte           `json:"-" dynamodbav:"document,omitempty"`
+	IssuedAt       time.Time        `json:"issued_at" dynamodbav:"issued_at"`
+}
+
+var (
+	ErrStatementNotFound = errors.New("statement not found")
+	ErrStatementExists   = errors.New("statement already issued")
+)
+
+// IssuedStatementID is the key of an account's statement for month (2006-01).
+func IssuedStatementID(accountID, month string) string {
+	return accountID + "_" + month
+}
+
+// CreateIssuedStatement stores a newly issued statement. It returns
+// ErrStatementExists if the account already has one for that month, leaving
+// the existing statement untouched.
+func CreateIssuedStatement(ctx context.Context, statement IssuedStatement) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(statement)
+	if err != nil {
+		return fmt.Errorf("marshal statement: %w", err)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(statementsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrStatementExists
+		}
+		return fmt.Errorf("put statement: %w", err)
+	}
+
+	return nil
+}
+
+// IssuedStatementExists reports whether an account's statement for month has
+// been issued, reading only its key.
+func IssuedStatementExists(ctx context.Context, accountID, month string) (bool, error) {
+	client, err := getClient()
+	if err != nil {
+		return false, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(statementsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: IssuedStatementID(accountID, month)},
+		},
+		ProjectionExpression: aws.String("id"),
+	})
+	if err != nil {
+		return false, fmt.Errorf("get statement: %w", err)
+	}
+
+	return out.Item != nil, nil
+}
+
+// GetIssuedStatement fetches an account's statement for month, including a
+// legacy inline document.
+func GetIssuedStatement(ctx context.Context, accountID, month string) (IssuedStatement, error) {
+	client, err := getClient()
+	if err != nil {
+		return IssuedStatement{}, err
+	}
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(statementsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: IssuedStatementID(accountID, month)},
+		},
+	})
+	if err != nil {
+		return IssuedStatement{}, fmt.Errorf("get statement: %w", err)
+	}
+
+	if out.Item == nil {
+		return IssuedStatement{}, ErrStatementNotFound
+	}
+
+	var statement IssuedStatement
+	if err := attributevalue.UnmarshalMap(out.Item, &statement); err != nil {
+		return IssuedStatement{}, fmt.Errorf("unmarshal statement: %w", err)
+	}
+
+	return statement, nil
+}
+
+// GetIssuedStatementsByAccountID lists an account's issued statements, newest
+// first. Documents are not loaded.
+func GetIssuedStatementsByAccountID(ctx context.Context, accountID string) ([]IssuedStatement, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(statementsTable),
+		IndexName:              aws.String("account_id-month-index"),
+		KeyConditionExpression: aws.String("account_id = :account_id"),
+		ProjectionExpression: aws.String("id, account_id, user_id, #month, period_start, period_end, " +
+			"opening_balance, closing_balance, totals, tax_total, line_count, checksum, issued_at"),
+		ExpressionAttributeNames: map[string]string{
+			"#month": "month",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":account_id": &types.AttributeValueMemberS{Value: accountID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	statements := []IssuedStatement{}
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query statements: %w", err)
+		}
+
+		var page []IssuedStatement
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal statements: %w", err)
+		}
+		statements = append(statements, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	return statements, nil
+}
@@ -0,0 +1,37 @@
+package repository
+
+// TaxRate is the rate, in basis points, charged on a product's tax class in
+// the buyer's jurisdiction.
+type TaxRate struct {
+	Jurisdiction string
+	Class        string
+	Rate         int64
+}
+
+// Apply works out the tax on a line's net amount, rounded half up to the
+// minor unit.
+func (t TaxRate) Apply(net int64) TaxBreakdown {
+	return TaxBreakdown{
+		Jurisdiction: t.Jurisdiction,
+		Class:        t.Class,
+		Rate:         t.Rate,
+		Net:          net,
+		Tax:          (net*t.Rate + 5000) / 10000,
+	}
+}
+
+// TaxBreakdown records how a purchase's gross amount splits into net and
+// tax, and the rate that was applied. Purchases made before tax was charged
+// have none.
+type TaxBreakdown struct {
+	Jurisdiction string `json:"tax_jurisdiction,omitempty" dynamodbav:"tax_jurisdiction,omitempty"`
+	Class        string `json:"tax_class,omitempty" dynamodbav:"tax_class,omitempty"`
+	Rate         int64  `json:"tax_rate_bp,omitempty" dynamodbav:"tax_rate_bp,omitempty"`
+	Net          int64  `json:"net_amount,omitempty" dynamodbav:"net_amount,omitempty"`
+	Tax          int64  `json:"tax_amount,omitempty" dynamodbav:"tax_amount,omitempty"`
+}
+
+// Gross is the amount charged: net plus tax.
+func (b TaxBreakdown) Gross() int64 {
+	return b.Net + b.Tax
+}
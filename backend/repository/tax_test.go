@@ -0,0 +1,39 @@
+package repository
+
+import "testing"
+
+func TestTaxRateApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    int64
+		net     int64
+		wantTax int64
+	}{
+		{name: "whole", rate: 2000, net: 1000, wantTax: 200},
+		// 8.25% of 0.10 is 0.825 cents and of 0.06 is 0.495 cents.
+		{name: "rounds up", rate: 825, net: 10, wantTax: 1},
+		{name: "rounds down", rate: 825, net: 6, wantTax: 0},
+		// 5% of 0.10, 0.30 and 0.50 is 0.5, 1.5 and 2.5 cents. Ties always
+		// round up, so the last gives 3 where half-even would give 2.
+		{name: "tie rounds up", rate: 500, net: 10, wantTax: 1},
+		{name: "tie on odd cent", rate: 500, net: 30, wantTax: 2},
+		{name: "tie on even cent", rate: 500, net: 50, wantTax: 3},
+		{name: "just under a tie", rate: 500, net: 9, wantTax: 0},
+		{name: "just over a tie", rate: 500, net: 11, wantTax: 1},
+		{name: "zero rate", rate: 0, net: 1999, wantTax: 0},
+		{name: "zero net", rate: 2000, net: 0, wantTax: 0},
+	}
+
+	for _, tt := range tests {
+		rate := TaxRate{Jurisdiction: "GB", Class: "standard", Rate: tt.rate}
+		got := rate.Apply(tt.net)
+
+		want := TaxBreakdown{Jurisdiction: "GB", Class: "standard", Rate: tt.rate, Net: tt.net, Tax: tt.wantTax}
+		if got != want {
+			t.Errorf("%s: Apply(%d) = %+v, want %+v", tt.name, tt.net, got, want)
+		}
+		if got.Gross() != tt.net+tt.wantTax {
+			t.Errorf("%s: Gross() = %d, want %d", tt.name, got.Gross(), tt.net+tt.wantTax)
+		}
+	}
+}
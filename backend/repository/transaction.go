@@ -11,16 +11,43 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// Transaction is a ledger entry. Purchases record the product's name and
+// unit price at the time of sale so history reads the same after the product
+// is edited or archived, and how their total splits into net and tax.
 type Transaction struct {
 	ID              string    `json:"id" dynamodbav:"id"`
 	UserID          string    `json:"user_id" dynamodbav:"user_id"`
 	AccountID       string    `json:"account_id" dynamodbav:"account_id"`
 	ProductID       string    `json:"product_id" dynamodbav:"product_id"`
+	ProductName     string    `json:"product_name,omitempty" dynamodbav:"product_name,omitempty"`
+	SKU             string    `json:"sku,omitempty" dynamodbav:"sku,omitempty"`
 	Quantity        int       `json:"quantity" dynamodbav:"quantity"`
 	UnitPrice       int64     `json:"unit_price" dynamodbav:"unit_price"`
+	Discount        int64     `json:"discount,omitempty" dynamodbav:"discount,omitempty"`
+	PromotionID     string    `json:"promotion_id,omitempty" dynamodbav:"promotion_id,omitempty"`
+	PromotionCode   string    `json:"promotion_code,omitempty" dynamodbav:"promotion_code,omitempty"`
 	TotalAmount     int64     `json:"total_amount" dynamodbav:"total_amount"`
 	TransactionType string    `json:"transaction_type" dynamodbav:"transaction_type"`
+	Direction       string    `json:"direction,omitempty" dynamodbav:"direction,omitempty"`
+	Counterparty    string    `json:"counterparty_account_id,omitempty" dynamodbav:"counterparty_account_id,omitempty"`
 	CreatedAt       time.Time `json:"created_at" dynamodbav:"created_at"`
+
+	TaxBreakdown
+}
+
+// SignedAmount is the transaction's effect on its account's balance: positive
+// for money in, negative for money out. Transactions without a Direction are
+// debits except for deposits and interest.
+func (t Transaction) SignedAmount() int64 {
+	credit := t.Direction == "credit"
+	if t.Direction == "" {
+		credit = t.TransactionType == "deposit" || t.TransactionType == "interest"
+	}
+
+	if credit {
+		return t.TotalAmount
+	}
+	return -t.TotalAmount
 }
 
 func CreateTransaction(ctx context.Context, txData Transaction) error {
@@ -79,7 +106,7 @@ func GetTransactionsByAccountID(ctx context.Context, accountID string) ([]Transa
 		return nil, err
 	}
 
-	out, err := client.Query(ctx, &dynamodb.QueryInput{
+	input := &dynamodb.QueryInput{
 		TableName:              aws.String(transactionsTable),
 		IndexName:              aws.String("account_id-index"),
 		KeyConditionExpression: aws.String("account_id = :account"),
@@ -87,14 +114,25 @@ func GetTransactionsByAccountID(ctx context.Context, accountID string) ([]Transa
 			":account": &types.AttributeValueMemberS{Value: accountID},
 		},
 		ScanIndexForward: aws.Bool(false),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("query transactions by account: %w", err)
 	}
 
 	var transactions []Transaction
-	if err := attributevalue.UnmarshalListOfMaps(out.Items, &transactions); err != nil {
-		return nil, fmt.Errorf("unmarshal transactions: %w", err)
+	for {
+		out, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query transactions by account: %w", err)
+		}
+
+		var page []Transaction
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal transactions: %w", err)
+		}
+		transactions = append(transactions, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
 	}
 
 	return transactions, nil
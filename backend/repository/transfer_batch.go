@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TransferBatch records an imported payment file under its message ID, so
+// the same file is never executed twice.
+type TransferBatch struct {
+	ID        string    `json:"id" dynamodbav:"id"`
+	UserID    string    `json:"user_id" dynamodbav:"user_id"`
+	MessageID string    `json:"message_id" dynamodbav:"message_id"`
+	Mode      string    `json:"mode" dynamodbav:"mode"`
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+// BatchTransfer is one transfer of an all-or-nothing batch.
+type BatchTransfer struct {
+	ID            string
+	FromAccountID string
+	ToAccountID   string
+	Amount        int64
+}
+
+var ErrTransferBatchExists = errors.New("transfer batch already submitted")
+
+// TransferBatchID is the ID of the batch with messageID. Message IDs are only
+// unique per sender, so the ID is derived from both.
+func TransferBatchID(userID, messageID string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + messageID))
+	return "batch_" + hex.EncodeToString(sum[:16])
+}
+
+// TransferBatchSize is the number of transaction operations an all-or-nothing
+// batch of transfers touching the given number of accounts needs at most: the
+// batch record, one update per account and two records per transfer.
+func TransferBatchSize(accounts, transfers int) int {
+	return 1 + accounts + 2*transfers
+}
+
+// CreateTransferBatch records a batch, or returns ErrTransferBatchExists if
+// its message was already submitted.
+func CreateTransferBatch(ctx context.Context, batch TransferBatch) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	put, err := transferBatchPut(batch)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           put.TableName,
+		Item:                put.Item,
+		ConditionExpression: put.ConditionExpression,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrTransferBatchExists
+		}
+		return fmt.Errorf("put transfer batch: %w", err)
+	}
+
+	return nil
+}
+
+func transferBatchPut(batch TransferBatch) (*types.Put, error) {
+	item, err := attributevalue.MarshalMap(batch)
+	if err != nil {
+		return nil, fmt.Errorf("marshal transfer batch: %w", err)
+	}
+
+	return &types.Put{
+		TableName:           aws.String(transferBatchesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	}, nil
+}
+
+// ExecuteTransferBatch records the batch, executes its transfers and parks its
+// reviews, holding their amounts, in a single transaction, so either all of it
+// happens or none does. Each account is changed by one update netting what
+// the batch moves through it; money leaving an account must fit in its
+// available balance before anything the batch pays into it. accounts holds
+// every account involved, as read. It fails with ErrTransferBatchExists if
+// the message was already submitted, ErrInsufficientBalance if a paying
+// account's funds, holds or limit changed, or ErrAccountNotFound if an
+// account is gone.
+func ExecuteTransferBatch(ctx context.Context, batch TransferBatch, transfers []BatchTransfer, reviews []ReviewItem, accounts map[string]Account, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	batchPut, err := transferBatchPut(batch)
+	if err != nil {
+		return err
+	}
+
+	var order []string
+	deltas := map[string]int64{}
+	outgoing := map[string]int64{}
+	holds := map[string]int64{}
+	touch := func(id string) {
+		if _, ok := deltas[id]; !ok {
+			order = append(order, id)
+			deltas[id] = 0
+		}
+	}
+
+	var puts []types.TransactWriteItem
+	for _, transfer := range transfers {
+		touch(transfer.FromAccountID)
+		touch(transfer.ToAccountID)
+		deltas[transfer.FromAccountID] -= transfer.Amount
+		deltas[transfer.ToAccountID] += transfer.Amount
+		outgoing[transfer.FromAccountID] += transfer.Amount
+
+		records, err := transferRecords(transfer.ID, accounts[transfer.FromAccountID], accounts[transfer.ToAccountID], transfer.Amount, now)
+		if err != nil {
+			return err
+		}
+		puts = append(puts, records...)
+	}
+	for _, review := range reviews {
+		touch(review.AccountID)
+		holds[review.AccountID] += review.Amount
+		outgoing[review.AccountID] += review.Amount
+
+		item, err := attributevalue.MarshalMap(review)
+		if err != nil {
+			return fmt.Errorf("marshal review item: %w", err)
+		}
+		puts = append(puts, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(reviewItemsTable),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		})
+	}
+
+	items := []types.TransactWriteItem{{Put: batchPut}}
+	for _, id := range order {
+		values := map[string]types.AttributeValue{
+			":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(deltas[id], 10)},
+		}
+		update := "SET balance = balance + :delta"
+		if holds[id] > 0 {
+			values[":hold"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(holds[id], 10)}
+			update += " ADD held :hold"
+		}
+		condition := "attribute_exists(id)"
+		if outgoing[id] > 0 {
+			condition = availableCondition(accounts[id], outgoing[id], values)
+		}
+
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:                 aws.String(accountsTable),
+				Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String(condition),
+				ExpressionAttributeValues: values,
+			},
+		})
+	}
+	items = append(items, puts...)
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var txCancel *types.TransactionCanceledException
+		if errors.As(err, &txCancel) {
+			for i, reason := range txCancel.CancellationReasons {
+				if reason.Code == nil || *reason.Code != "ConditionalCheckFailed" {
+					continue
+				}
+				switch {
+				case i == 0:
+					return ErrTransferBatchExists
+				case i <= len(order) && outgoing[order[i-1]] > 0:
+					return ErrInsufficientBalance
+				case i <= len(order):
+					return ErrAccountNotFound
+				default:
+					return ErrTransferConflict
+				}
+			}
+		}
+		return fmt.Errorf("execute transfer batch: %w", err)
+	}
+
+	return nil
+}
@@ -12,16 +12,21 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
-// User represents a user in the system.
+// User represents a user in the system. Version counts profile edits and is
+// served as the profile's ETag.
 type User struct {
-	ID           string    `json:"id" dynamodbav:"id"`
-	Username     string    `json:"username" dynamodbav:"username"`
-	Email        string    `json:"email" dynamodbav:"email"`
-	PasswordHash string    `json:"-" dynamodbav:"password_hash"`
-	FullName     string    `json:"full_name" dynamodbav:"full_name"`
-	Role         string    `json:"role" dynamodbav:"role"`
-	CreatedAt    time.Time `json:"created_at" dynamodbav:"created_at"`
-	LastLogin    time.Time `json:"last_login" dynamodbav:"last_login"`
+	ID               string    `json:"id" dynamodbav:"id"`
+	Username         string    `json:"username" dynamodbav:"username"`
+	Email            string    `json:"email" dynamodbav:"email"`
+	PasswordHash     string    `json:"-" dynamodbav:"password_hash"`
+	FullName         string    `json:"full_name" dynamodbav:"full_name"`
+	Role             string    `json:"role" dynamodbav:"role"`
+	CreatedAt        time.Time `json:"created_at" dynamodbav:"created_at"`
+	LastLogin        time.Time `json:"last_login" dynamodbav:"last_login"`
+	PasswordChanged  time.Time `json:"password_changed_at" dynamodbav:"password_changed_at"`
+	DefaultAccountID string    `json:"default_account_id,omitempty" dynamodbav:"default_account_id,omitempty"`
+	TaxJurisdiction  string    `json:"tax_jurisdiction,omitempty" dynamodbav:"tax_jurisdiction,omitempty"`
+	Version          int64     `json:"version" dynamodbav:"version"`
 }
 
 var (
@@ -84,6 +89,38 @@ func GetUserByEmail(ctx context.Context, email string) (User, error) {
 	return user, nil
 }
 
+// GetUserByUsername fetches a user by username.
+func GetUserByUsername(ctx context.Context, username string) (User, error) {
+	client, err := getClient()
+	if err != nil {
+		return User{}, err
+	}
+
+	out, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(usersTable),
+		IndexName:              aws.String("username-index"),
+		KeyConditionExpression: aws.String("username = :username"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":username": &types.AttributeValueMemberS{Value: username},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		return User{}, fmt.Errorf("query user by username: %w", err)
+	}
+
+	if len(out.Items) == 0 {
+		return User{}, ErrUserNotFound
+	}
+
+	var user User
+	if err := attributevalue.UnmarshalMap(out.Items[0], &user); err != nil {
+		return User{}, fmt.Errorf("unmarshal user: %w", err)
+	}
+
+	return user, nil
+}
+
 // GetUserByID fetches a user by id.
 func GetUserByID(ctx context.Context, id string) (User, error) {
 	client, err := getClient()
@@ -113,7 +150,8 @@ func GetUserByID(ctx context.Context, id string) (User, error) {
 	return user, nil
 }
 
-// UpdateUser updates mutable columns for a user.
+// UpdateUser updates mutable columns for a user if it is still at
+// user.Version, failing with ErrVersionConflict otherwise.
 func UpdateUser(ctx context.Context, user User) error {
 	client, err := getClient()
 	if err != nil {
@@ -133,23 +171,33 @@ func UpdateUser(ctx context.Context, user User) error {
 	} else {
 		exprVals[":lastLogin"] = &types.AttributeValueMemberS{Value: user.LastLogin.Format(time.RFC3339Nano)}
 	}
+	condition, setVersion := versionUpdate(user.Version, exprVals)
+
+	update := "SET username = :username, email = :email, password_hash = :passwordHash, full_name = :fullName, #role = :role, last_login = :lastLogin, " + setVersion
+	if user.TaxJurisdiction != "" {
+		exprVals[":taxJurisdiction"] = &types.AttributeValueMemberS{Value: user.TaxJurisdiction}
+		update += ", tax_jurisdiction = :taxJurisdiction"
+	} else {
+		update += " REMOVE tax_jurisdiction"
+	}
 
 	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(usersTable),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: user.ID},
 		},
-		UpdateExpression:          aws.String("SET username = :username, email = :email, password_hash = :passwordHash, full_name = :fullName, #role = :role, last_login = :lastLogin"),
-		ConditionExpression:       aws.String("attribute_exists(id)"),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String(condition),
 		ExpressionAttributeValues: exprVals,
 		ExpressionAttributeNames: map[string]string{
 			"#role": "role",
 		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 	if err != nil {
 		var ccf *types.ConditionalCheckFailedException
 		if errors.As(err, &ccf) {
-			return ErrUserNotFound
+			return versionFailure(ccf, ErrUserNotFound)
 		}
 		return fmt.Errorf("update user: %w", err)
 	}
@@ -236,6 +284,73 @@ func UpdateUserLastLogin(ctx context.Context, id string, lastLogin time.Time) er
 	return nil
 }
 
+// UpdatePassword replaces a user's password hash and records when it changed.
+// It moves the user to a new version so an UpdateUser made against the old
+// one cannot write the previous hash back.
+func UpdatePassword(ctx context.Context, id, passwordHash string, changedAt time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET password_hash = :passwordHash, password_changed_at = :changedAt ADD version :one"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":passwordHash": &types.AttributeValueMemberS{Value: passwordHash},
+			":changedAt":    &types.AttributeValueMemberS{Value: changedAt.UTC().Format(time.RFC3339Nano)},
+			":one":          &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("update password: %w", err)
+	}
+
+	return nil
+}
+
+// SetDefaultAccount designates the account that receives transfers addressed
+// to the user by username or email, if the user is still at version.
+func SetDefaultAccount(ctx context.Context, userID, accountID string, version int64) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":account": &types.AttributeValueMemberS{Value: accountID},
+	}
+	condition, setVersion := versionUpdate(version, values)
+
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression:                    aws.String("SET default_account_id = :account, " + setVersion),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return versionFailure(ccf, ErrUserNotFound)
+		}
+		return fmt.Errorf("set default account: %w", err)
+	}
+
+	return nil
+}
+
 // GetAllUsers returns non-admin users for directory views.
 func GetAllUsers(ctx context.Context) ([]User, error) {
 	client, err := getClient()
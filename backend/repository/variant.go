@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MaxProductVariants bounds the variants of one product, keeping the writes
+// that create it within a single transaction.
+const MaxProductVariants = 50
+
+// ProductVariant is a purchasable version of a product, such as a size or
+// colour, identified by its SKU. Price overrides the product's price when
+// set. Stock and Reserved are the variant's share of the product's totals.
+type ProductVariant struct {
+	SKU        string            `json:"sku" dynamodbav:"sku"`
+	Attributes map[string]string `json:"attributes" dynamodbav:"attributes"`
+	Price      int64             `json:"price,omitempty" dynamodbav:"price,omitempty"`
+	Stock      int               `json:"stock" dynamodbav:"stock"`
+	Reserved   int               `json:"reserved" dynamodbav:"reserved"`
+}
+
+// AvailableStock is the quantity of the variant that can still be bought or
+// reserved.
+func (v ProductVariant) AvailableStock() int {
+	return v.Stock - v.Reserved
+}
+
+// MarshalJSON adds the available quantity to the variant.
+func (v ProductVariant) MarshalJSON() ([]byte, error) {
+	type variant ProductVariant
+	return json.Marshal(struct {
+		variant
+		Available int `json:"available"`
+	}{variant(v), v.AvailableStock()})
+}
+
+var (
+	ErrVariantRequired = errors.New("product variant required")
+	ErrVariantNotFound = errors.New("product variant not found")
+	ErrVariantInUse    = errors.New("product variant has stock")
+	ErrProductHasStock = errors.New("product has stock of its own")
+)
+
+// ValidSKU accepts up to 64 letters, digits, dots, dashes and underscores.
+func ValidSKU(sku string) bool {
+	if sku == "" || len(sku) > 64 {
+		return false
+	}
+
+	for _, c := range sku {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// MergeVariants prepares requested variant definitions to replace the
+// product's: kept variants carry over their stock, and new ones start empty.
+// It fails with ErrVariantInUse if a variant left out still has stock, or
+// ErrProductHasStock if variants are added to a product holding stock itself.
+func (p Product) MergeVariants(requested map[string]ProductVariant) (map[string]ProductVariant, error) {
+	merged := make(map[string]ProductVariant, len(requested))
+	for sku, variant := range requested {
+		current := p.Variants[sku]
+		variant.Stock, variant.Reserved = current.Stock, current.Reserved
+		merged[sku] = variant
+	}
+
+	for sku, current := range p.Variants {
+		if _, ok := merged[sku]; !ok && (current.Stock != 0 || current.Reserved != 0) {
+			return nil, fmt.Errorf("%w: %s", ErrVariantInUse, sku)
+		}
+	}
+
+	if len(p.Variants) == 0 && len(merged) > 0 && (p.Stock != 0 || p.Reserved != 0) {
+		return nil, ErrProductHasStock
+	}
+	return merged, nil
+}
+
+// CheckVariant validates the SKU a sale, reservation or adjustment names: a
+// product with variants needs one of its SKUs, and one without takes none.
+func (p Product) CheckVariant(sku string) error {
+	if len(p.Variants) == 0 {
+		if sku != "" {
+			return ErrVariantNotFound
+		}
+		return nil
+	}
+
+	if sku == "" {
+		return ErrVariantRequired
+	}
+	if _, ok := p.Variants[sku]; !ok {
+		return ErrVariantNotFound
+	}
+	return nil
+}
+
+// UnitPrice is the price of sku, falling back to the product's price.
+func (p Product) UnitPrice(sku string) int64 {
+	if variant, ok := p.Variants[sku]; ok && variant.Price > 0 {
+		return variant.Price
+	}
+	return p.Price
+}
+
+// AvailableFor is the quantity of sku that can still be bought or reserved,
+// or of the product itself when sku is empty.
+func (p Product) AvailableFor(sku string) int {
+	if sku == "" {
+		return p.AvailableStock()
+	}
+	return p.Variants[sku].AvailableStock()
+}
+
+// stockLevels returns the stock and reserved counts a sale of sku draws on.
+func (p Product) stockLevels(sku string) (stock, reserved int) {
+	if sku == "" {
+		return p.Stock, p.Reserved
+	}
+	variant := p.Variants[sku]
+	return variant.Stock, variant.Reserved
+}
+
+// stockPaths returns the attribute paths of the stock and reserved counts a
+// sale of sku draws on, naming the SKU through the #sku placeholder.
+func stockPaths(sku string, names map[string]string) (stock, reserved string) {
+	if sku == "" {
+		return "stock", "reserved"
+	}
+	names["#sku"] = sku
+	return "variants.#sku.stock", "variants.#sku.reserved"
+}
+
+// stockChange builds an update expression adding the deltas to the stock and
+// reserved counts of sku. ADD cannot reach into the variants map, so variant
+// counts are SET while the product totals are kept in step with ADD.
+func stockChange(sku string, stockDelta, reservedDelta int, values map[string]types.AttributeValue, names map[string]string) string {
+	var set, add []string
+	for _, change := range []struct {
+		attr  string
+		delta int
+	}{{"stock", stockDelta}, {"reserved", reservedDelta}} {
+		if change.delta == 0 {
+			continue
+		}
+
+		placeholder := ":" + change.attr + "Delta"
+		values[placeholder] = &types.AttributeValueMemberN{Value: strconv.Itoa(change.delta)}
+		add = append(add, change.attr+" "+placeholder)
+
+		if sku != "" {
+			names["#sku"] = sku
+			path := "variants.#sku." + change.attr
+			set = append(set, path+" = "+path+" + "+placeholder)
+		}
+	}
+
+	expr := "ADD " + strings.Join(add, ", ")
+	if len(set) > 0 {
+		expr = "SET " + strings.Join(set, ", ") + " " + expr
+	}
+	return expr
+}
+
+// stockExists is the condition that the product, and its variant sku if set,
+// still exist.
+func stockExists(sku string) string {
+	if sku == "" {
+		return "attribute_exists(id)"
+	}
+	return "attribute_exists(id) AND attribute_exists(variants.#sku)"
+}
+
+// attributeNames returns names, or nil when it is empty since DynamoDB
+// rejects an empty name map.
+func attributeNames(names map[string]string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+// variantsUpdate builds the clauses and conditions that move a product's
+// variant definitions from current to updated without touching the stock of
+// variants that remain. New variants start with no stock, and a variant may
+// only be removed once it has none on hand or reserved. A product without
+// variants must have no stock to gain them.
+func variantsUpdate(current, updated map[string]ProductVariant, values map[string]types.AttributeValue, names map[string]string) (set, remove, conditions []string, err error) {
+	if len(current) == 0 {
+		if len(updated) == 0 {
+			return nil, nil, nil, nil
+		}
+
+		variants := make(map[string]ProductVariant, len(updated))
+		for sku, variant := range updated {
+			variant.Stock, variant.Reserved = 0, 0
+			variants[sku] = variant
+		}
+
+		av, err := attributevalue.Marshal(variants)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("marshal variants: %w", err)
+		}
+		values[":variants"] = av
+		values[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+
+		return []string{"variants = :variants"}, nil,
+			[]string{"(attribute_not_exists(stock) OR stock = :zero)", "(attribute_not_exists(reserved) OR reserved = :zero)"}, nil
+	}
+
+	i := 0
+	next := func() (name, value string) {
+		i++
+		return "#v" + strconv.Itoa(i), ":v" + strconv.Itoa(i)
+	}
+
+	for sku, variant := range updated {
+		name, value := next()
+		names[name] = sku
+
+		if _, ok := current[sku]; ok {
+			attributes, err := attributevalue.Marshal(variant.Attributes)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("marshal variant attributes: %w", err)
+			}
+			values[value+"a"] = attributes
+			values[value+"p"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(variant.Price, 10)}
+			set = append(set,
+				"variants."+name+".attributes = "+value+"a",
+				"variants."+name+".price = "+value+"p")
+			continue
+		}
+
+		variant.Stock, variant.Reserved = 0, 0
+		av, err := attributevalue.Marshal(variant)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("marshal variant: %w", err)
+		}
+		values[value] = av
+		set = append(set, "variants."+name+" = "+value)
+		conditions = append(conditions, "attribute_not_exists(variants."+name+")")
+	}
+
+	for sku := range current {
+		if _, ok := updated[sku]; ok {
+			continue
+		}
+
+		name, _ := next()
+		names[name] = sku
+		values[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+		remove = append(remove, "variants."+name)
+		conditions = append(conditions,
+			"variants."+name+".stock = :zero",
+			"variants."+name+".reserved = :zero")
+	}
+
+	return set, remove, conditions, nil
+}
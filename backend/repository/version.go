@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrVersionConflict is returned by a conditional update when the item was
+// changed since the caller read the version it expected.
+var ErrVersionConflict = errors.New("version conflict")
+
+// versionUpdate builds the condition that an item is still at expected and
+// the SET clause that moves it to the next version. Items written before
+// versioning count as version 0.
+func versionUpdate(expected int64, values map[string]types.AttributeValue) (condition, set string) {
+	values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expected, 10)}
+	values[":nextVersion"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expected+1, 10)}
+
+	condition = "attribute_exists(id) AND version = :version"
+	if expected == 0 {
+		condition = "attribute_exists(id) AND (attribute_not_exists(version) OR version = :version)"
+	}
+	return condition, "version = :nextVersion"
+}
+
+// versionFailure reports why a versioned update's condition failed: notFound
+// when the item no longer exists, ErrVersionConflict when it was changed. The
+// update must ask for ALL_OLD values on condition check failure.
+func versionFailure(ccf *types.ConditionalCheckFailedException, notFound error) error {
+	if len(ccf.Item) == 0 {
+		return notFound
+	}
+	return ErrVersionConflict
+}
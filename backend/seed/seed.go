@@ -0,0 +1,9 @@
+// Package seed bundles the data the server loads into an empty database.
+package seed
+
+import _ "embed"
+
+// DemoProducts is the demo catalogue as a product import file.
+//
+//go:embed demo_products.json
+var DemoProducts []byte
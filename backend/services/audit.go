@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"banking-ecommerce-api/repository"
+)
+
+const (
+	auditGenesisHash   = "0000000000000000000000000000000000000000000000000000000000000000"
+	auditAppendRetries = 10
+)
+
+// AuditRecord collects what is known about the request being audited. The
+// audit middleware puts one in the request context with the request's
+// details and handlers fill in the rest. Recorded is set once the outcome has
+// been appended, so it is appended only once.
+type AuditRecord struct {
+	ActorID    string
+	ActorRole  string
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+	Method     string
+	Path       string
+	IP         string
+	RequestID  string
+	Recorded   bool
+}
+
+type auditRecordKey struct{}
+
+// WithAuditRecord returns a context carrying record for handlers to fill in.
+func WithAuditRecord(ctx context.Context, record *AuditRecord) context.Context {
+	return context.WithValue(ctx, auditRecordKey{}, record)
+}
+
+func auditRecord(ctx context.Context) *AuditRecord {
+	record, _ := ctx.Value(auditRecordKey{}).(*AuditRecord)
+	if record == nil {
+		return &AuditRecord{}
+	}
+	return record
+}
+
+// AuditActor records who is making the request.
+func AuditActor(ctx context.Context, userID, role string) {
+	record := auditRecord(ctx)
+	record.ActorID = userID
+	record.ActorRole = role
+}
+
+// AuditAction names the operation and the entity it acts on.
+func AuditAction(ctx context.Context, action, targetType, targetID string) {
+	record := auditRecord(ctx)
+	record.Action = action
+	record.TargetType = targetType
+	record.TargetID = targetID
+}
+
+// AuditSnapshot records the entity before and after the change; either may be
+// nil when the entity is being created or deleted.
+func AuditSnapshot(ctx context.Context, before, after interface{}) {
+	record := auditRecord(ctx)
+	record.Before = before
+	record.After = after
+}
+
+// RecordAuditIntent appends the intent to handle a request before any of its
+// changes are made, so a change whose outcome never reaches the chain still
+// leaves a trace there. A request whose intent cannot be recorded must not be
+// handled.
+func RecordAuditIntent(ctx context.Context, record *AuditRecord) error {
+	event, err := newAuditEvent(&AuditRecord{
+		Action:    record.Method + " " + record.Path,
+		Method:    record.Method,
+		Path:      record.Path,
+		IP:        record.IP,
+		RequestID: record.RequestID,
+	}, 0)
+	if err != nil {
+		return err
+	}
+	return appendAudit(ctx, event, repository.AppendAuditEvent)
+}
+
+// RecordAudit appends the outcome of a request to the audit chain, unless the
+// handler already recorded it with its change through AuditedWrite.
+func RecordAudit(ctx context.Context, record *AuditRecord, status int) error {
+	if record.Recorded {
+		return nil
+	}
+
+	event, err := newAuditEvent(record, status)
+	if err != nil {
+		return err
+	}
+	if err := appendAudit(ctx, event, repository.AppendAuditEvent); err != nil {
+		return err
+	}
+	record.Recorded = true
+	return nil
+}
+
+// AuditedWrite makes a change together with its audit event. write is given
+// the request's event, linked to the end of the chain, and must append it in
+// the same transaction as the change; it is called again with a re-linked
+// event if it fails with repository.ErrAuditHeadMoved. status is the one the
+// request answers with once the change is made.
+func AuditedWrite(ctx context.Context, status int, write func(context.Context, repository.AuditEvent) error) error {
+	record := auditRecord(ctx)
+	event, err := newAuditEvent(record, status)
+	if err != nil {
+		return err
+	}
+	if err := appendAudit(ctx, event, write); err != nil {
+		return err
+	}
+	record.Recorded = true
+	return nil
+}
+
+func newAuditEvent(record *AuditRecord, status int) (repository.AuditEvent, error) {
+	event := repository.AuditEvent{
+		Chain:      repository.AuditChain,
+		ActorID:    record.ActorID,
+		ActorRole:  record.ActorRole,
+		Action:     record.Action,
+		TargetType: record.TargetType,
+		TargetID:   record.TargetID,
+		Method:     record.Method,
+		Path:       record.Path,
+		Status:     status,
+		IP:         record.IP,
+		RequestID:  record.RequestID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if event.Action == "" {
+		event.Action = record.Method + " " + record.Path
+	}
+
+	var err error
+	if event.Before, err = auditJSON(record.Before); err != nil {
+		return repository.AuditEvent{}, err
+	}
+	if event.After, err = auditJSON(record.After); err != nil {
+		return repository.AuditEvent{}, err
+	}
+	return event, nil
+}
+
+// appendAudit links event to the end of the audit chain and writes it with
+// write, re-linking and retrying after a short, growing pause if another
+// event is appended concurrently.
+func appendAudit(ctx context.Context, event repository.AuditEvent, write func(context.Context, repository.AuditEvent) error) error {
+	for attempt := 0; attempt < auditAppendRetries; attempt++ {
+		if attempt > 0 {
+			pause := time.Duration(attempt) * time.Duration(5+rand.Intn(20)) * time.Millisecond
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+
+		head, err := repository.GetAuditHead(ctx, event.Chain)
+		if err != nil {
+			return err
+		}
+
+		event.Seq = head.Seq + 1
+		event.PrevHash = head.Hash
+		if head.Seq == 0 {
+			event.PrevHash = auditGenesisHash
+		}
+		event.Hash = AuditHash(event)
+
+		err = write(ctx, event)
+		if !errors.Is(err, repository.ErrAuditHeadMoved) {
+			return err
+		}
+	}
+
+	return repository.ErrAuditHeadMoved
+}
+
+func auditJSON(snapshot interface{}) (string, error) {
+	if snapshot == nil {
+		return "", nil
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("marshal audit snapshot: %w", err)
+	}
+	return string(data), nil
+}
+
+// AuditHash returns the hex SHA-256 of an event's contents and PrevHash. The
+// fields are hashed in a fixed order so the hash can be recomputed from the
+// stored event.
+func AuditHash(event repository.AuditEvent) string {
+	fields := []string{
+		event.Chain,
+		fmt.Sprint(event.Seq),
+		event.ActorID,
+		event.ActorRole,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.Before,
+		event.After,
+		event.Method,
+		event.Path,
+		fmt.Sprint(event.Status),
+		event.IP,
+		event.RequestID,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		event.PrevHash,
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		// Length-prefix each field so no two events hash the same input.
+		fmt.Fprintf(h, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditVerification is the result of checking an audit chain. Unresolved
+// lists the request IDs of intents with no recorded outcome: requests still
+// being handled, or ones whose outcome could not be appended.
+type AuditVerification struct {
+	Events     int64    `json:"events"`
+	HeadSeq    int64    `json:"head_seq"`
+	Valid      bool     `json:"valid"`
+	BrokenAt   int64    `json:"broken_at,omitempty"`
+	Problem    string   `json:"problem,omitempty"`
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// VerifyAuditChain walks the chain from the first event, checking that
+// sequence numbers are contiguous, that each event links to the previous
+// hash, that each hash matches the event's contents and that the head points
+// at the last event. It also pairs every intent with its outcome.
+func VerifyAuditChain(ctx context.Context) (AuditVerification, error) {
+	head, err := repository.GetAuditHead(ctx, repository.AuditChain)
+	if err != nil {
+		return AuditVerification{}, err
+	}
+
+	result := AuditVerification{HeadSeq: head.Seq, Valid: true}
+	prevHash := auditGenesisHash
+	errBroken := errors.New("broken")
+	intents := map[string]int64{}
+
+	broken := func(seq int64, problem string) error {
+		result.Valid = false
+		result.BrokenAt = seq
+		result.Problem = problem
+		return errBroken
+	}
+
+	err = repository.WalkAuditChain(ctx, repository.AuditChain, func(event repository.AuditEvent) error {
+		expected := result.Events + 1
+		switch {
+		case event.Seq != expected:
+			return broken(expected, fmt.Sprintf("expected event %d, found %d", expected, event.Seq))
+		case event.PrevHash != prevHash:
+			return broken(event.Seq, "previous hash does not match")
+		case AuditHash(event) != event.Hash:
+			return broken(event.Seq, "hash does not match contents")
+		}
+
+		result.Events++
+		prevHash = event.Hash
+		if event.Status == 0 {
+			intents[event.RequestID] = event.Seq
+		} else {
+			delete(intents, event.RequestID)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBroken) {
+		return AuditVerification{}, err
+	}
+
+	for requestID := range intents {
+		result.Unresolved = append(result.Unresolved, requestID)
+	}
+	sort.Slice(result.Unresolved, func(i, j int) bool {
+		return intents[result.Unresolved[i]] < intents[result.Unresolved[j]]
+	})
+
+	if result.Valid {
+		switch {
+		case head.Seq != result.Events:
+			broken(result.Events+1, fmt.Sprintf("head is at %d but chain has %d events", head.Seq, result.Events))
+		case head.Seq > 0 && head.Hash != prevHash:
+			broken(head.Seq, "head hash does not match last event")
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var (
+	ErrBlobNotFound   = errors.New("blob not found")
+	ErrInvalidBlobKey = errors.New("invalid blob key")
+)
+
+// blobKeyPattern limits keys to slash-separated segments of letters, digits,
+// dots, dashes and underscores that do not start with a dot.
+var blobKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+// ValidBlobKey reports whether key is one a BlobStore accepts.
+func ValidBlobKey(key string) bool {
+	return len(key) <= 512 && blobKeyPattern.MatchString(key)
+}
+
+// BlobStore keeps uploaded files by key. Get fails with ErrBlobNotFound for a
+// key that was never put or has been deleted, and deleting such a key is not
+// an error.
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalBlobStore keeps blobs as files under Dir.
+type LocalBlobStore struct {
+	Dir string
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if !ValidBlobKey(key) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidBlobKey, key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file first and renames it into place,
+// so readers never see a partial file.
+func (s *LocalBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create blob directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create blob: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("write blob: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write blob: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("store blob: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open blob: %w", err)
+	}
+	return file, nil
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete blob: %w", err)
+	}
+	return nil
+}
+
+// S3BlobStore keeps blobs in Bucket of an S3-compatible service, such as
+// MinIO.
+type S3BlobStore struct {
+	Bucket string
+	Client *s3.Client
+}
+
+// newS3BlobStore connects to bucket on the S3-compatible service at endpoint,
+// addressed path-style. Checksums are only sent where the API requires them,
+// as not every S3-compatible service accepts the SDK's defaults.
+func newS3BlobStore(endpoint, bucket, region, accessKey, secretKey string) *S3BlobStore {
+	return &S3BlobStore{
+		Bucket: bucket,
+		Client: s3.New(s3.Options{
+			BaseEndpoint:               aws.String(endpoint),
+			UsePathStyle:               true,
+			Region:                     region,
+			Credentials:                credentials.NewStaticCredentialsProvider(accessKey, secretKey, ""),
+			HTTPClient:                 &http.Client{Timeout: 30 * time.Second},
+			RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+			ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+		}),
+	}
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if !ValidBlobKey(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidBlobKey, key)
+	}
+
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("put blob: %w", err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !ValidBlobKey(key) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidBlobKey, key)
+	}
+
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("get blob: %w", err)
+	}
+	return out.Body, nil
+}
+
+// Delete removes the blob. S3 treats deleting a missing key as success.
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	if !ValidBlobKey(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidBlobKey, key)
+	}
+
+	_, err := s.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("delete blob: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+)
+
+// bulkUpdateSize caps the items changed by one status update, keeping its
+// expressions well inside DynamoDB's size limits.
+const bulkUpdateSize = 25
+
+// bulkWake lets a new submission start the processor without waiting for
+// its next tick.
+var bulkWake = make(chan struct{}, 1)
+
+// StartBulkTransferProcessor executes pending bulk transfers in the background
+// until the context is cancelled, every interval and whenever
+// NotifyBulkTransfer is called.
+func StartBulkTransferProcessor(ctx context.Context, cfg config.BulkTransferConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := RunPendingBulkTransfers(ctx); err != nil {
+				log.Printf("bulk transfers: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-bulkWake:
+			}
+		}
+	}()
+}
+
+// NotifyBulkTransfer wakes the processor after a bulk transfer is submitted.
+func NotifyBulkTransfer() {
+	select {
+	case bulkWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunPendingBulkTransfers processes every bulk transfer that still has
+// pending items.
+func RunPendingBulkTransfers(ctx context.Context) error {
+	ids, err := repository.GetPendingBulkTransferIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		// Closed items mean another processor got to them first.
+		if err := ProcessBulkTransfer(ctx, id); err != nil && !errors.Is(err, repository.ErrBulkItemsClosed) {
+			log.Printf("bulk transfers: %s: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// ProcessBulkTransfer executes a bulk transfer's pending items. Each item is
+// risk-checked like a single transfer; allowed ones are executed together in
+// as few transactions as DynamoDB's limit allows, falling back to one at a
+// time when a shared transaction fails. An item only ever leaves pending in
+// the same write that settles it, so running this again after a crash, or
+// alongside another processor, cannot execute an item twice.
+func ProcessBulkTransfer(ctx context.Context, id string) error {
+	bulk, err := repository.GetBulkTransferByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if bulk.Status != repository.BulkStatusPending {
+		return nil
+	}
+
+	var pending []int
+	for i, item := range bulk.Items {
+		if item.Status == repository.BulkItemPending {
+			pending = append(pending, i)
+		}
+	}
+
+	from, err := repository.GetAccountByID(ctx, bulk.FromAccountID)
+	if errors.Is(err, repository.ErrAccountNotFound) {
+		outcomes := map[int]repository.BulkTransferItem{}
+		for _, i := range pending {
+			outcomes[i] = bulkItemFailed(bulk.Items[i], "Sender account doesn't exist")
+		}
+		return finishBulkTransfer(ctx, bulk, outcomes)
+	}
+	if err != nil {
+		return err
+	}
+
+	recipients := map[string]repository.Account{}
+	outcomes := map[int]repository.BulkTransferItem{}
+	var allowed []int
+	inReview := 0
+	for _, i := range pending {
+		item := bulk.Items[i]
+
+		to, ok := recipients[item.ToAccountID]
+		if !ok {
+			to, err = repository.GetAccountByID(ctx, item.ToAccountID)
+			if errors.Is(err, repository.ErrAccountNotFound) {
+				outcomes[i] = bulkItemFailed(item, "Receiver account doesn't exist")
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			recipients[to.ID] = to
+		}
+
+		outcome, queued, err := reviewBulkItem(ctx, bulk, i, from, len(allowed)+inReview)
+		if err != nil {
+			return err
+		}
+		if queued {
+			outcomes[i] = outcome
+			if outcome.Status == repository.BulkItemPendingReview {
+				inReview++
+			}
+			continue
+		}
+		allowed = append(allowed, i)
+	}
+
+	if err := updateBulkItems(ctx, bulk.ID, outcomes); err != nil {
+		return err
+	}
+
+	outcomes = map[int]repository.BulkTransferItem{}
+	for len(allowed) > 0 {
+		n := 1
+		for n < len(allowed) && repository.BulkChunkSize(bulk, allowed[:n+1]) <= repository.MaxTransactItems {
+			n++
+		}
+
+		if err := executeBulkChunk(ctx, bulk, allowed[:n], recipients, outcomes); err != nil {
+			return err
+		}
+		allowed = allowed[n:]
+	}
+
+	return finishBulkTransfer(ctx, bulk, outcomes)
+}
+
+// reviewBulkItem runs the risk checks on item i, counting the accepted items
+// before it towards velocity. A declined item, or one the risk engine wants
+// reviewed, is returned with its new state and queued set; review items get
+// an ID derived from the item so a rerun finds the one it already queued
+// instead of holding the amount again, and point back at the item so
+// deciding the review settles it.
+func reviewBulkItem(ctx context.Context, bulk repository.BulkTransfer, i int, from repository.Account, accepted int) (repository.BulkTransferItem, bool, error) {
+	item := bulk.Items[i]
+	reviewID := "review_" + bulk.ID + "_" + strconv.Itoa(i)
+
+	_, err := repository.GetReviewItemByID(ctx, reviewID)
+	if err == nil {
+		return bulkItemInReview(item, reviewID), true, nil
+	}
+	if !errors.Is(err, repository.ErrReviewNotFound) {
+		return item, false, err
+	}
+
+	assessment, err := AssessRisk(ctx, RiskOperation{
+		Kind:        RiskKindTransfer,
+		UserID:      bulk.UserID,
+		AccountID:   bulk.FromAccountID,
+		ToAccountID: item.ToAccountID,
+		Amount:      item.Amount,
+		Pending:     accepted,
+	})
+	if err != nil {
+		return item, false, err
+	}
+
+	switch assessment.Decision {
+	case RiskDeny:
+		return bulkItemFailed(item, "Payment declined by risk checks"), true, nil
+	case RiskReview:
+	default:
+		return item, false, nil
+	}
+
+	// Earlier items changed the account's holds, so it is reloaded for the
+	// hold's condition.
+	from, err = repository.GetAccountByID(ctx, from.ID)
+	if err != nil {
+		return item, false, err
+	}
+
+	_, err = QueueForReview(ctx, repository.ReviewItem{
+		ID:             reviewID,
+		Kind:           repository.ReviewKindTransfer,
+		UserID:         bulk.UserID,
+		AccountID:      bulk.FromAccountID,
+		ToAccountID:    item.ToAccountID,
+		BulkTransferID: bulk.ID,
+		BulkItemIndex:  i,
+		Amount:         item.Amount,
+	}, from, assessment)
+	switch {
+	case err == nil, errors.Is(err, repository.ErrReviewExists):
+		return bulkItemInReview(item, reviewID), true, nil
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		return bulkItemFailed(item, "Insufficient balance"), true, nil
+	default:
+		return item, false, err
+	}
+}
+
+// executeBulkChunk executes the given items in one transaction, retrying them
+// one by one if that fails. Items that cannot be executed are added to
+// outcomes as failed.
+func executeBulkChunk(ctx context.Context, bulk repository.BulkTransfer, indexes []int, recipients map[string]repository.Account, outcomes map[int]repository.BulkTransferItem) error {
+	var total int64
+	for _, i := range indexes {
+		total += bulk.Items[i].Amount
+	}
+
+	// The debit's condition pins the account's holds and overdraft limit, so
+	// a concurrent change to either is retried with the account reloaded.
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		var from repository.Account
+		if from, err = repository.GetAccountByID(ctx, bulk.FromAccountID); err != nil {
+			return err
+		}
+		if from.AvailableBalance() < total {
+			err = repository.ErrInsufficientBalance
+			break
+		}
+
+		err = repository.ExecuteBulkTransferChunk(ctx, bulk, from, recipients, indexes, time.Now().UTC())
+		if !errors.Is(err, repository.ErrInsufficientBalance) {
+			break
+		}
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repository.ErrBulkItemsClosed):
+		return err
+	case len(indexes) > 1 && (errors.Is(err, repository.ErrInsufficientBalance) || errors.Is(err, repository.ErrAccountNotFound)):
+		for _, i := range indexes {
+			if err := executeBulkChunk(ctx, bulk, []int{i}, recipients, outcomes); err != nil {
+				return err
+			}
+		}
+		return nil
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		outcomes[indexes[0]] = bulkItemFailed(bulk.Items[indexes[0]], "Insufficient balance")
+		return nil
+	case errors.Is(err, repository.ErrAccountNotFound):
+		outcomes[indexes[0]] = bulkItemFailed(bulk.Items[indexes[0]], "Receiver account doesn't exist")
+		return nil
+	default:
+		return err
+	}
+}
+
+// finishBulkTransfer records the remaining outcomes and marks the bulk
+// transfer completed.
+func finishBulkTransfer(ctx context.Context, bulk repository.BulkTransfer, outcomes map[int]repository.BulkTransferItem) error {
+	if err := updateBulkItems(ctx, bulk.ID, outcomes); err != nil {
+		return err
+	}
+	return repository.CompleteBulkTransfer(ctx, bulk.ID, time.Now().UTC())
+}
+
+// updateBulkItems saves item outcomes a few at a time.
+func updateBulkItems(ctx context.Context, bulkID string, outcomes map[int]repository.BulkTransferItem) error {
+	batch := map[int]repository.BulkTransferItem{}
+	for i, item := range outcomes {
+		batch[i] = item
+		if len(batch) < bulkUpdateSize {
+			continue
+		}
+		if err := repository.UpdateBulkTransferItems(ctx, bulkID, batch, time.Now().UTC()); err != nil {
+			return err
+		}
+		batch = map[int]repository.BulkTransferItem{}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return repository.UpdateBulkTransferItems(ctx, bulkID, batch, time.Now().UTC())
+}
+
+func bulkItemFailed(item repository.BulkTransferItem, reason string) repository.BulkTransferItem {
+	item.Status = repository.BulkItemFailed
+	item.Error = reason
+	return item
+}
+
+func bulkItemInReview(item repository.BulkTransferItem, reviewID string) repository.BulkTransferItem {
+	item.Status = repository.BulkItemPendingReview
+	item.ReviewID = reviewID
+	return item
+}
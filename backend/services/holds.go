@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+)
+
+// StartHoldExpiry releases expired authorization holds in the background until
+// the context is cancelled.
+func StartHoldExpiry(ctx context.Context, cfg config.HoldConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.ExpiryInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := ExpireHolds(ctx, time.Now()); err != nil {
+				log.Printf("holds: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ExpireHolds releases every active hold whose expiry has passed. Holds that
+// were captured or released in the meantime are skipped.
+func ExpireHolds(ctx context.Context, now time.Time) error {
+	holds, err := repository.GetExpiredHolds(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, hold := range holds {
+		err := repository.ReleaseHold(ctx, hold, repository.HoldStatusExpired, now)
+		if err != nil && !errors.Is(err, repository.ErrHoldClosed) {
+			log.Printf("holds: expiring %s: %v", hold.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+)
+
+const (
+	dateLayout  = "2006-01-02"
+	monthLayout = "2006-01"
+
+	microsPerMinorUnit = 1_000_000
+
+	// interestConflictRetries bounds how often an account whose accrual or
+	// posting lost to a concurrent change is tried in one run.
+	interestConflictRetries = 3
+)
+
+// StartInterestAccrual runs the interest and overdraft accrual job in the
+// background until the context is cancelled. Each run catches up to the end of
+// yesterday (UTC).
+func StartInterestAccrual(ctx context.Context, cfg config.InterestConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := RunInterestAccrual(ctx, time.Now(), cfg); err != nil {
+				log.Printf("interest: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunInterestAccrual accrues interest for every completed day that has not yet
+// been accrued, on accounts whose type has a positive APR and on overdrawn or
+// overdraft-enabled accounts, and posts monthly once a month is fully accrued.
+func RunInterestAccrual(ctx context.Context, now time.Time, cfg config.InterestConfig) error {
+	yesterday := startOfDay(now).AddDate(0, 0, -1)
+
+	var accountTypes []string
+	for accountType, apr := range cfg.APRBasisPoints {
+		if apr > 0 {
+			accountTypes = append(accountTypes, accountType)
+		}
+	}
+
+	accounts, err := repository.GetAccountsForAccrual(ctx, accountTypes)
+	if err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		err := accrueAccount(ctx, account, cfg, yesterday)
+		// A conflict wrote nothing, so start over from the account as it is now.
+		for attempt := 1; errors.Is(err, repository.ErrInterestConflict) && attempt < interestConflictRetries; attempt++ {
+			var fresh repository.Account
+			if fresh, err = repository.GetAccountByID(ctx, account.ID); err == nil {
+				err = accrueAccount(ctx, fresh, cfg, yesterday)
+			}
+		}
+		if err != nil {
+			log.Printf("interest: account %s: %v", account.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// accrueAccount accrues each outstanding day through the given date on that
+// day's closing balance. Closing balances are worked back from the current
+// balance through the transactions recorded since, as statements are, so
+// money moved after the day ended does not count towards it.
+func accrueAccount(ctx context.Context, account repository.Account, cfg config.InterestConfig, through time.Time) error {
+	day := startOfDay(account.CreatedAt)
+	if account.LastAccrualDate != "" {
+		last, err := time.Parse(dateLayout, account.LastAccrualDate)
+		if err != nil {
+			return err
+		}
+		day = last.AddDate(0, 0, 1)
+	}
+	if day.After(through) {
+		return postInterestIfDue(ctx, &account, through)
+	}
+
+	transactions, err := repository.GetTransactionsByAccountID(ctx, account.ID)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(transactions, func(a, b repository.Transaction) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	// later is the net of the transactions made after the day being accrued,
+	// and next is the first of them.
+	current := account.Balance
+	var later int64
+	for _, txn := range transactions {
+		later += txn.SignedAmount()
+	}
+	next := 0
+
+	for ; !day.After(through); day = day.AddDate(0, 0, 1) {
+		if err := postInterestIfDue(ctx, &account, day.AddDate(0, 0, -1)); err != nil {
+			return err
+		}
+
+		end := day.AddDate(0, 0, 1)
+		for ; next < len(transactions) && transactions[next].CreatedAt.Before(end); next++ {
+			later -= transactions[next].SignedAmount()
+		}
+		closing := current - later
+
+		accrual := repository.InterestAccrual{
+			AccountID: account.ID,
+			Date:      day.Format(dateLayout),
+			Balance:   closing,
+			CreatedAt: time.Now(),
+		}
+		if closing < 0 {
+			accrual.APRBasisPoints = cfg.OverdraftAPRBasisPoints
+			accrual.AmountMicros = -DailyInterestMicros(-closing, cfg.OverdraftAPRBasisPoints)
+			accrual.Fee = cfg.OverdraftDailyFee
+		} else {
+			accrual.APRBasisPoints = cfg.APRBasisPoints[account.Type()]
+			accrual.AmountMicros = DailyInterestMicros(closing, accrual.APRBasisPoints)
+		}
+
+		err := repository.AccrueInterest(ctx, accrual)
+		if errors.Is(err, repository.ErrInterestAlreadyAccrued) {
+			// Another run got here first; pick up from its state next time.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		account.AccruedInterestMicros += accrual.AmountMicros
+		account.AccruedFees += accrual.Fee
+		account.LastAccrualDate = accrual.Date
+	}
+
+	return postInterestIfDue(ctx, &account, through)
+}
+
+// postInterestIfDue posts the month ending on accruedThrough if that day is the
+// last of its month and the month has not been posted yet.
+func postInterestIfDue(ctx context.Context, account *repository.Account, accruedThrough time.Time) error {
+	if accruedThrough.AddDate(0, 0, 1).Day() != 1 || account.LastAccrualDate < accruedThrough.Format(dateLayout) {
+		return nil
+	}
+
+	month := accruedThrough.Format(monthLayout)
+	if account.LastInterestPosting >= month {
+		return nil
+	}
+
+	interest := RoundHalfEven(account.AccruedInterestMicros, microsPerMinorUnit)
+	err := repository.PostInterest(ctx, *account, month, interest, account.AccruedFees)
+	if err != nil && !errors.Is(err, repository.ErrInterestAlreadyPosted) {
+		return err
+	}
+	if err == nil {
+		account.Balance += interest - account.AccruedFees
+		account.AccruedInterestMicros -= interest * microsPerMinorUnit
+		account.AccruedFees = 0
+	}
+	account.LastInterestPosting = month
+
+	return nil
+}
+
+// OverdraftAccrualStart returns the accrual date to record when an overdraft
+// is granted, so that an account which was not accruing does not get charged
+// for the days before the grant. It returns "" when no change is needed.
+func OverdraftAccrualStart(account repository.Account, cfg config.InterestConfig, now time.Time) string {
+	if cfg.APRBasisPoints[account.Type()] > 0 || account.Balance < 0 {
+		return ""
+	}
+
+	yesterday := startOfDay(now).AddDate(0, 0, -1).Format(dateLayout)
+	if account.LastAccrualDate >= yesterday {
+		return ""
+	}
+	return yesterday
+}
+
+// DailyInterestMicros returns one day of interest on balance at the given APR,
+// in millionths of a minor unit, using an actual/365 day count. Negative
+// balances earn nothing.
+func DailyInterestMicros(balance, aprBasisPoints int64) int64 {
+	if balance <= 0 {
+		return 0
+	}
+	// balance * apr/10000 / 365 * 1e6 simplifies to balance * apr * 100 / 365.
+	return RoundHalfEven(balance*aprBasisPoints*100, 365)
+}
+
+// RoundHalfEven divides num by den, rounding ties to the nearest even result.
+func RoundHalfEven(num, den int64) int64 {
+	quotient, remainder := num/den, num%den
+	if remainder < 0 {
+		remainder = -remainder
+	}
+
+	switch twice := 2 * remainder; {
+	case twice > den, twice == den && quotient%2 != 0:
+		if num < 0 {
+			return quotient - 1
+		}
+		return quotient + 1
+	}
+	return quotient
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,64 @@
+package services
+
+import "testing"
+
+func TestRoundHalfEven(t *testing.T) {
+	tests := []struct {
+		num, den, want int64
+	}{
+		{num: 10, den: 5, want: 2},
+		{num: 14, den: 10, want: 1},
+		{num: 16, den: 10, want: 2},
+		// Ties go to the even neighbour, where half-up would always go up.
+		{num: 5, den: 10, want: 0},
+		{num: 15, den: 10, want: 2},
+		{num: 25, den: 10, want: 2},
+		{num: 35, den: 10, want: 4},
+		{num: 2_500_000, den: 1_000_000, want: 2},
+		{num: 3_500_000, den: 1_000_000, want: 4},
+		// Just either side of a tie is not a tie.
+		{num: 2_499_999, den: 1_000_000, want: 2},
+		{num: 2_500_001, den: 1_000_000, want: 3},
+		// Negative values round symmetrically.
+		{num: -14, den: 10, want: -1},
+		{num: -16, den: 10, want: -2},
+		{num: -15, den: 10, want: -2},
+		{num: -25, den: 10, want: -2},
+		{num: -2_500_001, den: 1_000_000, want: -3},
+		{num: 0, den: 365, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := RoundHalfEven(tt.num, tt.den); got != tt.want {
+			t.Errorf("RoundHalfEven(%d, %d) = %d, want %d", tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestDailyInterestMicros(t *testing.T) {
+	tests := []struct {
+		name         string
+		balance, apr int64
+		want         int64
+	}{
+		// 100.00 at 3.65% earns exactly 0.01 a day.
+		{name: "exact", balance: 10000, apr: 365, want: 1_000_000},
+		// 1000.00 at 5%: 100000*500*100/365 = 13698630.136...
+		{name: "rounds down", balance: 100000, apr: 500, want: 13_698_630},
+		// 0.01 at 0.01%: 1*1*100/365 = 0.27...
+		{name: "rounds to zero", balance: 1, apr: 1, want: 0},
+		// 0.02 at 0.01%: 2*1*100/365 = 0.547...
+		{name: "rounds up", balance: 2, apr: 1, want: 1},
+		// The day count is odd, so there are never ties to break.
+		{name: "whole micros", balance: 73, apr: 1, want: 20},
+		{name: "zero balance", balance: 0, apr: 500, want: 0},
+		{name: "negative balance", balance: -10000, apr: 500, want: 0},
+		{name: "zero rate", balance: 10000, apr: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := DailyInterestMicros(tt.balance, tt.apr); got != tt.want {
+			t.Errorf("%s: DailyInterestMicros(%d, %d) = %d, want %d", tt.name, tt.balance, tt.apr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/utils"
+)
+
+// maxImagePixels bounds the decoded size of an uploaded image, which a small
+// compressed file could otherwise blow up to.
+const maxImagePixels = 40_000_000
+
+var (
+	ErrUnknownMediaStore    = errors.New("unknown media store")
+	ErrMediaNotConfigured   = errors.New("media store not configured")
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+	ErrImageTooLarge        = errors.New("image too large")
+	ErrInvalidImage         = errors.New("invalid image")
+)
+
+// imageExtensions are the accepted upload types and the extension their
+// blobs are stored with.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+var (
+	mediaStore    BlobStore
+	mediaMaxBytes int
+	thumbnailSize int
+)
+
+// ConfigureMediaStore selects the blob store that uploaded media is kept in.
+func ConfigureMediaStore(cfg config.MediaConfig) error {
+	switch cfg.Store {
+	case "local":
+		mediaStore = &LocalBlobStore{Dir: cfg.LocalDir}
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return errors.New("s3 media store needs MEDIA_S3_ENDPOINT and MEDIA_S3_BUCKET")
+		}
+		mediaStore = newS3BlobStore(cfg.S3Endpoint, cfg.S3Bucket, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownMediaStore, cfg.Store)
+	}
+
+	mediaMaxBytes = cfg.MaxBytes
+	thumbnailSize = cfg.ThumbnailSize
+	return nil
+}
+
+// MediaMaxBytes is the largest upload accepted.
+func MediaMaxBytes() int {
+	return mediaMaxBytes
+}
+
+// OpenMedia reads a stored blob.
+func OpenMedia(ctx context.Context, key string) (io.ReadCloser, error) {
+	if mediaStore == nil {
+		return nil, ErrMediaNotConfigured
+	}
+	return mediaStore.Get(ctx, key)
+}
+
+// AddProductImage validates an uploaded image, stores it with a thumbnail
+// and adds it to the product. Only JPEG and PNG are accepted, told apart by
+// their content rather than the name they were uploaded with.
+func AddProductImage(ctx context.Context, productID string, data []byte) (repository.ProductImage, error) {
+	if mediaStore == nil {
+		return repository.ProductImage{}, ErrMediaNotConfigured
+	}
+	if len(data) > mediaMaxBytes {
+		return repository.ProductImage{}, ErrImageTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return repository.ProductImage{}, fmt.Errorf("%w: %s", ErrUnsupportedImageType, contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return repository.ProductImage{}, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return repository.ProductImage{}, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return repository.ProductImage{}, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, Thumbnail(img, thumbnailSize), &jpeg.Options{Quality: 85}); err != nil {
+		return repository.ProductImage{}, fmt.Errorf("encode thumbnail: %w", err)
+	}
+
+	id := utils.GenerateID("img")
+	productImage := repository.ProductImage{
+		ID:           id,
+		Key:          "products/" + productID + "/" + id + extension,
+		ThumbnailKey: "products/" + productID + "/" + id + "_thumb.jpg",
+		ContentType:  contentType,
+		Width:        cfg.Width,
+		Height:       cfg.Height,
+		Size:         int64(len(data)),
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if err := mediaStore.Put(ctx, productImage.Key, contentType, data); err != nil {
+		return repository.ProductImage{}, err
+	}
+	if err := mediaStore.Put(ctx, productImage.ThumbnailKey, "image/jpeg", thumbnail.Bytes()); err != nil {
+		deleteMedia(ctx, productImage.Key)
+		return repository.ProductImage{}, err
+	}
+
+	if err := repository.AddProductImage(ctx, productID, productImage); err != nil {
+		deleteMedia(ctx, productImage.Key, productImage.ThumbnailKey)
+		return repository.ProductImage{}, err
+	}
+
+	return productImage, nil
+}
+
+// DeleteProductImage removes an image from the product, re-reading it if
+// another change moved its images meanwhile, then deletes the stored files.
+func DeleteProductImage(ctx context.Context, product repository.Product, imageID string) error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			if product, err = repository.GetProductByID(ctx, product.ID); err != nil {
+				return err
+			}
+		}
+
+		err = repository.RemoveProductImage(ctx, product, imageID)
+		if !errors.Is(err, repository.ErrVersionConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, image := range product.Images {
+		if image.ID == imageID {
+			deleteMedia(ctx, image.Key, image.ThumbnailKey)
+		}
+	}
+	return nil
+}
+
+// deleteMedia removes blobs that are no longer referenced. Failures only
+// leave orphaned files behind, so they are logged rather than returned.
+func deleteMedia(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := mediaStore.Delete(ctx, key); err != nil {
+			log.Printf("media: deleting %s: %v", key, err)
+		}
+	}
+}
+
+// Thumbnail scales img down to fit in a size by size square, averaging the
+// source pixels under each thumbnail pixel, on a white background. Images
+// that already fit keep their size.
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if srcW > size || srcH > size {
+		if srcW >= srcH {
+			dstW, dstH = size, max(1, srcH*size/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*size/srcH), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := bounds.Min.Y+y*srcH/dstH, bounds.Min.Y+max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := bounds.Min.X+x*srcW/dstW, bounds.Min.X+max((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+
+			// Colours are premultiplied, so compositing over white adds
+			// the uncovered share of white.
+			white := n*0xffff - a
+			dst.Set(x, y, color.RGBA64{
+				R: uint16((r + white) / n),
+				G: uint16((g + white) / n),
+				B: uint16((b + white) / n),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-ecommerce-api/utils"
+)
+
+// Batch failure modes.
+const (
+	BatchAllOrNothing = "all_or_nothing"
+	BatchBestEffort   = "best_effort"
+)
+
+// ISO 20022 transaction statuses reported for batch instructions.
+const (
+	PaymentStatusAccepted = "ACSC"
+	PaymentStatusPending  = "PDNG"
+	PaymentStatusRejected = "RJCT"
+	PaymentStatusPartial  = "PART"
+)
+
+// ISO 20022 status reason codes used in pain.002 reports.
+const (
+	ReasonDebtorAccount   = "AC02"
+	ReasonCreditorAccount = "AC03"
+	ReasonNotAllowed      = "AG01"
+	ReasonInvalidAmount   = "AM12"
+	ReasonCurrency        = "AM03"
+	ReasonFunds           = "AM04"
+	ReasonNarrative       = "NARR"
+)
+
+// BatchInstruction is one credit transfer in a payment batch.
+type BatchInstruction struct {
+	PaymentInfoID string
+	InstructionID string
+	EndToEndID    string
+	FromAccountID string
+	ToAccountID   string
+	Amount        int64
+	Currency      string
+}
+
+// TransferBatch is a parsed payment file. MessageName identifies the format it
+// came in, e.g. pain.001.001.09 or CSV.
+type TransferBatch struct {
+	MessageID    string
+	MessageName  string
+	Instructions []BatchInstruction
+}
+
+// BatchResult is the outcome of one instruction. Reason is an ISO 20022
+// status reason code explaining a rejected or pending instruction.
+type BatchResult struct {
+	Status string
+	Reason string
+	Detail string
+}
+
+// ParseMinorUnits reads a decimal amount with at most two fractional digits,
+// e.g. "12.3", as minor units.
+func ParseMinorUnits(value string) (int64, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if whole == "" || len(fraction) > 2 || strings.Trim(whole+fraction, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	var cents int64
+	if fraction != "" {
+		cents, _ = strconv.ParseInt(fraction+strings.Repeat("0", 2-len(fraction)), 10, 64)
+	}
+
+	return units*100 + cents, nil
+}
+
+type painAccount struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+}
+
+func (a painAccount) id() string {
+	if a.Other != "" {
+		return strings.TrimSpace(a.Other)
+	}
+	return strings.TrimSpace(a.IBAN)
+}
+
+type pain001Document struct {
+	XMLName xml.Name
+	GrpHdr  struct {
+		MsgId   string `xml:"MsgId"`
+		NbOfTxs string `xml:"NbOfTxs"`
+		CtrlSum string `xml:"CtrlSum"`
+	} `xml:"CstmrCdtTrfInitn>GrpHdr"`
+	PmtInf []struct {
+		PmtInfId    string      `xml:"PmtInfId"`
+		DbtrAcct    painAccount `xml:"DbtrAcct"`
+		CdtTrfTxInf []struct {
+			InstrId    string `xml:"PmtId>InstrId"`
+			EndToEndId string `xml:"PmtId>EndToEndId"`
+			InstdAmt   struct {
+				Ccy   string `xml:"Ccy,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"Amt>InstdAmt"`
+			CdtrAcct painAccount `xml:"CdtrAcct"`
+		} `xml:"CdtTrfTxInf"`
+	} `xml:"CstmrCdtTrfInitn>PmtInf"`
+}
+
+// ParsePain001 reads an ISO 20022 pain.001 customer credit transfer
+// initiation. Accounts are identified by Othr/Id, or IBAN if that is absent.
+// Execution dates are ignored; instructions are executed on import. The group
+// header's NbOfTxs and CtrlSum are checked when present.
+func ParsePain001(r io.Reader) (TransferBatch, error) {
+	var doc pain001Document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return TransferBatch{}, fmt.Errorf("invalid pain.001 document: %w", err)
+	}
+
+	if doc.XMLName.Local != "Document" || doc.GrpHdr.MsgId == "" {
+		return TransferBatch{}, errors.New("not a pain.001 document")
+	}
+
+	batch := TransferBatch{
+		MessageID:   doc.GrpHdr.MsgId,
+		MessageName: "pain.001",
+	}
+	if _, name, ok := strings.Cut(doc.XMLName.Space, "xsd:"); ok {
+		batch.MessageName = name
+	}
+
+	var controlSum int64
+	for _, info := range doc.PmtInf {
+		for _, tx := range info.CdtTrfTxInf {
+			instruction := BatchInstruction{
+				PaymentInfoID: info.PmtInfId,
+				InstructionID: tx.InstrId,
+				EndToEndID:    tx.EndToEndId,
+				FromAccountID: info.DbtrAcct.id(),
+				ToAccountID:   tx.CdtrAcct.id(),
+				Currency:      tx.InstdAmt.Ccy,
+			}
+
+			// An unreadable amount is left at zero and rejected with the
+			// instruction rather than the whole file.
+			if amount, err := ParseMinorUnits(tx.InstdAmt.Value); err == nil {
+				instruction.Amount = amount
+				controlSum += amount
+			}
+			batch.Instructions = append(batch.Instructions, instruction)
+		}
+	}
+
+	if len(batch.Instructions) == 0 {
+		return TransferBatch{}, errors.New("pain.001 document has no transactions")
+	}
+
+	if doc.GrpHdr.NbOfTxs != "" && doc.GrpHdr.NbOfTxs != strconv.Itoa(len(batch.Instructions)) {
+		return TransferBatch{}, fmt.Errorf("NbOfTxs is %s but the document has %d transactions", doc.GrpHdr.NbOfTxs, len(batch.Instructions))
+	}
+
+	if doc.GrpHdr.CtrlSum != "" {
+		sum, err := ParseMinorUnits(doc.GrpHdr.CtrlSum)
+		if err != nil || sum != controlSum {
+			return TransferBatch{}, fmt.Errorf("CtrlSum %s does not match the transactions", doc.GrpHdr.CtrlSum)
+		}
+	}
+
+	return batch, nil
+}
+
+// ParseTransferBatchCSV reads a CSV batch with the header
+// from_account_id,to_account_id,amount,currency,reference, where amount is a
+// decimal. Currency defaults to currency, and reference is reported back as
+// the end-to-end ID. Instructions are numbered by their line in the file.
+func ParseTransferBatchCSV(r io.Reader, currency string) (TransferBatch, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return TransferBatch{}, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"from_account_id", "to_account_id", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return TransferBatch{}, fmt.Errorf("CSV is missing the %s column", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	batch := TransferBatch{
+		MessageID:   utils.GenerateID("batch"),
+		MessageName: "CSV",
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return TransferBatch{}, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		instruction := BatchInstruction{
+			PaymentInfoID: batch.MessageID,
+			InstructionID: strconv.Itoa(line),
+			EndToEndID:    field(record, "reference"),
+			FromAccountID: field(record, "from_account_id"),
+			ToAccountID:   field(record, "to_account_id"),
+			Currency:      field(record, "currency"),
+		}
+		if instruction.EndToEndID == "" {
+			instruction.EndToEndID = "NOTPROVIDED"
+		}
+		if instruction.Currency == "" {
+			instruction.Currency = currency
+		}
+		if amount, err := ParseMinorUnits(field(record, "amount")); err == nil {
+			instruction.Amount = amount
+		}
+		batch.Instructions = append(batch.Instructions, instruction)
+	}
+
+	if len(batch.Instructions) == 0 {
+		return TransferBatch{}, errors.New("CSV has no transfers")
+	}
+
+	return batch, nil
+}
+
+type pain002StatusReason struct {
+	Code       string `xml:"Rsn>Cd"`
+	Additional string `xml:"AddtlInf,omitempty"`
+}
+
+type pain002Transaction struct {
+	InstrId    string               `xml:"OrgnlInstrId,omitempty"`
+	EndToEndId string               `xml:"OrgnlEndToEndId,omitempty"`
+	Status     string               `xml:"TxSts"`
+	Reason     *pain002StatusReason `xml:"StsRsnInf,omitempty"`
+}
+
+type pain002PaymentInfo struct {
+	PmtInfId     string               `xml:"OrgnlPmtInfId"`
+	Transactions []pain002Transaction `xml:"TxInfAndSts"`
+}
+
+type pain002Document struct {
+	XMLName xml.Name `xml:"urn:iso:std:iso:20022:tech:xsd:pain.002.001.10 Document"`
+	Report  struct {
+		MsgId        string               `xml:"GrpHdr>MsgId"`
+		CreDtTm      string               `xml:"GrpHdr>CreDtTm"`
+		OrgnlMsgId   string               `xml:"OrgnlGrpInfAndSts>OrgnlMsgId"`
+		OrgnlMsgNmId string               `xml:"OrgnlGrpInfAndSts>OrgnlMsgNmId"`
+		OrgnlNbOfTxs int                  `xml:"OrgnlGrpInfAndSts>OrgnlNbOfTxs"`
+		OrgnlCtrlSum string               `xml:"OrgnlGrpInfAndSts>OrgnlCtrlSum"`
+		GrpSts       string               `xml:"OrgnlGrpInfAndSts>GrpSts"`
+		PaymentInfos []pain002PaymentInfo `xml:"OrgnlPmtInfAndSts"`
+	} `xml:"CstmrPmtStsRpt"`
+}
+
+// BatchGroupStatus summarises instruction statuses: the common status if they
+// all share one, otherwise PART.
+func BatchGroupStatus(results []BatchResult) string {
+	status := ""
+	for _, result := range results {
+		if status != "" && result.Status != status {
+			return PaymentStatusPartial
+		}
+		status = result.Status
+	}
+	return status
+}
+
+// WritePain002 writes an ISO 20022 pain.002 payment status report for the
+// batch, with one transaction status per instruction.
+func WritePain002(w io.Writer, batch TransferBatch, results []BatchResult) error {
+	var doc pain002Document
+	doc.Report.MsgId = utils.GenerateID("sts")
+	doc.Report.CreDtTm = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	doc.Report.OrgnlMsgId = batch.MessageID
+	doc.Report.OrgnlMsgNmId = batch.MessageName
+	doc.Report.OrgnlNbOfTxs = len(batch.Instructions)
+	doc.Report.GrpSts = BatchGroupStatus(results)
+
+	var controlSum int64
+	for i, instruction := range batch.Instructions {
+		controlSum += instruction.Amount
+
+		n := len(doc.Report.PaymentInfos)
+		if n == 0 || doc.Report.PaymentInfos[n-1].PmtInfId != instruction.PaymentInfoID {
+			doc.Report.PaymentInfos = append(doc.Report.PaymentInfos, pain002PaymentInfo{PmtInfId: instruction.PaymentInfoID})
+			n++
+		}
+
+		tx := pain002Transaction{
+			InstrId:    instruction.InstructionID,
+			EndToEndId: instruction.EndToEndID,
+			Status:     results[i].Status,
+		}
+		if results[i].Reason != "" {
+			tx.Reason = &pain002StatusReason{Code: results[i].Reason, Additional: results[i].Detail}
+		}
+		doc.Report.PaymentInfos[n-1].Transactions = append(doc.Report.PaymentInfos[n-1].Transactions, tx)
+	}
+	doc.Report.OrgnlCtrlSum = formatMinorUnits(controlSum)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseMinorUnits(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "10", want: 1000},
+		{value: "10.5", want: 1050},
+		{value: "10.05", want: 1005},
+		{value: "0.01", want: 1},
+		{value: "10.", want: 1000},
+		{value: " 7.25 ", want: 725},
+		{value: "10.005", wantErr: true},
+		{value: ".50", wantErr: true},
+		{value: "-1.00", wantErr: true},
+		{value: "1,00", wantErr: true},
+		{value: "1e3", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "92233720368547758.07", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMinorUnits(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMinorUnits(%q) = %d, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMinorUnits(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+// pain001 builds a document with the given group header fields and one
+// CdtTrfTxInf per amount.
+func pain001(msgID, nbOfTxs, ctrlSum string, amounts ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.09"><CstmrCdtTrfInitn><GrpHdr>`)
+	b.WriteString("<MsgId>" + msgID + "</MsgId>")
+	if nbOfTxs != "" {
+		b.WriteString("<NbOfTxs>" + nbOfTxs + "</NbOfTxs>")
+	}
+	if ctrlSum != "" {
+		b.WriteString("<CtrlSum>" + ctrlSum + "</CtrlSum>")
+	}
+	b.WriteString(`</GrpHdr><PmtInf><PmtInfId>P1</PmtInfId><DbtrAcct><Id><Othr><Id>acc_from</Id></Othr></Id></DbtrAcct>`)
+	for i, amount := range amounts {
+		b.WriteString(`<CdtTrfTxInf><PmtId><InstrId>I` + strconv.Itoa(i+1) + `</InstrId><EndToEndId>E2E</EndToEndId></PmtId>`)
+		b.WriteString(`<Amt><InstdAmt Ccy="USD">` + amount + `</InstdAmt></Amt>`)
+		b.WriteString(`<CdtrAcct><Id><IBAN>acc_to</IBAN></Id></CdtrAcct></CdtTrfTxInf>`)
+	}
+	b.WriteString(`</PmtInf></CstmrCdtTrfInitn></Document>`)
+	return b.String()
+}
+
+func TestParsePain001(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		wantErr     string
+		wantAmounts []int64
+	}{
+		{
+			name:        "matching header",
+			doc:         pain001("MSG1", "2", "15.75", "10.50", "5.25"),
+			wantAmounts: []int64{1050, 525},
+		},
+		{
+			name:        "header checks are optional",
+			doc:         pain001("MSG1", "", "", "1"),
+			wantAmounts: []int64{100},
+		},
+		{
+			name:        "fractional control sum",
+			doc:         pain001("MSG1", "3", "0.3", "0.1", "0.1", "0.1"),
+			wantAmounts: []int64{10, 10, 10},
+		},
+		{
+			name:    "NbOfTxs mismatch",
+			doc:     pain001("MSG1", "3", "", "10", "5"),
+			wantErr: "NbOfTxs is 3 but the document has 2 transactions",
+		},
+		{
+			name:    "CtrlSum mismatch",
+			doc:     pain001("MSG1", "2", "15.76", "10.50", "5.25"),
+			wantErr: "CtrlSum 15.76 does not match",
+		},
+		{
+			name:    "unreadable CtrlSum",
+			doc:     pain001("MSG1", "", "15.7.5", "10.50", "5.25"),
+			wantErr: "CtrlSum 15.7.5 does not match",
+		},
+		{
+			// The bad amount is left at zero for the instruction to be
+			// rejected, so a CtrlSum that includes it no longer matches.
+			name:    "unreadable amount against CtrlSum",
+			doc:     pain001("MSG1", "", "10.001", "10.001"),
+			wantErr: "CtrlSum 10.001 does not match",
+		},
+		{
+			name:        "unreadable amount without CtrlSum",
+			doc:         pain001("MSG1", "", "", "10.001", "2"),
+			wantAmounts: []int64{0, 200},
+		},
+		{
+			name:    "missing MsgId",
+			doc:     pain001("", "", "", "1"),
+			wantErr: "not a pain.001 document",
+		},
+		{
+			name:    "no transactions",
+			doc:     pain001("MSG1", "", ""),
+			wantErr: "no transactions",
+		},
+		{
+			name:    "not XML",
+			doc:     "from,to,amount",
+			wantErr: "invalid pain.001 document",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch, err := ParsePain001(strings.NewReader(tt.doc))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if batch.MessageID != "MSG1" || batch.MessageName != "pain.001.001.09" {
+				t.Errorf("message = %q %q, want MSG1 pain.001.001.09", batch.MessageID, batch.MessageName)
+			}
+			if len(batch.Instructions) != len(tt.wantAmounts) {
+				t.Fatalf("got %d instructions, want %d", len(batch.Instructions), len(tt.wantAmounts))
+			}
+			for i, instruction := range batch.Instructions {
+				if instruction.Amount != tt.wantAmounts[i] {
+					t.Errorf("instruction %d amount = %d, want %d", i, instruction.Amount, tt.wantAmounts[i])
+				}
+				if instruction.FromAccountID != "acc_from" || instruction.ToAccountID != "acc_to" || instruction.Currency != "USD" {
+					t.Errorf("instruction %d = %+v", i, instruction)
+				}
+			}
+		})
+	}
+}
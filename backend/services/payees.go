@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/utils"
+)
+
+var (
+	ErrRecipientNotFound  = errors.New("recipient not found")
+	ErrNoReceivingAccount = errors.New("recipient has no default receiving account")
+)
+
+// ResolveRecipient looks up a user by email or username and returns the
+// account that should receive transfers addressed to them.
+func ResolveRecipient(ctx context.Context, identifier string) (repository.User, repository.Account, error) {
+	user, err := LookupRecipient(ctx, identifier)
+	if err != nil {
+		return repository.User{}, repository.Account{}, err
+	}
+
+	account, err := ReceivingAccount(ctx, user)
+	if err != nil {
+		return repository.User{}, repository.Account{}, err
+	}
+
+	return user, account, nil
+}
+
+// LookupRecipient finds a user by email address or, failing the email format
+// check, by username. Admins are hidden from the user directory and cannot be
+// addressed this way.
+func LookupRecipient(ctx context.Context, identifier string) (repository.User, error) {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return repository.User{}, ErrRecipientNotFound
+	}
+
+	var (
+		user repository.User
+		err  error
+	)
+	if utils.IsValidEmail(identifier) {
+		user, err = repository.GetUserByEmail(ctx, identifier)
+	} else {
+		user, err = repository.GetUserByUsername(ctx, identifier)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return repository.User{}, ErrRecipientNotFound
+		}
+		return repository.User{}, err
+	}
+
+	if user.Role == "admin" {
+		return repository.User{}, ErrRecipientNotFound
+	}
+
+	return user, nil
+}
+
+// ReceivingAccount returns the user's designated default account. Users with a
+// single account receive into it without having to designate it first.
+func ReceivingAccount(ctx context.Context, user repository.User) (repository.Account, error) {
+	if user.DefaultAccountID != "" {
+		account, err := repository.GetAccountByID(ctx, user.DefaultAccountID)
+		if err == nil && account.UserID == user.ID {
+			return account, nil
+		}
+		if err != nil && !errors.Is(err, repository.ErrAccountNotFound) {
+			return repository.Account{}, err
+		}
+	}
+
+	accounts, err := repository.GetAccountsByUserID(ctx, user.ID)
+	if err != nil {
+		return repository.Account{}, err
+	}
+	if len(accounts) != 1 {
+		return repository.Account{}, ErrNoReceivingAccount
+	}
+
+	return accounts[0], nil
+}
+
+// MaskName hides all but the first letter of each part of a name, so a sender
+// can confirm the recipient without learning their full name.
+func MaskName(name string) string {
+	parts := strings.Fields(name)
+	for i, part := range parts {
+		runes := []rune(part)
+		parts[i] = string(runes[0]) + strings.Repeat("*", len(runes)-1)
+	}
+	return strings.Join(parts, " ")
+}
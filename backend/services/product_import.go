@@ -0,0 +1,481 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/utils"
+)
+
+// MaxProductImportRows bounds the products in one import file.
+const MaxProductImportRows = 1000
+
+// Import row actions and statuses.
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+
+	ImportValid   = "valid"
+	ImportInvalid = "invalid"
+	ImportWritten = "written"
+	ImportFailed  = "failed"
+)
+
+// ErrImportInvalid is returned when an import has invalid rows; nothing is
+// written then.
+var ErrImportInvalid = errors.New("product import has invalid rows")
+
+// ProductImportRow is one product in an import file, matched to the catalogue
+// by SKU. Price is in minor units. Stock is only taken for new products, and
+// variants are left alone when Variants is nil.
+type ProductImportRow struct {
+	Line        int                          `json:"-"`
+	SKU         string                       `json:"sku"`
+	Name        string                       `json:"name"`
+	Description string                       `json:"description"`
+	Category    string                       `json:"category"`
+	TaxClass    string                       `json:"tax_class"`
+	Price       int64                        `json:"price"`
+	Stock       *int                         `json:"stock"`
+	Variants    *[]repository.ProductVariant `json:"variants"`
+}
+
+// ProductImportResult is the outcome of one row.
+type ProductImportResult struct {
+	Line      int      `json:"line"`
+	SKU       string   `json:"sku"`
+	Action    string   `json:"action,omitempty"`
+	ProductID string   `json:"product_id,omitempty"`
+	Status    string   `json:"status"`
+	Errors    []string `json:"errors,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// ProductImportReport summarises an import. In a dry run the counts are of
+// what would be written.
+type ProductImportReport struct {
+	DryRun    bool                  `json:"dry_run"`
+	Created   int                   `json:"created"`
+	Updated   int                   `json:"updated"`
+	Unchanged int                   `json:"unchanged"`
+	Invalid   int                   `json:"invalid"`
+	Failed    int                   `json:"failed"`
+	Rows      []ProductImportResult `json:"rows"`
+}
+
+// ParseProductImportCSV reads products from a CSV file with the header
+// sku,name,description,category,tax_class,price,stock, where price is a
+// decimal. Variants cannot be given in CSV. Rows are numbered by their line.
+func ParseProductImportCSV(r io.Reader) ([]ProductImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"sku", "name", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV is missing the %s column", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []ProductImportRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == MaxProductImportRows {
+			return nil, fmt.Errorf("CSV has more than %d products", MaxProductImportRows)
+		}
+
+		row := ProductImportRow{
+			Line:        line,
+			SKU:         field(record, "sku"),
+			Name:        field(record, "name"),
+			Description: field(record, "description"),
+			Category:    field(record, "category"),
+			TaxClass:    field(record, "tax_class"),
+			Price:       -1,
+		}
+
+		// Unreadable numbers are left invalid and reported with the row
+		// rather than failing the whole file.
+		if price, err := ParseMinorUnits(field(record, "price")); err == nil {
+			row.Price = price
+		}
+		if value := field(record, "stock"); value != "" {
+			stock, err := strconv.Atoi(value)
+			if err != nil {
+				stock = -1
+			}
+			row.Stock = &stock
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("CSV has no products")
+	}
+	return rows, nil
+}
+
+// ParseProductImportJSON reads products from a JSON array of rows. Rows are
+// numbered from 1.
+func ParseProductImportJSON(r io.Reader) ([]ProductImportRow, error) {
+	var rows []ProductImportRow
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("JSON has no products")
+	}
+	if len(rows) > MaxProductImportRows {
+		return nil, fmt.Errorf("JSON has more than %d products", MaxProductImportRows)
+	}
+
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	return rows, nil
+}
+
+// productImport is a validated row with the product it writes.
+type productImport struct {
+	result  ProductImportResult
+	before  repository.Product
+	product repository.Product
+}
+
+// ImportProducts upserts products by SKU. Every row is validated first, and
+// if any is invalid nothing is written and ErrImportInvalid is returned with
+// the report. New products are written in batches, each after the movements
+// logging its initial stock; existing ones are updated one at a time against
+// the version read, and their stock is left to inventory adjustments. A dry
+// run validates and reports without writing.
+func ImportProducts(ctx context.Context, rows []ProductImportRow, dryRun bool) (ProductImportReport, error) {
+	products, err := repository.GetAllProducts(ctx)
+	if err != nil {
+		return ProductImportReport{}, err
+	}
+
+	bySKU := map[string]repository.Product{}
+	for _, product := range products {
+		if product.SKU != "" {
+			bySKU[product.SKU] = product
+		}
+	}
+
+	report := ProductImportReport{DryRun: dryRun}
+	imports := make([]productImport, 0, len(rows))
+	lines := map[string]int{}
+	now := time.Now()
+
+	for _, row := range rows {
+		imp := validateImportRow(row, bySKU, now)
+		if line, ok := lines[imp.result.SKU]; ok && imp.result.SKU != "" {
+			imp.result.Errors = append(imp.result.Errors, fmt.Sprintf("SKU also on line %d", line))
+		}
+		lines[imp.result.SKU] = row.Line
+
+		if len(imp.result.Errors) > 0 {
+			imp.result.Status = ImportInvalid
+			imp.result.Action = ""
+			imp.result.ProductID = ""
+			report.Invalid++
+		}
+		imports = append(imports, imp)
+	}
+
+	if report.Invalid > 0 || dryRun {
+		for _, imp := range imports {
+			if imp.result.Status == ImportValid {
+				report.count(imp.result.Action)
+			}
+			report.Rows = append(report.Rows, imp.result)
+		}
+		if report.Invalid > 0 && !dryRun {
+			return report, ErrImportInvalid
+		}
+		return report, nil
+	}
+
+	var created []repository.Product
+	for _, imp := range imports {
+		if imp.result.Action == ImportCreate {
+			created = append(created, imp.product)
+		}
+	}
+
+	failedIDs, err := repository.BatchCreateProducts(ctx, created)
+	if err != nil {
+		return ProductImportReport{}, err
+	}
+	failed := map[string]bool{}
+	for _, id := range failedIDs {
+		failed[id] = true
+	}
+
+	for _, imp := range imports {
+		result := imp.result
+		result.Status = ImportWritten
+
+		switch result.Action {
+		case ImportCreate:
+			if failed[result.ProductID] {
+				result.Status = ImportFailed
+				result.Errors = append(result.Errors, "Product could not be written; import it again to create it")
+			}
+		case ImportUpdate:
+			if err := repository.UpdateProduct(ctx, imp.before, imp.product); err != nil {
+				result.Status = ImportFailed
+				switch {
+				case errors.Is(err, repository.ErrVersionConflict), errors.Is(err, repository.ErrVariantInUse):
+					result.Errors = append(result.Errors, "Product changed during the import")
+				case errors.Is(err, repository.ErrProductNotFound):
+					result.Errors = append(result.Errors, "Product no longer exists")
+				default:
+					result.Errors = append(result.Errors, "Failed to update product")
+				}
+			}
+		}
+
+		if result.Status == ImportFailed {
+			report.Failed++
+		} else {
+			report.count(result.Action)
+		}
+		report.Rows = append(report.Rows, result)
+	}
+
+	return report, nil
+}
+
+func (r *ProductImportReport) count(action string) {
+	switch action {
+	case ImportCreate:
+		r.Created++
+	case ImportUpdate:
+		r.Updated++
+	case ImportUnchanged:
+		r.Unchanged++
+	}
+}
+
+// validateImportRow checks a row and works out the product it creates or
+// the update it makes to the product with its SKU.
+func validateImportRow(row ProductImportRow, bySKU map[string]repository.Product, now time.Time) productImport {
+	imp := productImport{result: ProductImportResult{
+		Line:   row.Line,
+		SKU:    strings.TrimSpace(row.SKU),
+		Status: ImportValid,
+	}}
+	fail := func(format string, args ...any) {
+		imp.result.Errors = append(imp.result.Errors, fmt.Sprintf(format, args...))
+	}
+	warn := func(format string, args ...any) {
+		imp.result.Warnings = append(imp.result.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	if !repository.ValidSKU(imp.result.SKU) {
+		fail("SKU must be 1-64 letters, digits, '.', '-' or '_'")
+	}
+	name := strings.TrimSpace(row.Name)
+	if name == "" {
+		fail("Name is required")
+	}
+	if row.Price <= 0 {
+		fail("Price must be a positive amount")
+	}
+	if row.Stock != nil && *row.Stock < 0 {
+		fail("Stock must be a whole number of zero or more")
+	}
+	taxClass := NormalizeTaxClass(row.TaxClass)
+	if taxClass != "" && !IsTaxClass(taxClass) {
+		fail("Unknown tax class %q", row.TaxClass)
+	}
+
+	var variants map[string]repository.ProductVariant
+	if row.Variants != nil {
+		var err error
+		if variants, err = importVariants(*row.Variants); err != nil {
+			fail("%s", err)
+		}
+	}
+
+	existing, exists := bySKU[imp.result.SKU]
+	product := existing
+	if !exists {
+		product = repository.Product{
+			ID:        utils.GenerateUserID(),
+			CreatedAt: now,
+		}
+	}
+	product.SKU = imp.result.SKU
+	product.Name = name
+	product.Description = strings.TrimSpace(row.Description)
+	product.Category = strings.ToLower(strings.TrimSpace(row.Category))
+	product.TaxClass = taxClass
+	product.Price = row.Price
+
+	if !exists {
+		imp.result.Action = ImportCreate
+		product.Variants = variants
+		if len(variants) > 0 {
+			total := 0
+			for _, variant := range variants {
+				total += variant.Stock
+			}
+			if row.Stock != nil && *row.Stock != total {
+				fail("Stock of a product with variants is the sum of theirs")
+			}
+			product.Stock = total
+		} else if row.Stock != nil {
+			product.Stock = *row.Stock
+		}
+	} else {
+		if row.Stock != nil && *row.Stock != existing.Stock {
+			warn("Stock differs from the catalogue's %d and is left unchanged; use inventory adjustments", existing.Stock)
+		}
+		if existing.Archived() {
+			warn("Product is archived")
+		}
+
+		if variants != nil {
+			for sku, variant := range variants {
+				if variant.Stock != 0 && variant.Stock != existing.Variants[sku].Stock {
+					warn("Stock of variant %s is left unchanged; use inventory adjustments", sku)
+				}
+			}
+
+			merged, err := existing.MergeVariants(variants)
+			switch {
+			case errors.Is(err, repository.ErrVariantInUse):
+				fail("A removed variant still has stock")
+			case errors.Is(err, repository.ErrProductHasStock):
+				fail("Product stock must be zero before adding variants")
+			}
+			if len(merged) == 0 {
+				merged = nil
+			}
+			product.Variants = merged
+		}
+
+		imp.result.Action = ImportUpdate
+		if reflect.DeepEqual(existing, product) {
+			imp.result.Action = ImportUnchanged
+		}
+	}
+
+	imp.result.ProductID = product.ID
+	imp.before, imp.product = existing, product
+	return imp
+}
+
+// importVariants validates imported variant definitions and keys them by SKU.
+func importVariants(variants []repository.ProductVariant) (map[string]repository.ProductVariant, error) {
+	if len(variants) > repository.MaxProductVariants {
+		return nil, fmt.Errorf("A product can have at most %d variants", repository.MaxProductVariants)
+	}
+
+	bySKU := make(map[string]repository.ProductVariant, len(variants))
+	for _, variant := range variants {
+		if !repository.ValidSKU(variant.SKU) {
+			return nil, fmt.Errorf("Invalid variant SKU %q", variant.SKU)
+		}
+		if _, ok := bySKU[variant.SKU]; ok {
+			return nil, fmt.Errorf("Duplicate variant SKU %s", variant.SKU)
+		}
+		if len(variant.Attributes) == 0 {
+			return nil, fmt.Errorf("Variant %s needs at least one attribute", variant.SKU)
+		}
+		if variant.Price < 0 || variant.Stock < 0 {
+			return nil, fmt.Errorf("Variant %s has a negative price or stock", variant.SKU)
+		}
+
+		variant.Reserved = 0
+		bySKU[variant.SKU] = variant
+	}
+	return bySKU, nil
+}
+
+// WriteProductsCSV writes products in the import CSV format, with their ID
+// and whether they are archived added, sorted by SKU.
+func WriteProductsCSV(w io.Writer, products []repository.Product) error {
+	products = sortedProducts(products)
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"id", "sku", "name", "description", "category", "tax_class", "price", "stock", "archived"}); err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		record := []string{
+			product.ID,
+			product.SKU,
+			product.Name,
+			product.Description,
+			product.Category,
+			product.TaxClass,
+			formatMinorUnits(product.Price),
+			strconv.Itoa(product.Stock),
+			strconv.FormatBool(product.Archived()),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteProductsJSON writes products as a JSON array sorted by SKU, which
+// imports as it is.
+func WriteProductsJSON(w io.Writer, products []repository.Product) error {
+	products = sortedProducts(products)
+	if products == nil {
+		products = []repository.Product{}
+	}
+	return json.NewEncoder(w).Encode(products)
+}
+
+// sortedProducts orders products by SKU, then ID, so exports are stable.
+func sortedProducts(products []repository.Product) []repository.Product {
+	products = append([]repository.Product(nil), products...)
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].SKU != products[j].SKU {
+			return products[i].SKU < products[j].SKU
+		}
+		return products[i].ID < products[j].ID
+	})
+	return products
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/utils"
+)
+
+// simulatorFailureCents makes the simulator fail any transfer whose amount
+// ends in these minor units (e.g. 10.13), so failures can be exercised.
+const simulatorFailureCents = 13
+
+// RailEvent is a rail's report on the outcome of a transfer, delivered through
+// the webhook (or directly, by the simulator).
+type RailEvent struct {
+	TransferID string `json:"transfer_id"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// PaymentRail moves money between the bank and the outside world. Submit only
+// hands the transfer over; the outcome arrives later as a RailEvent. Status
+// asks the rail for the outcome directly, for transfers whose event never
+// arrived, and reports them as pending while the rail has no outcome yet.
+type PaymentRail interface {
+	Name() string
+	Submit(ctx context.Context, transfer repository.ExternalTransfer) (reference string, err error)
+	Status(ctx context.Context, transfer repository.ExternalTransfer) (RailEvent, error)
+}
+
+var (
+	ErrUnknownRail          = errors.New("unknown payment rail")
+	ErrInvalidRailEvent     = errors.New("invalid payment rail event")
+	ErrRailNotConfigured    = errors.New("payment rail not configured")
+	ErrInvalidRailSignature = errors.New("invalid payment rail signature")
+)
+
+var (
+	paymentRail       PaymentRail
+	railWebhookSecret []byte
+)
+
+// ConfigurePaymentRail selects the rail that deposits and withdrawals are
+// submitted to. Without a provider none is, and they fail with
+// ErrRailNotConfigured.
+func ConfigurePaymentRail(cfg config.RailConfig) error {
+	switch cfg.Provider {
+	case "":
+		paymentRail = nil
+	case "simulator":
+		sources := map[string]bool{}
+		for _, source := range cfg.SimulatorSources {
+			sources[source] = true
+		}
+		paymentRail = &SimulatedRail{Delay: cfg.SimulatorDelay, Sources: sources}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownRail, cfg.Provider)
+	}
+	railWebhookSecret = []byte(cfg.WebhookSecret)
+	return nil
+}
+
+// InitiateExternalTransfer records a pending deposit or withdrawal on the
+// account and submits it to the rail. A deposit is pulled from source, which
+// the rail must accept; a withdrawal holds its amount until the rail settles
+// or fails it. If the rail rejects the submission outright the transfer is
+// failed straight away.
+func InitiateExternalTransfer(ctx context.Context, account repository.Account, direction string, amount int64, source string) (repository.ExternalTransfer, error) {
+	if paymentRail == nil {
+		return repository.ExternalTransfer{}, ErrRailNotConfigured
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	transfer := repository.ExternalTransfer{
+		ID:        utils.GenerateID("ext"),
+		UserID:    account.UserID,
+		AccountID: account.ID,
+		Direction: direction,
+		Amount:    amount,
+		Status:    repository.ExternalStatusPending,
+		Rail:      paymentRail.Name(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if direction == repository.ExternalDirectionDeposit {
+		transfer.Source = source
+	}
+
+	if err := repository.CreateExternalTransfer(ctx, transfer, account); err != nil {
+		return repository.ExternalTransfer{}, err
+	}
+
+	return submitExternalTransfer(ctx, transfer)
+}
+
+// submitExternalTransfer hands a recorded pending transfer to the rail, failing
+// it if the rail rejects the submission outright.
+func submitExternalTransfer(ctx context.Context, transfer repository.ExternalTransfer) (repository.ExternalTransfer, error) {
+	reference, err := paymentRail.Submit(ctx, transfer)
+	if err != nil {
+		if failErr := repository.FailExternalTransfer(ctx, transfer, "rejected by rail", time.Now()); failErr != nil {
+			log.Printf("rail: failing transfer %s: %v", transfer.ID, failErr)
+		}
+		return repository.ExternalTransfer{}, fmt.Errorf("submit to %s: %w", transfer.Rail, err)
+	}
+
+	if err := repository.SetExternalTransferReference(ctx, transfer.ID, reference); err != nil {
+		log.Printf("rail: recording reference for %s: %v", transfer.ID, err)
+	}
+	transfer.RailReference = reference
+
+	return transfer, nil
+}
+
+// HandleRailEvent applies a rail's report to a pending transfer. Redelivery of
+// an event that has already been applied is not an error.
+func HandleRailEvent(ctx context.Context, event RailEvent) error {
+	transfer, err := repository.GetExternalTransferByID(ctx, event.TransferID)
+	if err != nil {
+		return err
+	}
+
+	if transfer.Status == event.Status {
+		return nil
+	}
+
+	switch event.Status {
+	case repository.ExternalStatusSettled:
+		err = repository.SettleExternalTransfer(ctx, transfer, time.Now())
+	case repository.ExternalStatusFailed:
+		err = repository.FailExternalTransfer(ctx, transfer, event.Reason, time.Now())
+	default:
+		return ErrInvalidRailEvent
+	}
+
+	if errors.Is(err, repository.ErrExternalTransferClosed) {
+		// Lost a race with a duplicate delivery of the same event.
+		if current, getErr := repository.GetExternalTransferByID(ctx, transfer.ID); getErr == nil && current.Status == event.Status {
+			return nil
+		}
+	}
+	return err
+}
+
+// StartRailReconciler re-drives stale pending transfers in the background
+// until the context is cancelled. Without a rail there is nothing to do.
+func StartRailReconciler(ctx context.Context, cfg config.RailConfig) {
+	if paymentRail == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.ReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := ReconcileExternalTransfers(ctx, time.Now(), cfg.StaleAfter); err != nil {
+				log.Printf("rail: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ReconcileExternalTransfers asks the rail for the outcome of every transfer
+// that has been pending for longer than staleAfter and applies the ones it
+// has, so that an event lost to a restart or a failed delivery does not leave
+// a withdrawal's hold in place forever.
+func ReconcileExternalTransfers(ctx context.Context, now time.Time, staleAfter time.Duration) error {
+	if paymentRail == nil {
+		return ErrRailNotConfigured
+	}
+
+	transfers, err := repository.GetStalePendingExternalTransfers(ctx, now.Add(-staleAfter))
+	if err != nil {
+		return err
+	}
+
+	for _, transfer := range transfers {
+		event, err := paymentRail.Status(ctx, transfer)
+		if err != nil {
+			log.Printf("rail: checking %s: %v", transfer.ID, err)
+			continue
+		}
+		if event.Status == repository.ExternalStatusPending {
+			continue
+		}
+
+		err = HandleRailEvent(ctx, event)
+		if err != nil && !errors.Is(err, repository.ErrExternalTransferClosed) {
+			log.Printf("rail: reconciling %s: %v", transfer.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// VerifyRailSignature checks the hex HMAC-SHA256 of a webhook body against the
+// configured secret. Without a secret every webhook is rejected.
+func VerifyRailSignature(body []byte, signature string) error {
+	if len(railWebhookSecret) == 0 {
+		return ErrRailNotConfigured
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidRailSignature
+	}
+
+	h := hmac.New(sha256.New, railWebhookSecret)
+	h.Write(body)
+	if !hmac.Equal(h.Sum(nil), expected) {
+		return ErrInvalidRailSignature
+	}
+
+	return nil
+}
+
+// SimulatedRail settles every transfer after Delay, except amounts ending in
+// simulatorFailureCents and deposits from a source not in Sources, which
+// fail; it moves no real money, so it must only credit deposits from test
+// sources. Outcomes are delivered from memory, so ones lost when the process
+// stops are picked up by the reconciler through Status instead.
+type SimulatedRail struct {
+	Delay   time.Duration
+	Sources map[string]bool
+}
+
+func (s *SimulatedRail) Name() string {
+	return "simulator"
+}
+
+func (s *SimulatedRail) Submit(ctx context.Context, transfer repository.ExternalTransfer) (string, error) {
+	event := s.outcome(transfer)
+
+	time.AfterFunc(s.Delay, func() {
+		if err := HandleRailEvent(context.Background(), event); err != nil {
+			log.Printf("rail: simulator event for %s: %v", transfer.ID, err)
+		}
+	})
+
+	return "sim_" + transfer.ID, nil
+}
+
+func (s *SimulatedRail) Status(ctx context.Context, transfer repository.ExternalTransfer) (RailEvent, error) {
+	if time.Since(transfer.CreatedAt) < s.Delay {
+		return RailEvent{TransferID: transfer.ID, Status: repository.ExternalStatusPending}, nil
+	}
+	return s.outcome(transfer), nil
+}
+
+func (s *SimulatedRail) outcome(transfer repository.ExternalTransfer) RailEvent {
+	if transfer.Amount%100 == simulatorFailureCents {
+		return RailEvent{TransferID: transfer.ID, Status: repository.ExternalStatusFailed, Reason: "declined by simulator"}
+	}
+	if transfer.Direction == repository.ExternalDirectionDeposit && !s.Sources[transfer.Source] {
+		return RailEvent{TransferID: transfer.ID, Status: repository.ExternalStatusFailed, Reason: "unknown funding source"}
+	}
+	return RailEvent{TransferID: transfer.ID, Status: repository.ExternalStatusSettled}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+)
+
+// StartReservationExpiry returns expired stock reservations to their products
+// in the background until the context is cancelled.
+func StartReservationExpiry(ctx context.Context, cfg config.ReservationConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.ExpiryInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := ExpireReservations(ctx, time.Now()); err != nil {
+				log.Printf("reservations: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ExpireReservations releases every active reservation whose expiry has
+// passed. Reservations purchased or released in the meantime are skipped.
+func ExpireReservations(ctx context.Context, now time.Time) error {
+	reservations, err := repository.GetExpiredReservations(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		err := repository.ReleaseReservation(ctx, reservation, repository.ReservationStatusExpired, now)
+		if err != nil && !errors.Is(err, repository.ErrReservationClosed) {
+			log.Printf("reservations: expiring %s: %v", reservation.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/utils"
+)
+
+// QueueForReview fills in the review item for assessment and stores it,
+// holding its amount on the account. Items without an ID get a fresh one.
+func QueueForReview(ctx context.Context, item repository.ReviewItem, account repository.Account, assessment repository.RiskAssessment) (repository.ReviewItem, error) {
+	item = NewReviewItem(item, assessment)
+
+	if err := repository.CreateReviewItem(ctx, item, account); err != nil {
+		return repository.ReviewItem{}, err
+	}
+
+	return item, nil
+}
+
+// NewReviewItem fills in a pending review item for assessment without storing
+// it, for callers that park it as part of a larger transaction. Items without
+// an ID get a fresh one.
+func NewReviewItem(item repository.ReviewItem, assessment repository.RiskAssessment) repository.ReviewItem {
+	now := time.Now().UTC().Truncate(time.Second)
+	if item.ID == "" {
+		item.ID = utils.GenerateID("review")
+	}
+	item.Status = repository.ReviewStatusPending
+	item.RiskAssessmentID = assessment.ID
+	item.Triggered = assessment.Triggered
+	item.CreatedAt = now
+	item.DueAt = now.Add(config.GetReviewConfig().SLA)
+	item.UpdatedAt = now
+	return item
+}
+
+// ApproveReviewItem approves a parked payment. Transfers and purchases are
+// executed from their held funds; an approved withdrawal becomes a pending
+// external transfer and is submitted to the rail, keeping its hold until the
+// rail reports back. A submission that is lost here is picked up by the rail
+// reconciler.
+func ApproveReviewItem(ctx context.Context, item repository.ReviewItem, reviewerID, note string, now time.Time) error {
+	if item.Kind != repository.ReviewKindWithdrawal {
+		return repository.ApproveReviewItem(ctx, item, reviewerID, note, now)
+	}
+
+	if paymentRail == nil {
+		return ErrRailNotConfigured
+	}
+
+	transfer := repository.ExternalTransfer{
+		ID:        "ext_" + item.ID,
+		UserID:    item.UserID,
+		AccountID: item.AccountID,
+		Direction: repository.ExternalDirectionWithdrawal,
+		Amount:    item.Amount,
+		Status:    repository.ExternalStatusPending,
+		Rail:      paymentRail.Name(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := repository.ApproveReviewWithdrawal(ctx, item, transfer, reviewerID, note, now); err != nil {
+		return err
+	}
+
+	if _, err := submitExternalTransfer(ctx, transfer); err != nil {
+		log.Printf("review: withdrawal %s: %v", transfer.ID, err)
+	}
+	return nil
+}
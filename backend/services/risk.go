@@ -0,0 +1,414 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/utils"
+)
+
+// Risk decisions, from least to most severe.
+const (
+	RiskAllow  = "allow"
+	RiskReview = "review"
+	RiskDeny   = "deny"
+)
+
+// Kinds of outgoing payment the risk engine is asked about. They match the
+// transaction type each kind is recorded as.
+const (
+	RiskKindTransfer   = "transfer"
+	RiskKindPurchase   = "purchase"
+	RiskKindWithdrawal = "withdrawal"
+)
+
+var riskSeverity = map[string]int{RiskAllow: 0, RiskReview: 1, RiskDeny: 2}
+
+// RiskOperation describes money about to leave one of a user's accounts.
+// Pending counts payments of the same kind that go ahead just before this one
+// but are not recorded yet, such as earlier items of the same batch.
+type RiskOperation struct {
+	Kind        string
+	UserID      string
+	AccountID   string
+	ToAccountID string
+	ProductID   string
+	Amount      int64
+	Pending     int
+	Now         time.Time
+}
+
+// RiskRule is one check of the risk engine. Evaluate reports whether the rule
+// fires for op and, if it does, why.
+type RiskRule interface {
+	Evaluate(ctx context.Context, op RiskOperation, history *RiskHistory) (fired bool, reason string, err error)
+}
+
+// RiskRuleFactory builds a rule of one type from its configuration.
+type RiskRuleFactory func(cfg config.RiskRuleConfig) (RiskRule, error)
+
+var (
+	ErrUnknownRiskRule = errors.New("unknown risk rule type")
+	ErrInvalidRiskRule = errors.New("invalid risk rule")
+	ErrRiskDeclined    = errors.New("payment declined by risk checks")
+)
+
+var riskRuleTypes = map[string]RiskRuleFactory{
+	"velocity":        newVelocityRule,
+	"new_payee":       newNewPayeeRule,
+	"password_change": newPasswordChangeRule,
+	"unusual_amount":  newUnusualAmountRule,
+	"amount_limit":    newAmountLimitRule,
+}
+
+// RegisterRiskRuleType makes a rule type available to the risk rules
+// configuration. It must be called before ConfigureRiskEngine.
+func RegisterRiskRuleType(ruleType string, factory RiskRuleFactory) {
+	riskRuleTypes[ruleType] = factory
+}
+
+type configuredRiskRule struct {
+	name      string
+	outcome   string
+	appliesTo []string
+	rule      RiskRule
+}
+
+var riskRules []configuredRiskRule
+
+// ConfigureRiskEngine builds the enabled rules of cfg. A rule whose outcome is
+// allow only records that it fired, which is useful for trying out a rule
+// before it is enforced.
+func ConfigureRiskEngine(cfg config.RiskConfig) error {
+	var rules []configuredRiskRule
+	for _, ruleCfg := range cfg.Rules {
+		if !ruleCfg.Enabled {
+			continue
+		}
+
+		if _, ok := riskSeverity[ruleCfg.Outcome]; !ok {
+			return fmt.Errorf("%w %q: outcome must be allow, review or deny", ErrInvalidRiskRule, ruleCfg.Name)
+		}
+
+		for _, kind := range ruleCfg.AppliesTo {
+			if kind != RiskKindTransfer && kind != RiskKindPurchase && kind != RiskKindWithdrawal {
+				return fmt.Errorf("%w %q: unknown payment kind %q", ErrInvalidRiskRule, ruleCfg.Name, kind)
+			}
+		}
+
+		factory, ok := riskRuleTypes[ruleCfg.Type]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownRiskRule, ruleCfg.Type)
+		}
+
+		rule, err := factory(ruleCfg)
+		if err != nil {
+			return fmt.Errorf("risk rule %q: %w", ruleCfg.Name, err)
+		}
+
+		rules = append(rules, configuredRiskRule{
+			name:      ruleCfg.Name,
+			outcome:   ruleCfg.Outcome,
+			appliesTo: ruleCfg.AppliesTo,
+			rule:      rule,
+		})
+	}
+
+	riskRules = rules
+	return nil
+}
+
+// AssessRisk runs the configured rules against op and records the result. The
+// decision is the most severe outcome among the rules that fired, or allow if
+// none did.
+func AssessRisk(ctx context.Context, op RiskOperation) (repository.RiskAssessment, error) {
+	if op.Now.IsZero() {
+		op.Now = time.Now()
+	}
+
+	assessment := repository.RiskAssessment{
+		ID:          utils.GenerateID("risk"),
+		UserID:      op.UserID,
+		AccountID:   op.AccountID,
+		Kind:        op.Kind,
+		ToAccountID: op.ToAccountID,
+		ProductID:   op.ProductID,
+		Amount:      op.Amount,
+		Decision:    RiskAllow,
+		Triggered:   []repository.RiskRuleHit{},
+		CreatedAt:   op.Now.UTC().Truncate(time.Second),
+	}
+
+	history := &RiskHistory{userID: op.UserID}
+	for _, rule := range riskRules {
+		if len(rule.appliesTo) > 0 && !slices.Contains(rule.appliesTo, op.Kind) {
+			continue
+		}
+
+		fired, reason, err := rule.rule.Evaluate(ctx, op, history)
+		if err != nil {
+			return repository.RiskAssessment{}, fmt.Errorf("risk rule %s: %w", rule.name, err)
+		}
+		if !fired {
+			continue
+		}
+
+		assessment.Triggered = append(assessment.Triggered, repository.RiskRuleHit{
+			Rule:    rule.name,
+			Outcome: rule.outcome,
+			Reason:  reason,
+		})
+		if riskSeverity[rule.outcome] > riskSeverity[assessment.Decision] {
+			assessment.Decision = rule.outcome
+		}
+	}
+
+	if err := repository.CreateRiskAssessment(ctx, assessment); err != nil {
+		return repository.RiskAssessment{}, err
+	}
+
+	if len(assessment.Triggered) > 0 {
+		names := make([]string, len(assessment.Triggered))
+		for i, hit := range assessment.Triggered {
+			names[i] = hit.Rule
+		}
+		log.Printf("risk: %s %s of %d from %s: %s (%s)", assessment.ID, op.Kind, op.Amount, op.AccountID,
+			assessment.Decision, strings.Join(names, ", "))
+	}
+
+	return assessment, nil
+}
+
+// RiskHistory loads what rules need to know about the paying user on first
+// use, so each is fetched at most once per assessment.
+type RiskHistory struct {
+	userID         string
+	user           *repository.User
+	outgoing       []repository.Transaction
+	outgoingLoaded bool
+}
+
+// User returns the paying user.
+func (h *RiskHistory) User(ctx context.Context) (repository.User, error) {
+	if h.user == nil {
+		user, err := repository.GetUserByID(ctx, h.userID)
+		if err != nil {
+			return repository.User{}, err
+		}
+		h.user = &user
+	}
+	return *h.user, nil
+}
+
+// Outgoing returns the user's earlier transfers out, purchases and settled
+// withdrawals, newest first.
+func (h *RiskHistory) Outgoing(ctx context.Context) ([]repository.Transaction, error) {
+	if !h.outgoingLoaded {
+		transactions, err := repository.GetTransactionsByUserID(ctx, h.userID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, txn := range transactions {
+			if txn.TransactionType == RiskKindPurchase || txn.TransactionType == RiskKindWithdrawal ||
+				(txn.TransactionType == RiskKindTransfer && txn.Direction == "debit") {
+				h.outgoing = append(h.outgoing, txn)
+			}
+		}
+		slices.SortFunc(h.outgoing, func(a, b repository.Transaction) int {
+			return b.CreatedAt.Compare(a.CreatedAt)
+		})
+		h.outgoingLoaded = true
+	}
+	return h.outgoing, nil
+}
+
+func riskRuleWindow(cfg config.RiskRuleConfig) (time.Duration, error) {
+	window, err := time.ParseDuration(cfg.Window)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("%w: window must be a positive duration", ErrInvalidRiskRule)
+	}
+	return window, nil
+}
+
+// velocityRule fires when the user has already made MaxCount payments of the
+// same kind within Window, counting the operation's pending ones.
+type velocityRule struct {
+	maxCount int
+	window   time.Duration
+}
+
+func newVelocityRule(cfg config.RiskRuleConfig) (RiskRule, error) {
+	window, err := riskRuleWindow(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxCount <= 0 {
+		return nil, fmt.Errorf("%w: max_count must be positive", ErrInvalidRiskRule)
+	}
+	return velocityRule{maxCount: cfg.MaxCount, window: window}, nil
+}
+
+func (r velocityRule) Evaluate(ctx context.Context, op RiskOperation, history *RiskHistory) (bool, string, error) {
+	outgoing, err := history.Outgoing(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	since := op.Now.Add(-r.window)
+	count := op.Pending
+	for _, txn := range outgoing {
+		if txn.TransactionType == op.Kind && txn.CreatedAt.After(since) {
+			count++
+		}
+	}
+
+	if count < r.maxCount {
+		return false, "", nil
+	}
+	return true, fmt.Sprintf("%d %ss in the last %s", count, op.Kind, r.window), nil
+}
+
+// newPayeeRule fires on a transfer of at least MinAmount to an account the
+// user has never paid before.
+type newPayeeRule struct {
+	minAmount int64
+}
+
+func newNewPayeeRule(cfg config.RiskRuleConfig) (RiskRule, error) {
+	if cfg.MinAmount < 0 {
+		return nil, fmt.Errorf("%w: min_amount cannot be negative", ErrInvalidRiskRule)
+	}
+	return newPayeeRule{minAmount: cfg.MinAmount}, nil
+}
+
+func (r newPayeeRule) Evaluate(ctx context.Context, op RiskOperation, history *RiskHistory) (bool, string, error) {
+	if op.ToAccountID == "" || op.Amount < r.minAmount {
+		return false, "", nil
+	}
+
+	outgoing, err := history.Outgoing(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	for _, txn := range outgoing {
+		if txn.Counterparty == op.ToAccountID {
+			return false, "", nil
+		}
+	}
+	return true, fmt.Sprintf("first payment to %s is at least %d", op.ToAccountID, r.minAmount), nil
+}
+
+// passwordChangeRule fires on the user's first payment of the kind after a
+// password change made within Window.
+type passwordChangeRule struct {
+	window time.Duration
+}
+
+func newPasswordChangeRule(cfg config.RiskRuleConfig) (RiskRule, error) {
+	window, err := riskRuleWindow(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return passwordChangeRule{window: window}, nil
+}
+
+func (r passwordChangeRule) Evaluate(ctx context.Context, op RiskOperation, history *RiskHistory) (bool, string, error) {
+	user, err := history.User(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	changed := user.PasswordChanged
+	if changed.IsZero() || op.Now.Sub(changed) > r.window {
+		return false, "", nil
+	}
+
+	outgoing, err := history.Outgoing(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	for _, txn := range outgoing {
+		if txn.TransactionType == op.Kind && txn.CreatedAt.After(changed) {
+			return false, "", nil
+		}
+	}
+	return true, fmt.Sprintf("first %s since password change at %s", op.Kind, changed.UTC().Format(time.RFC3339)), nil
+}
+
+// unusualAmountRule fires when the amount exceeds Multiplier times the
+// average of the user's payments of the same kind within Window, once there
+// are at least MinHistory of them to compare against.
+type unusualAmountRule struct {
+	multiplier float64
+	minHistory int
+	window     time.Duration
+}
+
+func newUnusualAmountRule(cfg config.RiskRuleConfig) (RiskRule, error) {
+	window, err := riskRuleWindow(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Multiplier <= 1 {
+		return nil, fmt.Errorf("%w: multiplier must be greater than 1", ErrInvalidRiskRule)
+	}
+	if cfg.MinHistory <= 0 {
+		return nil, fmt.Errorf("%w: min_history must be positive", ErrInvalidRiskRule)
+	}
+	return unusualAmountRule{multiplier: cfg.Multiplier, minHistory: cfg.MinHistory, window: window}, nil
+}
+
+func (r unusualAmountRule) Evaluate(ctx context.Context, op RiskOperation, history *RiskHistory) (bool, string, error) {
+	outgoing, err := history.Outgoing(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	since := op.Now.Add(-r.window)
+	var count, total int64
+	for _, txn := range outgoing {
+		if txn.TransactionType == op.Kind && txn.CreatedAt.After(since) {
+			count++
+			total += txn.TotalAmount
+		}
+	}
+
+	if count < int64(r.minHistory) {
+		return false, "", nil
+	}
+
+	average := float64(total) / float64(count)
+	if float64(op.Amount) <= r.multiplier*average {
+		return false, "", nil
+	}
+	return true, fmt.Sprintf("amount is %.1fx the average of the last %d %ss", float64(op.Amount)/average, count, op.Kind), nil
+}
+
+// amountLimitRule fires on any payment of at least MinAmount.
+type amountLimitRule struct {
+	minAmount int64
+}
+
+func newAmountLimitRule(cfg config.RiskRuleConfig) (RiskRule, error) {
+	if cfg.MinAmount <= 0 {
+		return nil, fmt.Errorf("%w: min_amount must be positive", ErrInvalidRiskRule)
+	}
+	return amountLimitRule{minAmount: cfg.MinAmount}, nil
+}
+
+func (r amountLimitRule) Evaluate(ctx context.Context, op RiskOperation, history *RiskHistory) (bool, string, error) {
+	if op.Amount < r.minAmount {
+		return false, "", nil
+	}
+	return true, fmt.Sprintf("amount is at least %d", r.minAmount), nil
+}
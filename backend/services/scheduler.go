@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+)
+
+// StartTransferScheduler runs the scheduled transfer worker in the background
+// until the context is cancelled.
+func StartTransferScheduler(ctx context.Context, cfg config.SchedulerConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := RunDueScheduledTransfers(ctx, time.Now(), cfg); err != nil {
+				log.Printf("scheduler: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunDueScheduledTransfers executes every active schedule that is due at now.
+func RunDueScheduledTransfers(ctx context.Context, now time.Time, cfg config.SchedulerConfig) error {
+	schedules, err := repository.GetDueScheduledTransfers(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if err := executeScheduledTransfer(ctx, schedule, now, cfg); err != nil {
+			log.Printf("scheduler: schedule %s: %v", schedule.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func executeScheduledTransfer(ctx context.Context, schedule repository.ScheduledTransfer, now time.Time, cfg config.SchedulerConfig) error {
+	occurrence := schedule.Occurrence
+	attempt := schedule.FailureCount + 1
+
+	runPut, err := repository.ScheduleRunPut(repository.ScheduleRun{
+		ID:         repository.ScheduleRunID(schedule.ID, occurrence),
+		ScheduleID: schedule.ID,
+		Occurrence: occurrence,
+		Attempt:    attempt,
+		Status:     "succeeded",
+		Amount:     schedule.Amount,
+		ExecutedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	reviewID, decision, err := screenScheduledTransfer(ctx, schedule, now)
+	switch {
+	case err != nil:
+	case decision == RiskDeny:
+		err = ErrRiskDeclined
+	case decision == RiskReview:
+		// The review decides this occurrence, so the schedule moves on.
+		if err := recordReviewedRun(ctx, schedule, attempt, reviewID, now); err != nil {
+			return err
+		}
+		schedule.LastError = ""
+		advanceSchedule(&schedule, true)
+		return repository.SaveScheduledTransferProgress(ctx, schedule, occurrence)
+	default:
+		err = repository.TransferMoney(ctx, schedule.FromAccountID, schedule.ToAccountID, schedule.Amount, runPut)
+	}
+
+	switch {
+	case err == nil, errors.Is(err, repository.ErrTransferConflict):
+		// A conflict means this occurrence already ran but its bookkeeping was
+		// never saved, so it is treated the same as a fresh success.
+		schedule.RunCount++
+		schedule.LastError = ""
+		advanceSchedule(&schedule, true)
+	case errors.Is(err, repository.ErrInsufficientBalance), errors.Is(err, repository.ErrAccountNotFound), errors.Is(err, ErrRiskDeclined):
+		if recErr := recordFailedRun(ctx, schedule, attempt, now, err); recErr != nil {
+			return recErr
+		}
+		schedule.LastError = err.Error()
+		schedule.FailureCount++
+
+		switch {
+		case errors.Is(err, repository.ErrAccountNotFound):
+			// An account that no longer exists will not come back.
+			schedule.Status = repository.ScheduleStatusFailed
+		case errors.Is(err, ErrRiskDeclined), schedule.FailureCount > cfg.MaxRetries:
+			advanceSchedule(&schedule, false)
+		default:
+			schedule.NextRunAt = now.Add(cfg.RetryDelay).UTC().Truncate(time.Second)
+		}
+	default:
+		// Transient errors, ErrTransferInterrupted included, leave the
+		// schedule untouched so the next tick retries.
+		return err
+	}
+
+	return repository.SaveScheduledTransferProgress(ctx, schedule, occurrence)
+}
+
+// screenScheduledTransfer runs the risk checks on the schedule's current
+// occurrence, parking it for review when they call for it. An occurrence that
+// was already parked by an earlier tick is reported as under review again
+// without a second assessment.
+func screenScheduledTransfer(ctx context.Context, schedule repository.ScheduledTransfer, now time.Time) (reviewID, decision string, err error) {
+	reviewID = "review_" + schedule.ID + "_" + strconv.Itoa(schedule.Occurrence)
+	if _, err := repository.GetReviewItemByID(ctx, reviewID); err == nil {
+		return reviewID, RiskReview, nil
+	} else if !errors.Is(err, repository.ErrReviewNotFound) {
+		return "", "", err
+	}
+
+	assessment, err := AssessRisk(ctx, RiskOperation{
+		Kind:        RiskKindTransfer,
+		UserID:      schedule.UserID,
+		AccountID:   schedule.FromAccountID,
+		ToAccountID: schedule.ToAccountID,
+		Amount:      schedule.Amount,
+		Now:         now,
+	})
+	if err != nil || assessment.Decision != RiskReview {
+		return "", assessment.Decision, err
+	}
+
+	from, err := repository.GetAccountByID(ctx, schedule.FromAccountID)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = QueueForReview(ctx, repository.ReviewItem{
+		ID:          reviewID,
+		Kind:        repository.ReviewKindTransfer,
+		UserID:      schedule.UserID,
+		AccountID:   schedule.FromAccountID,
+		ToAccountID: schedule.ToAccountID,
+		Amount:      schedule.Amount,
+	}, from, assessment)
+	if err != nil && !errors.Is(err, repository.ErrReviewExists) {
+		return "", "", err
+	}
+	return reviewID, RiskReview, nil
+}
+
+// recordReviewedRun records that the occurrence was handed to the review
+// queue. Like a failed run, it may already have been recorded by an earlier
+// tick.
+func recordReviewedRun(ctx context.Context, schedule repository.ScheduledTransfer, attempt int, reviewID string, now time.Time) error {
+	err := repository.CreateScheduleRun(ctx, repository.ScheduleRun{
+		ID:         repository.ScheduleRunID(schedule.ID, schedule.Occurrence),
+		ScheduleID: schedule.ID,
+		Occurrence: schedule.Occurrence,
+		Attempt:    attempt,
+		Status:     repository.ReviewStatusPending,
+		ReviewID:   reviewID,
+		Amount:     schedule.Amount,
+		ExecutedAt: now,
+	})
+	if errors.Is(err, repository.ErrScheduleRunExists) {
+		return nil
+	}
+	return err
+}
+
+// recordFailedRun records a failed attempt. The attempt may already have been
+// recorded by a tick that then failed to save the schedule's progress, in
+// which case the existing record stands.
+func recordFailedRun(ctx context.Context, schedule repository.ScheduledTransfer, attempt int, now time.Time, cause error) error {
+	err := repository.CreateScheduleRun(ctx, repository.ScheduleRun{
+		ID:         repository.ScheduleRunID(schedule.ID, schedule.Occurrence) + "#attempt-" + strconv.Itoa(attempt),
+		ScheduleID: schedule.ID,
+		Occurrence: schedule.Occurrence,
+		Attempt:    attempt,
+		Status:     "failed",
+		Error:      cause.Error(),
+		Amount:     schedule.Amount,
+		ExecutedAt: now,
+	})
+	if errors.Is(err, repository.ErrScheduleRunExists) {
+		return nil
+	}
+	return err
+}
+
+// advanceSchedule moves to the next occurrence, or finishes the schedule when
+// none remain. A schedule whose final occurrence failed ends up failed.
+func advanceSchedule(schedule *repository.ScheduledTransfer, succeeded bool) {
+	schedule.Occurrence++
+	schedule.FailureCount = 0
+
+	if HasOccurrence(*schedule, schedule.Occurrence) {
+		schedule.NextRunAt = OccurrenceTime(schedule.StartAt, schedule.Frequency, schedule.Occurrence)
+		return
+	}
+
+	if succeeded {
+		schedule.Status = repository.ScheduleStatusCompleted
+	} else {
+		schedule.Status = repository.ScheduleStatusFailed
+	}
+}
+
+// HasOccurrence reports whether the nth occurrence falls within the schedule's
+// end date and occurrence count.
+func HasOccurrence(schedule repository.ScheduledTransfer, n int) bool {
+	if schedule.Frequency == repository.FrequencyOnce {
+		return n == 0
+	}
+	if schedule.MaxOccurrences > 0 && n >= schedule.MaxOccurrences {
+		return false
+	}
+	if !schedule.EndAt.IsZero() && OccurrenceTime(schedule.StartAt, schedule.Frequency, n).After(schedule.EndAt) {
+		return false
+	}
+	return true
+}
+
+// OccurrenceTime returns the nominal time of the nth occurrence. Monthly
+// schedules keep their day of month, clamped to the last day of shorter months.
+func OccurrenceTime(start time.Time, frequency string, n int) time.Time {
+	start = start.UTC().Truncate(time.Second)
+
+	switch frequency {
+	case repository.FrequencyDaily:
+		return start.AddDate(0, 0, n)
+	case repository.FrequencyWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case repository.FrequencyMonthly:
+		firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(n), 1, start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+		lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+		day := start.Day()
+		if day > lastDay {
+			day = lastDay
+		}
+		return firstOfMonth.AddDate(0, 0, day-1)
+	default:
+		return start
+	}
+}
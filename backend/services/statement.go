@@ -0,0 +1,391 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+	"banking-ecommerce-api/utils"
+)
+
+// StatementLine is one transaction on a statement, with the balance after it.
+// Purchases also carry the tax included in their amount and its rate.
+type StatementLine struct {
+	ID          string    `json:"id"`
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Amount      int64     `json:"amount"`
+	Balance     int64     `json:"balance"`
+	Tax         int64     `json:"tax,omitempty"`
+	TaxRate     int64     `json:"tax_rate_bp,omitempty"`
+}
+
+// Statement lists an account's transactions from PeriodStart up to but not
+// including PeriodEnd, oldest first, with the balances either side and the
+// net amount of each transaction type. TaxTotal is the tax paid on the
+// period's purchases. All times are UTC.
+type Statement struct {
+	AccountID      string           `json:"account_id"`
+	AccountName    string           `json:"account_name"`
+	AccountType    string           `json:"account_type"`
+	Currency       string           `json:"currency"`
+	PeriodStart    time.Time        `json:"period_start"`
+	PeriodEnd      time.Time        `json:"period_end"`
+	OpeningBalance int64            `json:"opening_balance"`
+	ClosingBalance int64            `json:"closing_balance"`
+	GeneratedAt    time.Time        `json:"generated_at"`
+	Totals         map[string]int64 `json:"totals"`
+	TaxTotal       int64            `json:"tax_total"`
+	Lines          []StatementLine  `json:"transactions"`
+}
+
+// BuildStatement assembles the account's statement for [from, to). Balances
+// are worked back from the current balance through the recorded
+// transactions, so movements made before they were recorded are not shown.
+// Issued statements are built from a fixed opening balance instead, see
+// IssueStatement.
+func BuildStatement(ctx context.Context, account repository.Account, from, to time.Time) (Statement, error) {
+	transactions, err := accountTransactions(ctx, account.ID)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	opening := account.Balance
+	for _, txn := range transactions {
+		if !txn.CreatedAt.Before(from) {
+			opening -= txn.SignedAmount()
+		}
+	}
+
+	return newStatement(account, transactions, from, to, opening), nil
+}
+
+// accountTransactions lists the account's transactions oldest first, ties
+// broken by ID so statements list them in a stable order.
+func accountTransactions(ctx context.Context, accountID string) ([]repository.Transaction, error) {
+	transactions, err := repository.GetTransactionsByAccountID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(transactions, func(a, b repository.Transaction) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return transactions, nil
+}
+
+// newStatement lists the sorted transactions in [from, to) running forward
+// from the opening balance, which also gives the closing balance.
+func newStatement(account repository.Account, transactions []repository.Transaction, from, to time.Time, opening int64) Statement {
+	statement := Statement{
+		AccountID:      account.ID,
+		AccountName:    account.AccountName,
+		AccountType:    account.Type(),
+		Currency:       config.GetStatementConfig().Currency,
+		PeriodStart:    from.UTC(),
+		PeriodEnd:      to.UTC(),
+		OpeningBalance: opening,
+		GeneratedAt:    time.Now().UTC().Truncate(time.Second),
+		Totals:         map[string]int64{},
+		Lines:          []StatementLine{},
+	}
+
+	balance := opening
+	for _, txn := range transactions {
+		if txn.CreatedAt.Before(from) || !txn.CreatedAt.Before(to) {
+			continue
+		}
+
+		balance += txn.SignedAmount()
+		statement.Totals[txn.TransactionType] += txn.SignedAmount()
+		statement.TaxTotal += txn.TaxBreakdown.Tax
+		statement.Lines = append(statement.Lines, StatementLine{
+			ID:          txn.ID,
+			Date:        txn.CreatedAt.UTC(),
+			Type:        txn.TransactionType,
+			Description: statementDescription(txn),
+			Amount:      txn.SignedAmount(),
+			Balance:     balance,
+			Tax:         txn.TaxBreakdown.Tax,
+			TaxRate:     txn.TaxBreakdown.Rate,
+		})
+	}
+	statement.ClosingBalance = balance
+
+	return statement
+}
+
+func statementDescription(txn repository.Transaction) string {
+	switch txn.TransactionType {
+	case "transfer":
+		if txn.Direction == "credit" {
+			return "Transfer from " + txn.Counterparty
+		}
+		return "Transfer to " + txn.Counterparty
+	case "purchase":
+		if txn.ProductName != "" {
+			return fmt.Sprintf("Purchase of %d x %s", txn.Quantity, txn.ProductName)
+		}
+		return fmt.Sprintf("Purchase of %d x %s", txn.Quantity, txn.ProductID)
+	case "deposit":
+		return "Deposit"
+	case "withdrawal":
+		return "Withdrawal"
+	case "interest":
+		return "Interest"
+	case "overdraft_interest":
+		return "Overdraft interest"
+	case "overdraft_fee":
+		return "Overdraft fee"
+	case "capture":
+		switch {
+		case txn.Counterparty == "":
+			return "Hold capture"
+		case txn.Direction == "credit":
+			return "Hold capture from " + txn.Counterparty
+		default:
+			return "Hold capture to " + txn.Counterparty
+		}
+	case "adjustment":
+		return "Adjustment"
+	default:
+		return txn.TransactionType
+	}
+}
+
+// formatMinorUnits renders an amount in minor units as a decimal, e.g. -1234
+// as "-12.34".
+func formatMinorUnits(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// WriteStatementCSV writes the statement as CSV with decimal amounts, framed
+// by opening and closing balance rows. The tax column is filled in for
+// purchases that were taxed.
+func WriteStatementCSV(w io.Writer, statement Statement) error {
+	writer := csv.NewWriter(w)
+
+	rows := [][]string{
+		{"date", "id", "type", "description", "amount", "balance", "tax"},
+		{statement.PeriodStart.Format(time.RFC3339), "", "opening_balance", "Opening balance", "", formatMinorUnits(statement.OpeningBalance), ""},
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+
+	for _, line := range statement.Lines {
+		tax := ""
+		if line.Tax != 0 {
+			tax = formatMinorUnits(line.Tax)
+		}
+
+		err := writer.Write([]string{
+			line.Date.Format(time.RFC3339),
+			line.ID,
+			line.Type,
+			line.Description,
+			formatMinorUnits(line.Amount),
+			formatMinorUnits(line.Balance),
+			tax,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.WriteAll([][]string{
+		{statement.PeriodEnd.Format(time.RFC3339), "", "closing_balance", "Closing balance", "", formatMinorUnits(statement.ClosingBalance), ""},
+	})
+}
+
+// WriteStatementJSON writes the statement as JSON, one transaction at a time
+// so large statements are not built in memory twice.
+func WriteStatementJSON(w io.Writer, statement Statement) error {
+	lines := statement.Lines
+	statement.Lines = nil
+
+	head, err := json.Marshal(statement)
+	if err != nil {
+		return err
+	}
+
+	// Transactions is the last field, so the marshalled object ends in
+	// "null}"; open the array there instead.
+	head = append(bytes.TrimSuffix(head, []byte("null}")), '[')
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+
+	for i, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// ofxTime formats a time as an OFX datetime in GMT.
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+func ofxTransactionType(line StatementLine) string {
+	switch line.Type {
+	case "transfer":
+		return "XFER"
+	case "purchase":
+		return "POS"
+	case "deposit":
+		return "DEP"
+	case "interest", "overdraft_interest":
+		return "INT"
+	case "overdraft_fee":
+		return "FEE"
+	}
+	if line.Amount >= 0 {
+		return "CREDIT"
+	}
+	return "DEBIT"
+}
+
+// ofxText escapes s for an OFX element, cut to max characters.
+func ofxText(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		s = string(runes[:max])
+	}
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// ofxAccountID fits an account ID into OFX's 22 characters by dropping its
+// prefix, leaving the unique numeric part.
+func ofxAccountID(id string) string {
+	if len(id) > 22 {
+		id = id[strings.LastIndex(id, "_")+1:]
+	}
+	return id
+}
+
+// WriteStatementOFX writes the statement as an OFX 2.2 bank statement
+// response.
+func WriteStatementOFX(w io.Writer, statement Statement) error {
+	cfg := config.GetStatementConfig()
+
+	accountType := "CHECKING"
+	if statement.AccountType == repository.AccountTypeSavings {
+		accountType = "SAVINGS"
+	}
+
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<DTSERVER>%s</DTSERVER>
+<LANGUAGE>ENG</LANGUAGE>
+</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>%s</TRNUID>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS>
+<CURDEF>%s</CURDEF>
+<BANKACCTFROM>
+<BANKID>%s</BANKID>
+<ACCTID>%s</ACCTID>
+<ACCTTYPE>%s</ACCTTYPE>
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>%s</DTSTART>
+<DTEND>%s</DTEND>
+`,
+		ofxTime(statement.GeneratedAt),
+		utils.GenerateID("stmt"),
+		ofxText(statement.Currency, 3),
+		ofxText(cfg.BankID, 9),
+		ofxText(ofxAccountID(statement.AccountID), 22),
+		accountType,
+		ofxTime(statement.PeriodStart),
+		ofxTime(statement.PeriodEnd),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range statement.Lines {
+		_, err := fmt.Fprintf(w, "<STMTTRN>\n<TRNTYPE>%s</TRNTYPE>\n<DTPOSTED>%s</DTPOSTED>\n<TRNAMT>%s</TRNAMT>\n<FITID>%s</FITID>\n<NAME>%s</NAME>\n<MEMO>%s</MEMO>\n</STMTTRN>\n",
+			ofxTransactionType(line),
+			ofxTime(line.Date),
+			formatMinorUnits(line.Amount),
+			ofxText(line.ID, 255),
+			ofxText(line.Description, 32),
+			ofxText(line.Description, 255),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, `</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>%s</BALAMT>
+<DTASOF>%s</DTASOF>
+</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`,
+		formatMinorUnits(statement.ClosingBalance),
+		ofxTime(statement.PeriodEnd),
+	)
+	return err
+}
+
+// ParseStatementDate reads a statement bound given as 2006-01-02 or RFC 3339.
+// A bare date means the start of that day in UTC, or the start of the next
+// day when it is the inclusive end of a range.
+func ParseStatementDate(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+)
+
+var (
+	ErrUnknownStatementStore       = errors.New("unknown statement store")
+	ErrStatementStoreNotConfigured = errors.New("statement store not configured")
+	// ErrStatementCorrupt means a stored statement no longer matches its
+	// checksum.
+	ErrStatementCorrupt = errors.New("statement does not match its checksum")
+)
+
+// statementStore keeps issued statement documents. It is separate from the
+// media store, whose blobs are served to anyone.
+var statementStore BlobStore
+
+// ConfigureStatementStore selects the blob store that issued statement
+// documents are kept in.
+func ConfigureStatementStore(cfg config.StatementConfig) error {
+	switch cfg.Store {
+	case "local":
+		statementStore = &LocalBlobStore{Dir: cfg.LocalDir}
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return errors.New("s3 statement store needs STATEMENT_S3_ENDPOINT and STATEMENT_S3_BUCKET")
+		}
+		statementStore = newS3BlobStore(cfg.S3Endpoint, cfg.S3Bucket, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownStatementStore, cfg.Store)
+	}
+	return nil
+}
+
+// StartStatementIssuing issues last month's statements in the background until
+// the context is cancelled. Each run only fills in statements that are missing,
+// so it is safe to run as often as the interval says.
+func StartStatementIssuing(ctx context.Context, cfg config.StatementConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			now := time.Now().UTC()
+			previous := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+			if _, failed, err := IssueStatements(ctx, previous); err != nil {
+				log.Printf("statements: %v", err)
+			} else if failed > 0 {
+				log.Printf("statements: %d statements for %s could not be issued", failed, previous.Format(monthLayout))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// IssueStatements issues the statement for the calendar month containing month
+// to every account opened before that month ended, and returns how many were
+// issued and how many failed, each failure being logged. Accounts that
+// already have one are skipped.
+func IssueStatements(ctx context.Context, month time.Time) (int, int, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	accounts, err := repository.GetAllAccounts(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	issued, failed := 0, 0
+	for _, account := range accounts {
+		if !account.CreatedAt.Before(end) {
+			continue
+		}
+
+		exists, err := repository.IssuedStatementExists(ctx, account.ID, start.Format(monthLayout))
+		if err != nil {
+			log.Printf("statements: account %s: %v", account.ID, err)
+			failed++
+			continue
+		}
+		if exists {
+			continue
+		}
+
+		_, err = IssueStatement(ctx, account, start)
+		switch {
+		case err == nil:
+			issued++
+		case errors.Is(err, repository.ErrStatementExists):
+		default:
+			log.Printf("statements: account %s: %v", account.ID, err)
+			failed++
+		}
+	}
+
+	return issued, failed, nil
+}
+
+// IssueStatement builds and stores the account's statement for the month
+// starting at start. Its opening balance is the previous issued statement's
+// closing balance, or for the first one the account's transactions before
+// start, so issued figures never depend on the live balance. The document is
+// written to the statement store before the statement is recorded, under a
+// key naming its checksum, so a statement never points at a document that is
+// missing or belongs to a concurrent attempt. It returns
+// repository.ErrStatementExists if that month was already issued.
+func IssueStatement(ctx context.Context, account repository.Account, start time.Time) (repository.IssuedStatement, error) {
+	if statementStore == nil {
+		return repository.IssuedStatement{}, ErrStatementStoreNotConfigured
+	}
+
+	transactions, err := accountTransactions(ctx, account.ID)
+	if err != nil {
+		return repository.IssuedStatement{}, err
+	}
+
+	opening, err := issuedOpeningBalance(ctx, account.ID, start, transactions)
+	if err != nil {
+		return repository.IssuedStatement{}, err
+	}
+	statement := newStatement(account, transactions, start, start.AddDate(0, 1, 0), opening)
+
+	var document bytes.Buffer
+	if err := WriteStatementJSON(&document, statement); err != nil {
+		return repository.IssuedStatement{}, err
+	}
+	checksum := sha256.Sum256(document.Bytes())
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(document.Bytes()); err != nil {
+		return repository.IssuedStatement{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return repository.IssuedStatement{}, err
+	}
+
+	id := repository.IssuedStatementID(account.ID, start.Format(monthLayout))
+	sum := hex.EncodeToString(checksum[:])
+	key := "statements/" + id + "/" + sum + ".json.gz"
+	if err := statementStore.Put(ctx, key, "application/gzip", compressed.Bytes()); err != nil {
+		return repository.IssuedStatement{}, fmt.Errorf("store statement document: %w", err)
+	}
+
+	issued := repository.IssuedStatement{
+		ID:             id,
+		AccountID:      account.ID,
+		UserID:         account.UserID,
+		Month:          start.Format(monthLayout),
+		PeriodStart:    statement.PeriodStart,
+		PeriodEnd:      statement.PeriodEnd,
+		OpeningBalance: statement.OpeningBalance,
+		ClosingBalance: statement.ClosingBalance,
+		Totals:         statement.Totals,
+		TaxTotal:       statement.TaxTotal,
+		LineCount:      len(statement.Lines),
+		Checksum:       sum,
+		DocumentKey:    key,
+		IssuedAt:       statement.GeneratedAt,
+	}
+
+	if err := repository.CreateIssuedStatement(ctx, issued); err != nil {
+		if deleteErr := statementStore.Delete(ctx, key); deleteErr != nil {
+			log.Printf("statements: removing unrecorded document %s: %v", key, deleteErr)
+		}
+		return repository.IssuedStatement{}, err
+	}
+
+	return issued, nil
+}
+
+// issuedOpeningBalance is the balance an issued statement for the month
+// starting at start opens with: the closing balance of the month before's,
+// or without one the sum of the account's transactions before start, as
+// accounts open empty.
+func issuedOpeningBalance(ctx context.Context, accountID string, start time.Time, transactions []repository.Transaction) (int64, error) {
+	previous, err := repository.GetIssuedStatement(ctx, accountID, start.AddDate(0, -1, 0).Format(monthLayout))
+	if err == nil {
+		return previous.ClosingBalance, nil
+	}
+	if !errors.Is(err, repository.ErrStatementNotFound) {
+		return 0, err
+	}
+
+	var opening int64
+	for _, txn := range transactions {
+		if txn.CreatedAt.Before(start) {
+			opening += txn.SignedAmount()
+		}
+	}
+	return opening, nil
+}
+
+// OpenIssuedStatement reads an issued statement's JSON document, from the
+// statement store or, for statements issued before documents moved there,
+// from the record itself, and verifies it against the stored checksum.
+func OpenIssuedStatement(ctx context.Context, issued repository.IssuedStatement) ([]byte, Statement, error) {
+	compressed := issued.Document
+	if issued.DocumentKey != "" {
+		if statementStore == nil {
+			return nil, Statement{}, ErrStatementStoreNotConfigured
+		}
+		blob, err := statementStore.Get(ctx, issued.DocumentKey)
+		if err != nil {
+			return nil, Statement{}, err
+		}
+		compressed, err = io.ReadAll(blob)
+		blob.Close()
+		if err != nil {
+			return nil, Statement{}, err
+		}
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, Statement{}, err
+	}
+	document, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, Statement{}, err
+	}
+
+	checksum := sha256.Sum256(document)
+	if hex.EncodeToString(checksum[:]) != issued.Checksum {
+		return nil, Statement{}, ErrStatementCorrupt
+	}
+
+	var statement Statement
+	if err := json.Unmarshal(document, &statement); err != nil {
+		return nil, Statement{}, err
+	}
+
+	return document, statement, nil
+}
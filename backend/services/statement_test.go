@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"banking-ecommerce-api/repository"
+)
+
+func TestOFXText(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{s: "Rent", max: 32, want: "Rent"},
+		{s: "Transfer to savings", max: 8, want: "Transfer"},
+		// Multi-byte characters count once and are never split.
+		{s: "Ödeme ğüşıöç", max: 7, want: "Ödeme ğ"},
+		{s: "çççç", max: 3, want: "ççç"},
+		{s: "A&B <Ltd>", max: 32, want: "A&amp;B &lt;Ltd&gt;"},
+	}
+
+	for _, tt := range tests {
+		if got := ofxText(tt.s, tt.max); got != tt.want {
+			t.Errorf("ofxText(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestNewStatement(t *testing.T) {
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	transactions := []repository.Transaction{
+		{ID: "a", TransactionType: "deposit", TotalAmount: 5000, CreatedAt: from.Add(-time.Hour)},
+		{ID: "b", TransactionType: "deposit", TotalAmount: 2000, CreatedAt: from},
+		{ID: "c", TransactionType: "withdrawal", TotalAmount: 500, CreatedAt: to.Add(-time.Second)},
+		{ID: "d", TransactionType: "deposit", TotalAmount: 9000, CreatedAt: to},
+	}
+
+	tests := []struct {
+		name        string
+		opening     int64
+		wantClosing int64
+		wantLines   []int64
+	}{
+		{name: "carried forward", opening: 5000, wantClosing: 6500, wantLines: []int64{7000, 6500}},
+		// The opening balance is taken as given, not checked against the
+		// transactions before the period.
+		{name: "overdrawn", opening: -1000, wantClosing: 500, wantLines: []int64{1000, 500}},
+	}
+
+	for _, tt := range tests {
+		statement := newStatement(repository.Account{ID: "acc"}, transactions, from, to, tt.opening)
+		if statement.OpeningBalance != tt.opening || statement.ClosingBalance != tt.wantClosing {
+			t.Errorf("%s: balances = %d, %d, want %d, %d", tt.name, statement.OpeningBalance, statement.ClosingBalance, tt.opening, tt.wantClosing)
+		}
+		if len(statement.Lines) != len(tt.wantLines) {
+			t.Fatalf("%s: %d lines, want %d", tt.name, len(statement.Lines), len(tt.wantLines))
+		}
+		for i, line := range statement.Lines {
+			if line.Balance != tt.wantLines[i] {
+				t.Errorf("%s: line %d balance = %d, want %d", tt.name, i, line.Balance, tt.wantLines[i])
+			}
+		}
+		if got := statement.Totals["deposit"]; got != 2000 {
+			t.Errorf("%s: deposit total = %d, want 2000", tt.name, got)
+		}
+	}
+}
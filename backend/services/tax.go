@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"banking-ecommerce-api/config"
+	"banking-ecommerce-api/repository"
+)
+
+var (
+	ErrInvalidTaxConfig = errors.New("invalid tax configuration")
+	ErrNoTaxRate        = errors.New("no tax rate for product")
+)
+
+// taxTable holds the configured rates by jurisdiction, then tax class.
+type taxTable struct {
+	defaultJurisdiction string
+	defaultClass        string
+	rates               map[string]map[string]int64
+}
+
+var taxRates taxTable
+
+// ConfigureTaxRates installs the rate table of cfg. Jurisdictions are matched
+// in upper case and classes in lower case, and both defaults must have a rate.
+func ConfigureTaxRates(cfg config.TaxConfig) error {
+	table := taxTable{
+		defaultJurisdiction: NormalizeTaxJurisdiction(cfg.DefaultJurisdiction),
+		defaultClass:        NormalizeTaxClass(cfg.DefaultClass),
+		rates:               map[string]map[string]int64{},
+	}
+
+	for _, rate := range cfg.Rates {
+		jurisdiction, class := NormalizeTaxJurisdiction(rate.Jurisdiction), NormalizeTaxClass(rate.Class)
+		if jurisdiction == "" || class == "" {
+			return fmt.Errorf("%w: rates need a jurisdiction and a class", ErrInvalidTaxConfig)
+		}
+		if rate.Rate < 0 || rate.Rate > 10000 {
+			return fmt.Errorf("%w: rate for %s/%s must be 0-10000 basis points", ErrInvalidTaxConfig, jurisdiction, class)
+		}
+
+		if table.rates[jurisdiction] == nil {
+			table.rates[jurisdiction] = map[string]int64{}
+		}
+		if _, ok := table.rates[jurisdiction][class]; ok {
+			return fmt.Errorf("%w: duplicate rate for %s/%s", ErrInvalidTaxConfig, jurisdiction, class)
+		}
+		table.rates[jurisdiction][class] = rate.Rate
+	}
+
+	if _, ok := table.rates[table.defaultJurisdiction][table.defaultClass]; !ok {
+		return fmt.Errorf("%w: no rate for default %s/%s", ErrInvalidTaxConfig, table.defaultJurisdiction, table.defaultClass)
+	}
+
+	taxRates = table
+	return nil
+}
+
+// NormalizeTaxJurisdiction puts a jurisdiction code in the form rates are
+// keyed by.
+func NormalizeTaxJurisdiction(jurisdiction string) string {
+	return strings.ToUpper(strings.TrimSpace(jurisdiction))
+}
+
+// NormalizeTaxClass puts a tax class in the form rates are keyed by.
+func NormalizeTaxClass(class string) string {
+	return strings.ToLower(strings.TrimSpace(class))
+}
+
+// IsTaxJurisdiction reports whether jurisdiction has any configured rates.
+func IsTaxJurisdiction(jurisdiction string) bool {
+	return taxRates.rates[NormalizeTaxJurisdiction(jurisdiction)] != nil
+}
+
+// IsTaxClass reports whether class has a rate in any jurisdiction.
+func IsTaxClass(class string) bool {
+	class = NormalizeTaxClass(class)
+	for _, classes := range taxRates.rates {
+		if _, ok := classes[class]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TaxRateFor is the rate user pays on product: that of the product's tax
+// class in the user's jurisdiction, with the configured defaults standing in
+// for either when unset. It fails with ErrNoTaxRate when the jurisdiction has
+// no rate for the class.
+func TaxRateFor(user repository.User, product repository.Product) (repository.TaxRate, error) {
+	jurisdiction := user.TaxJurisdiction
+	if jurisdiction == "" {
+		jurisdiction = taxRates.defaultJurisdiction
+	}
+	class := product.TaxClass
+	if class == "" {
+		class = taxRates.defaultClass
+	}
+
+	rate, ok := taxRates.rates[jurisdiction][class]
+	if !ok {
+		return repository.TaxRate{}, fmt.Errorf("%w: %s/%s", ErrNoTaxRate, jurisdiction, class)
+	}
+
+	return repository.TaxRate{Jurisdiction: jurisdiction, Class: class, Rate: rate}, nil
+}
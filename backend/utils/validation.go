@@ -39,3 +39,7 @@ func VerifyPassword(password, hashedPassword string) bool {
 func GenerateUserID() string {
 	return "user_" + strconv.FormatInt(time.Now().UnixNano(), 10)
 }
+
+func GenerateID(prefix string) string {
+	return prefix + "_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
@@ -13,6 +13,7 @@ const AccountDetail = () => {
   const [error, setError] = useState('')
   const [showDepositModal, setShowDepositModal] = useState(false)
   const [depositAmount, setDepositAmount] = useState('')
+  const [depositSource, setDepositSource] = useState('')
   const [isDepositing, setIsDepositing] = useState(false)
   const [cardGradient, setCardGradient] = useState('')
 
@@ -60,7 +61,7 @@ const AccountDetail = () => {
 
   const handleDeposit = async (e: React.FormEvent) => {
     e.preventDefault()
-    if (!depositAmount.trim() || !account) return
+    if (!depositAmount.trim() || !depositSource.trim() || !account) return
 
     const amountInTRY = parseFloat(depositAmount)
     if (amountInTRY <= 0) {
@@ -74,12 +75,14 @@ const AccountDetail = () => {
       setIsDepositing(true)
       const response = await depositMoney({
         account_id: account.id,
-        amount: amountInCents
+        amount: amountInCents,
+        source: depositSource.trim()
       })
       
       if (response.ok) {
         setShowDepositModal(false)
         setDepositAmount('')
+        setDepositSource('')
         fetchAccount() // Refresh account data
       } else {
         const data = await response.json()
@@ -241,6 +244,22 @@ const AccountDetail = () => {
                   style={{ fontFamily: 'Inter, sans-serif' }}
                 />
               </div>
+
+              <div>
+                <label className="block text-white/80 text-sm mb-2" style={{ fontFamily: 'Inter, sans-serif' }}>
+                  Funding Source
+                </label>
+                <input
+                  type="text"
+                  value={depositSource}
+                  onChange={(e) => setDepositSource(e.target.value)}
+                  placeholder="External account to pull from"
+                  required
+                  maxLength={64}
+                  className="w-full px-4 py-3 bg-transparent border border-gray-600 rounded-xl text-white placeholder-gray-400 focus:ring-2 focus:ring-blue-500 focus:border-transparent transition-all"
+                  style={{ fontFamily: 'Inter, sans-serif' }}
+                />
+              </div>
               
               <div className="flex gap-3 pt-4">
                 <button
@@ -253,7 +272,7 @@ const AccountDetail = () => {
                 </button>
                 <button
                   type="submit"
-                  disabled={isDepositing || !depositAmount.trim()}
+                  disabled={isDepositing || !depositAmount.trim() || !depositSource.trim()}
                   className="flex-1 py-3 px-4 bg-green-600 text-white rounded-xl hover:bg-green-700 disabled:bg-gray-600 disabled:cursor-not-allowed transition-all duration-300 font-semibold"
                   style={{ fontFamily: 'Inter, sans-serif' }}
                 >
@@ -1,10 +1,11 @@
 import React, { useState, useEffect } from 'react'
 import Layout from '../components/Layout'
-import { getProducts, createProduct, type Product, type CreateProductRequest } from '../services/productService'
+import { getProducts, createProduct, uploadProductImage, type Product, type ProductVariant, type CreateProductRequest } from '../services/productService'
 import { getAccounts, type Account } from '../services/accountService'
 import { purchaseProduct } from '../services/purchaseService'
 import { getProfile } from '../services/authService'
-import { ShoppingCart, Package, Star, CreditCard, X, CheckCircle, AlertCircle, Plus } from 'lucide-react'
+import { mediaURL } from '../services/api'
+import { ShoppingCart, Package, Star, CreditCard, X, CheckCircle, AlertCircle, Plus, ImagePlus } from 'lucide-react'
 
 const Products = () => {
   const [products, setProducts] = useState<Product[]>([])
@@ -12,13 +13,18 @@ const Products = () => {
   const [loading, setLoading] = useState(true)
   const [error, setError] = useState('')
   const [isAdmin, setIsAdmin] = useState(false)
+  const [uploadingImageFor, setUploadingImageFor] = useState<string | null>(null)
+  const [imageError, setImageError] = useState('')
+  const [sortByRating, setSortByRating] = useState(false)
   
   // Purchase modal states
   const [showPurchaseModal, setShowPurchaseModal] = useState(false)
   const [selectedProduct, setSelectedProduct] = useState<Product | null>(null)
   const [selectedAccount, setSelectedAccount] = useState<Account | null>(null)
+  const [selectedVariant, setSelectedVariant] = useState<ProductVariant | null>(null)
   const [quantity, setQuantity] = useState(1)
   const [quantityInput, setQuantityInput] = useState('')
+  const [promotionCode, setPromotionCode] = useState('')
   const [isPurchasing, setIsPurchasing] = useState(false)
   const [modalError, setModalError] = useState('')
   
@@ -41,12 +47,35 @@ const Products = () => {
     product: Product
     account: Account
     quantity: number
+    unitPrice: number
+    discount: number
+    taxAmount: number
     totalAmount: number
   } | null>(null)
 
   useEffect(() => {
     fetchData()
-  }, [])
+  }, [sortByRating])
+
+  const handleImageUpload = async (product: Product, file: File) => {
+    setUploadingImageFor(product.id)
+    setImageError('')
+    try {
+      const response = await uploadProductImage(product.id, file)
+      if (!response.ok) {
+        setImageError(await response.text() || 'Failed to upload image')
+        return
+      }
+      const image = await response.json()
+      setProducts(products.map(p =>
+        p.id === product.id ? { ...p, images: [...(p.images || []), image] } : p
+      ))
+    } catch (err) {
+      setImageError('Failed to upload image')
+    } finally {
+      setUploadingImageFor(null)
+    }
+  }
 
   const fetchData = async () => {
     try {
@@ -55,7 +84,7 @@ const Products = () => {
       // Profile, products ve accounts'ı paralel olarak fetch et
       const [profileResponse, productsResponse, accountsResponse] = await Promise.all([
         getProfile(),
-        getProducts(),
+        getProducts(sortByRating ? 'rating' : undefined),
         getAccounts()
       ])
       
@@ -85,6 +114,8 @@ const Products = () => {
 
   const openPurchaseModal = (product: Product) => {
     setSelectedProduct(product)
+    setSelectedVariant(null)
+    setPromotionCode('')
     setShowPurchaseModal(true)
     setQuantity(1)
     setQuantityInput('')
@@ -95,6 +126,7 @@ const Products = () => {
   const closePurchaseModal = () => {
     setShowPurchaseModal(false)
     setSelectedProduct(null)
+    setSelectedVariant(null)
     setSelectedAccount(null)
     setQuantity(1)
     setQuantityInput('')
@@ -182,6 +214,10 @@ const Products = () => {
     }
   }
 
+  // A selected variant's own price and stock take over from the product's
+  const unitPrice = selectedVariant?.price || selectedProduct?.price || 0
+  const availableStock = selectedVariant ? selectedVariant.available : selectedProduct?.available || 0
+
   const handlePurchase = async () => {
     const qty = parseInt(quantityInput) || 1
     
@@ -190,13 +226,20 @@ const Products = () => {
       return
     }
 
-    if (qty > selectedProduct.stock) {
+    if (selectedProduct.variants?.length && !selectedVariant) {
+      setModalError('Please select an option')
+      return
+    }
+
+    if (qty > availableStock) {
       setModalError('Not enough stock available')
       return
     }
 
-    const totalAmount = selectedProduct.price * qty
-    if (selectedAccount.balance < totalAmount) {
+    // Promotions can only lower the price, so the list price is checked here
+    // only when no code was entered; the server has the final say.
+    const totalAmount = unitPrice * qty
+    if (!promotionCode.trim() && selectedAccount.balance < totalAmount) {
       setModalError('Insufficient balance')
       return
     }
@@ -208,16 +251,22 @@ const Products = () => {
       const response = await purchaseProduct({
         account_id: selectedAccount.id,
         product_id: selectedProduct.id,
-        quantity: qty
+        sku: selectedVariant?.sku,
+        quantity: qty,
+        promotion_code: promotionCode.trim() || undefined
       })
       
       if (response.ok) {
+        const data = await response.json()
         // Purchase başarılı - detayları kaydet
         setPurchaseDetails({
           product: selectedProduct,
           account: selectedAccount,
           quantity: qty,
-          totalAmount: totalAmount
+          unitPrice: unitPrice,
+          discount: data.transaction?.discount || 0,
+          taxAmount: data.transaction?.tax_amount || 0,
+          totalAmount: data.transaction?.total_amount ?? totalAmount
         })
         
         // Purchase modalini kapat ve success modalini aç
@@ -243,7 +292,16 @@ const Products = () => {
         <h1 className="text-2xl md:text-3xl font-bold text-white" style={{ fontFamily: 'Lyon Display, serif' }}>
           Shop Products
         </h1>
-        
+
+        <button
+          onClick={() => setSortByRating(!sortByRating)}
+          className={`ml-auto mr-3 flex items-center gap-1.5 px-3 py-2 rounded-xl border transition-all text-sm ${sortByRating ? 'border-yellow-400 text-yellow-400' : 'border-white/20 text-white/60 hover:text-white'}`}
+          style={{ fontFamily: 'Inter, sans-serif' }}
+        >
+          <Star size={14} />
+          Top rated
+        </button>
+
         {isAdmin && (
           <button
             onClick={openAddProductModal}
@@ -270,6 +328,11 @@ const Products = () => {
 
       {!loading && !error && (
         <div className="max-w-6xl">
+          {imageError && (
+            <div className="mb-6 p-4 bg-red-500/20 border border-red-500/30 rounded-xl">
+              <p className="text-red-400" style={{ fontFamily: 'Inter, sans-serif' }}>{imageError}</p>
+            </div>
+          )}
           {!products || products.length === 0 ? (
             <div className="text-center py-12">
               <div className="mx-auto w-16 h-16 bg-gray-700/50 rounded-full flex items-center justify-center mb-4">
@@ -289,6 +352,14 @@ const Products = () => {
                   key={product.id}
                   className="p-4 md:p-6 bg-gray-800/50 border border-white/10 rounded-xl hover:bg-gray-800/70 transition-all group"
                 >
+                  {product.images && product.images.length > 0 && (
+                    <img
+                      src={mediaURL(product.images[0].thumbnail_url)}
+                      alt={product.name}
+                      loading="lazy"
+                      className="w-full h-40 object-cover rounded-lg mb-4 bg-white"
+                    />
+                  )}
                   <div className="flex items-start gap-3 mb-4">
                     <div className="w-10 h-10 md:w-12 md:h-12 bg-blue-600/20 rounded-full flex items-center justify-center flex-shrink-0">
                       <Package size={18} className="text-blue-400 md:hidden" />
@@ -299,9 +370,35 @@ const Products = () => {
                         {product.name}
                       </h3>
                       <p className="text-white/60 text-xs md:text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
-                        Stock: {product.stock}
+                        Stock: {product.available}
                       </p>
+                      {product.rating_count > 0 && (
+                        <p className="flex items-center gap-1 text-yellow-400 text-xs md:text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
+                          <Star size={12} fill="currentColor" />
+                          {product.rating.toFixed(1)}
+                          <span className="text-white/40">({product.rating_count})</span>
+                        </p>
+                      )}
                     </div>
+                    {isAdmin && (
+                      <label
+                        className="text-white/60 hover:text-white cursor-pointer transition-colors"
+                        title="Upload image"
+                      >
+                        <ImagePlus size={18} className={uploadingImageFor === product.id ? 'animate-pulse' : ''} />
+                        <input
+                          type="file"
+                          accept="image/jpeg,image/png"
+                          className="hidden"
+                          disabled={uploadingImageFor !== null}
+                          onChange={(e) => {
+                            const file = e.target.files?.[0]
+                            e.target.value = ''
+                            if (file) handleImageUpload(product, file)
+                          }}
+                        />
+                      </label>
+                    )}
                   </div>
 
                   <p className="text-white/80 text-xs md:text-sm mb-4 md:mb-6 line-clamp-3" style={{ fontFamily: 'Inter, sans-serif' }}>
@@ -316,13 +413,13 @@ const Products = () => {
                     </div>
                     <button
                       onClick={() => openPurchaseModal(product)}
-                      disabled={product.stock <= 0}
+                      disabled={product.available <= 0}
                       className="flex items-center justify-center gap-1.5 px-3 py-1.5 bg-blue-600 text-white rounded-lg hover:bg-blue-700 disabled:bg-gray-600 disabled:cursor-not-allowed transition-all duration-300 font-medium text-xs sm:text-sm w-full sm:w-auto"
                       style={{ fontFamily: 'Inter, sans-serif' }}
                     >
                       <ShoppingCart size={14} />
                       <span className="truncate">
-                        {product.stock <= 0 ? 'Out of Stock' : 'Buy'}
+                        {product.available <= 0 ? 'Out of Stock' : 'Buy'}
                       </span>
                     </button>
                   </div>
@@ -369,17 +466,44 @@ const Products = () => {
                 <div className="flex justify-between items-center">
                   <span className="text-white/80" style={{ fontFamily: 'Inter, sans-serif' }}>Price:</span>
                   <span className="font-bold text-white" style={{ fontFamily: 'Lyon Display, serif' }}>
-                    {formatPrice(selectedProduct.price)}
+                    {formatPrice(unitPrice)}
                   </span>
                 </div>
                 <div className="flex justify-between items-center mt-2">
                   <span className="text-white/80" style={{ fontFamily: 'Inter, sans-serif' }}>Available:</span>
                   <span className="text-white/80" style={{ fontFamily: 'Inter, sans-serif' }}>
-                    {selectedProduct.stock} units
+                    {availableStock} units
                   </span>
                 </div>
               </div>
 
+              {/* Variant Selection */}
+              {selectedProduct.variants && selectedProduct.variants.length > 0 && (
+                <div className="mb-6">
+                  <h4 className="text-white font-semibold mb-3" style={{ fontFamily: 'Inter, sans-serif' }}>
+                    Select Option
+                  </h4>
+                  <div className="flex flex-wrap gap-2">
+                    {selectedProduct.variants.map((variant) => (
+                      <button
+                        key={variant.sku}
+                        type="button"
+                        disabled={variant.available <= 0}
+                        onClick={() => setSelectedVariant(variant)}
+                        className={`px-4 py-2 rounded-xl text-sm transition-all border disabled:opacity-40 disabled:cursor-not-allowed ${
+                          selectedVariant?.sku === variant.sku
+                            ? 'bg-blue-600/20 border-blue-500/50 text-white'
+                            : 'bg-gray-800/50 border-white/10 text-white/80 hover:bg-gray-800/70'
+                        }`}
+                        style={{ fontFamily: 'Inter, sans-serif' }}
+                      >
+                        {Object.values(variant.attributes).join(' / ') || variant.sku}
+                      </button>
+                    ))}
+                  </div>
+                </div>
+              )}
+
               {/* Account Selection */}
               <div className="mb-6">
                 <h4 className="text-white font-semibold mb-3" style={{ fontFamily: 'Inter, sans-serif' }}>
@@ -426,7 +550,22 @@ const Products = () => {
                   onChange={(e) => setQuantityInput(e.target.value)}
                   placeholder="1"
                   min="1"
-                  max={selectedProduct.stock}
+                  max={availableStock}
+                  className="w-full px-4 py-3 bg-transparent border border-gray-600 rounded-xl text-white placeholder-gray-400 focus:ring-2 focus:ring-blue-500 focus:border-transparent transition-all"
+                  style={{ fontFamily: 'Inter, sans-serif' }}
+                />
+              </div>
+
+              {/* Promotion Code */}
+              <div className="mb-6">
+                <label className="block text-white/80 text-sm mb-2" style={{ fontFamily: 'Inter, sans-serif' }}>
+                  Promotion Code
+                </label>
+                <input
+                  type="text"
+                  value={promotionCode}
+                  onChange={(e) => setPromotionCode(e.target.value.toUpperCase())}
+                  placeholder="Optional"
                   className="w-full px-4 py-3 bg-transparent border border-gray-600 rounded-xl text-white placeholder-gray-400 focus:ring-2 focus:ring-blue-500 focus:border-transparent transition-all"
                   style={{ fontFamily: 'Inter, sans-serif' }}
                 />
@@ -436,9 +575,9 @@ const Products = () => {
               {selectedAccount && (
                 <div className="mb-6 p-4 bg-gray-800/50 rounded-xl">
                   <div className="flex justify-between items-center">
-                    <span className="text-white/80" style={{ fontFamily: 'Inter, sans-serif' }}>Total:</span>
+                    <span className="text-white/80" style={{ fontFamily: 'Inter, sans-serif' }}>Subtotal (excl. tax):</span>
                     <span className="font-bold text-white text-lg" style={{ fontFamily: 'Lyon Display, serif' }}>
-                      {formatPrice(selectedProduct.price * (parseInt(quantityInput) || 1))}
+                      {formatPrice(unitPrice * (parseInt(quantityInput) || 1))}
                     </span>
                   </div>
                 </div>
@@ -514,10 +653,30 @@ const Products = () => {
                   <div className="flex justify-between items-center">
                     <span className="text-white/60" style={{ fontFamily: 'Inter, sans-serif' }}>Unit Price:</span>
                     <span className="text-white/80" style={{ fontFamily: 'Inter, sans-serif' }}>
-                      {formatPrice(purchaseDetails.product.price)}
+                      {formatPrice(purchaseDetails.unitPrice)}
                     </span>
                   </div>
                   
+                  {/* Discount */}
+                  {purchaseDetails.discount > 0 && (
+                    <div className="flex justify-between items-center">
+                      <span className="text-white/60" style={{ fontFamily: 'Inter, sans-serif' }}>Discount:</span>
+                      <span className="text-green-400" style={{ fontFamily: 'Inter, sans-serif' }}>
+                        −{formatPrice(purchaseDetails.discount)}
+                      </span>
+                    </div>
+                  )}
+                  
+                  {/* Tax */}
+                  {purchaseDetails.taxAmount > 0 && (
+                    <div className="flex justify-between items-center">
+                      <span className="text-white/60" style={{ fontFamily: 'Inter, sans-serif' }}>Tax:</span>
+                      <span className="text-white/80" style={{ fontFamily: 'Inter, sans-serif' }}>
+                        {formatPrice(purchaseDetails.taxAmount)}
+                      </span>
+                    </div>
+                  )}
+                  
                   {/* Total */}
                   <div className="flex justify-between items-center pt-2 border-t border-white/10">
                     <span className="text-white/60" style={{ fontFamily: 'Inter, sans-serif' }}>Total:</span>
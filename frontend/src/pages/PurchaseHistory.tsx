@@ -1,9 +1,9 @@
 import React, { useState, useEffect } from 'react'
 import Layout from '../components/Layout'
 import { getPurchaseHistory, type Transaction } from '../services/purchaseService'
-import { getProductById, type Product } from '../services/productService'
+import { getProductById, createProductReview, type Product } from '../services/productService'
 import { getAccounts } from '../services/accountService'
-import { ShoppingBag, Calendar, Package, CreditCard, ArrowRight } from 'lucide-react'
+import { ShoppingBag, Calendar, Package, CreditCard, ArrowRight, Star } from 'lucide-react'
 
 interface PurchaseWithDetails extends Transaction {
   product?: Product
@@ -15,11 +15,26 @@ const PurchaseHistory = () => {
   const [loading, setLoading] = useState(true)
   const [error, setError] = useState('')
   const [myAccounts, setMyAccounts] = useState<any[]>([])
+  // Review outcome per product: the stars given, or the reason it failed
+  const [reviewed, setReviewed] = useState<Record<string, number | string>>({})
 
   useEffect(() => {
     fetchAllData()
   }, [])
 
+  const handleReview = async (productId: string, rating: number) => {
+    try {
+      const response = await createProductReview(productId, rating, '')
+      if (response.ok) {
+        setReviewed({ ...reviewed, [productId]: rating })
+      } else {
+        setReviewed({ ...reviewed, [productId]: (await response.text()).trim() || 'Review failed' })
+      }
+    } catch (err) {
+      setReviewed({ ...reviewed, [productId]: 'Network error occurred' })
+    }
+  }
+
   const fetchAllData = async () => {
     try {
       setLoading(true)
@@ -158,7 +173,7 @@ const PurchaseHistory = () => {
                       </div>
                       <div>
                         <h3 className="font-semibold text-white text-lg" style={{ fontFamily: 'Inter, sans-serif' }}>
-                          {purchase.product?.name || 'Unknown Product'}
+                          {purchase.product_name || purchase.product?.name || 'Unknown Product'}
                         </h3>
                         <p className="text-white/60 text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
                           {purchase.product?.description || 'No description available'}
@@ -172,6 +187,16 @@ const PurchaseHistory = () => {
                       <p className="text-white/60 text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
                         {purchase.quantity} × {formatPrice(purchase.unit_price)}
                       </p>
+                      {purchase.discount ? (
+                        <p className="text-green-400 text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
+                          −{formatPrice(purchase.discount)}{purchase.promotion_code ? ` (${purchase.promotion_code})` : ''}
+                        </p>
+                      ) : null}
+                      {purchase.tax_amount ? (
+                        <p className="text-white/60 text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
+                          incl. {formatPrice(purchase.tax_amount)} tax ({(purchase.tax_rate_bp ?? 0) / 100}%)
+                        </p>
+                      ) : null}
                     </div>
                   </div>
 
@@ -197,6 +222,35 @@ const PurchaseHistory = () => {
                       </span>
                     </div>
                   </div>
+
+                  {purchase.transaction_type === 'purchase' && (
+                    <div className="flex items-center gap-2 pt-4">
+                      {typeof reviewed[purchase.product_id] === 'string' ? (
+                        <span className="text-white/60 text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
+                          {reviewed[purchase.product_id]}
+                        </span>
+                      ) : (
+                        <>
+                          <span className="text-white/60 text-sm" style={{ fontFamily: 'Inter, sans-serif' }}>
+                            {reviewed[purchase.product_id] ? 'Thanks for your review' : 'Rate this product'}
+                          </span>
+                          {[1, 2, 3, 4, 5].map((stars) => (
+                            <button
+                              key={stars}
+                              onClick={() => handleReview(purchase.product_id, stars)}
+                              disabled={reviewed[purchase.product_id] !== undefined}
+                              className="text-yellow-400 disabled:cursor-default"
+                            >
+                              <Star
+                                size={16}
+                                fill={stars <= ((reviewed[purchase.product_id] as number) || 0) ? 'currentColor' : 'none'}
+                              />
+                            </button>
+                          ))}
+                        </>
+                      )}
+                    </div>
+                  )}
                 </div>
               ))}
             </div>
@@ -28,6 +28,7 @@ export const createAccount = (accountData: CreateAccountRequest): Promise<Respon
 export interface DepositRequest {
   account_id: string
   amount: number
+  source: string
 }
 
 export const depositMoney = (depositData: DepositRequest): Promise<Response> => {
@@ -23,6 +23,21 @@ export const get = (endpoint: string) => {
     return apiRequest(endpoint, {method: 'GET'});
 }
 
+// mediaURL turns a /media/ path from the API into an absolute URL.
+export const mediaURL = (path: string) => {
+    return baseURL + path;
+}
+
+// upload sends multipart form data, letting the browser set its Content-Type.
+export const upload = (endpoint: string, data: FormData) => {
+    let token : string | null  = getToken();
+    return fetch(baseURL + endpoint, {
+        method: 'POST',
+        headers: token ? {Authorization: `Bearer ${token}`} : {},
+        body: data
+    })
+}
+
 export const post = (endpoint: string, data:any) => {
     return apiRequest(endpoint, {
         method: 'POST',
@@ -1,11 +1,49 @@
-import { get, post } from './api'
+import { get, post, upload } from './api'
+
+export interface ProductVariant {
+  sku: string
+  attributes: Record<string, string>
+  price?: number
+  stock: number
+  reserved: number
+  available: number
+}
+
+export interface ProductImage {
+  id: string
+  url: string
+  thumbnail_url: string
+  content_type: string
+  width: number
+  height: number
+  size: number
+  created_at: string
+}
 
 export interface Product {
   id: string
+  sku?: string
   name: string
   description: string
   price: number
   stock: number
+  reserved: number
+  available: number
+  created_at: string
+  archived_at?: string
+  variants?: ProductVariant[]
+  images?: ProductImage[]
+  rating: number
+  rating_count: number
+}
+
+export interface ProductReview {
+  id: string
+  product_id: string
+  user_id: string
+  username: string
+  rating: number
+  text: string
   created_at: string
 }
 
@@ -16,14 +54,28 @@ export interface CreateProductRequest {
   stock: number
 }
 
-export const getProducts = (): Promise<Response> => {
-  return get('/products')
+export const getProducts = (sort?: string): Promise<Response> => {
+  return get(sort ? `/products?sort=${sort}` : '/products')
+}
+
+export const getProductReviews = (productId: string): Promise<Response> => {
+  return get(`/products/${productId}/reviews`)
+}
+
+export const createProductReview = (productId: string, rating: number, text: string): Promise<Response> => {
+  return post(`/products/${productId}/reviews`, { rating, text })
 }
 
 export const getProductById = (productId: string): Promise<Response> => {
   return get(`/products/${productId}`)
 }
 
+export const uploadProductImage = (productId: string, file: File): Promise<Response> => {
+  const data = new FormData()
+  data.append('image', file)
+  return upload(`/products/${productId}/images`, data)
+}
+
 export const createProduct = (productData: CreateProductRequest): Promise<Response> => {
   return post('/products', productData)
 }
\ No newline at end of file
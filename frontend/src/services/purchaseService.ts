@@ -5,9 +5,17 @@ export interface Transaction {
   user_id: string
   account_id: string
   product_id: string
+  product_name?: string
   quantity: number
   unit_price: number
+  discount?: number
+  promotion_code?: string
   total_amount: number
+  net_amount?: number
+  tax_amount?: number
+  tax_rate_bp?: number
+  tax_class?: string
+  tax_jurisdiction?: string
   transaction_type: string
   created_at: string
 }
@@ -15,7 +23,9 @@ export interface Transaction {
 export interface PurchaseRequest {
   account_id: string
   product_id: string
+  sku?: string
   quantity: number
+  promotion_code?: string
 }
 
 export const getPurchaseHistory = (): Promise<Response> => {